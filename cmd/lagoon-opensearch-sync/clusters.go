@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/dashboards"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/tlsconfig"
+	"go.uber.org/zap"
+)
+
+// syncObjects is the list of Opensearch objects which may be synchronised.
+var syncObjects = []string{
+	"tenants",
+	"roles",
+	"rolesmapping",
+	"indexpatterns",
+	"componenttemplates",
+	"ingestpipelines",
+	"indextemplates",
+	"ismpolicies",
+}
+
+// opensearchFlavours is the list of Opensearch cluster flavours.
+var opensearchFlavours = []string{
+	opensearch.FlavourAuto,
+	opensearch.FlavourOpensearch,
+	opensearch.FlavourOpendistro,
+}
+
+// clusterConfig is the configuration of a single Opensearch cluster, and its
+// associated Opensearch Dashboards, in the clusters file. Optional fields
+// which are not set fall back to the values given on the command line.
+type clusterConfig struct {
+	Name                                      string                               `json:"name"`
+	OpensearchBaseURL                         string                               `json:"opensearchBaseURL"`
+	OpensearchUsername                        string                               `json:"opensearchUsername"`
+	OpensearchPassword                        string                               `json:"opensearchPassword"`
+	OpensearchPasswordFile                    string                               `json:"opensearchPasswordFile"`
+	OpensearchCACertificate                   string                               `json:"opensearchCACertificate"`
+	OpensearchCACertificateFile               string                               `json:"opensearchCACertificateFile"`
+	OpensearchCASystemPool                    *bool                                `json:"opensearchCASystemPool"`
+	OpensearchInsecureSkipVerify              *bool                                `json:"opensearchInsecureSkipVerify"`
+	OpensearchClientCertificate               string                               `json:"opensearchClientCertificate"`
+	OpensearchClientCertificateFile           string                               `json:"opensearchClientCertificateFile"`
+	OpensearchClientKey                       string                               `json:"opensearchClientKey"`
+	OpensearchClientKeyFile                   string                               `json:"opensearchClientKeyFile"`
+	OpensearchServerName                      string                               `json:"opensearchServerName"`
+	OpensearchFlavour                         string                               `json:"opensearchFlavour"`
+	OpensearchAuthMode                        string                               `json:"opensearchAuthMode"`
+	SigV4Region                               string                               `json:"sigV4Region"`
+	SigV4Service                              string                               `json:"sigV4Service"`
+	OpensearchDashboardsBaseURL               string                               `json:"opensearchDashboardsBaseURL"`
+	OpensearchDashboardsCACertificate         string                               `json:"opensearchDashboardsCACertificate"`
+	OpensearchDashboardsCACertificateFile     string                               `json:"opensearchDashboardsCACertificateFile"`
+	OpensearchDashboardsCASystemPool          *bool                                `json:"opensearchDashboardsCASystemPool"`
+	OpensearchDashboardsInsecureSkipVerify    *bool                                `json:"opensearchDashboardsInsecureSkipVerify"`
+	OpensearchDashboardsClientCertificate     string                               `json:"opensearchDashboardsClientCertificate"`
+	OpensearchDashboardsClientCertificateFile string                               `json:"opensearchDashboardsClientCertificateFile"`
+	OpensearchDashboardsClientKey             string                               `json:"opensearchDashboardsClientKey"`
+	OpensearchDashboardsClientKeyFile         string                               `json:"opensearchDashboardsClientKeyFile"`
+	OpensearchDashboardsServerName            string                               `json:"opensearchDashboardsServerName"`
+	Objects                                   []string                             `json:"objects"`
+	LegacyIndexPatternDelimiter               *bool                                `json:"legacyIndexPatternDelimiter"`
+	Organizations                             *bool                                `json:"organizations"`
+	DevelopmentOnlyGroups                     []string                             `json:"developmentOnlyGroups"`
+	DevelopmentOnlyGroupRoles                 []string                             `json:"developmentOnlyGroupRoles"`
+	GroupRoles                                map[string]sync.GroupRolePermissions `json:"groupRoles"`
+	BuiltinIndexTemplates                     []string                             `json:"builtinIndexTemplates"`
+	BuiltinIndexTemplatePriority              *int                                 `json:"builtinIndexTemplatePriority"`
+	IndexTemplatesDir                         string                               `json:"indexTemplatesDir"`
+	IngestPipelinesDir                        string                               `json:"ingestPipelinesDir"`
+	ISMRetentionDays                          map[string]int                       `json:"ismRetentionDays"`
+	// the index templates read from IndexTemplatesDir, or from the directory
+	// given on the command line.
+	indexTemplates map[string]opensearch.IndexTemplate
+	// the ingest pipelines read from IngestPipelinesDir, or from the directory
+	// given on the command line.
+	ingestPipelines map[string]opensearch.IngestPipeline
+	// the key of the Lagoon project metadata which overrides the ISM
+	// retention of a project, given on the command line.
+	ismProjectRetentionKey string
+	// implicit is true for the single cluster configured from the command line
+	// flags when a clusters file is not given. It is not named in logs,
+	// metrics, and dry run diffs, so that their format is the same as before
+	// multiple clusters were supported.
+	implicit bool
+	// the resolved credentials and TLS configuration used by newTarget. These
+	// are reloaded when they are read from files which change.
+	opensearchPassword *secret.Value
+	opensearchTLS      tlsconfig.Source
+	dashboardsTLS      tlsconfig.Source
+}
+
+// clusterSecret is a secret in a clusterConfig, which is given either
+// inline or as the path of a file.
+type clusterSecret struct {
+	field string
+	value string
+	path  string
+	dest  **secret.Value
+}
+
+// isSet returns true if a secret is given either inline as the given value,
+// or as a file at the given path.
+func isSet(value, path string) bool {
+	return value != "" || path != ""
+}
+
+// secrets returns the secrets in the clusterConfig, and where each is stored
+// when resolved.
+func (c *clusterConfig) secrets() []clusterSecret {
+	return []clusterSecret{
+		{"opensearchPassword", c.OpensearchPassword, c.OpensearchPasswordFile,
+			&c.opensearchPassword},
+		{"opensearchCACertificate", c.OpensearchCACertificate,
+			c.OpensearchCACertificateFile, &c.opensearchTLS.CACertificates},
+		{"opensearchClientCertificate", c.OpensearchClientCertificate,
+			c.OpensearchClientCertificateFile, &c.opensearchTLS.ClientCertificate},
+		{"opensearchClientKey", c.OpensearchClientKey, c.OpensearchClientKeyFile,
+			&c.opensearchTLS.ClientKey},
+		{"opensearchDashboardsCACertificate", c.OpensearchDashboardsCACertificate,
+			c.OpensearchDashboardsCACertificateFile, &c.dashboardsTLS.CACertificates},
+		{"opensearchDashboardsClientCertificate",
+			c.OpensearchDashboardsClientCertificate,
+			c.OpensearchDashboardsClientCertificateFile,
+			&c.dashboardsTLS.ClientCertificate},
+		{"opensearchDashboardsClientKey", c.OpensearchDashboardsClientKey,
+			c.OpensearchDashboardsClientKeyFile, &c.dashboardsTLS.ClientKey},
+	}
+}
+
+// resolve sets the credentials and TLS configuration used by newTarget from
+// the values and files in the clusterConfig. Secrets read from files are
+// reloaded when the files change. It must be called after optional fields are
+// set to their default values.
+func (c *clusterConfig) resolve() error {
+	c.opensearchTLS = tlsconfig.Source{
+		SystemCertPool:     *c.OpensearchCASystemPool,
+		InsecureSkipVerify: *c.OpensearchInsecureSkipVerify,
+		ServerName:         c.OpensearchServerName,
+	}
+	c.dashboardsTLS = tlsconfig.Source{
+		SystemCertPool:     *c.OpensearchDashboardsCASystemPool,
+		InsecureSkipVerify: *c.OpensearchDashboardsInsecureSkipVerify,
+		ServerName:         c.OpensearchDashboardsServerName,
+	}
+	for _, s := range c.secrets() {
+		value, err := secret.New(s.value, s.path)
+		if err != nil {
+			return fmt.Errorf("couldn't read %sFile: %v", s.field, err)
+		}
+		*s.dest = value
+	}
+	return nil
+}
+
+// validate the clusterConfig.
+func (c *clusterConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if c.OpensearchBaseURL == "" {
+		return fmt.Errorf("missing opensearchBaseURL")
+	}
+	if !slices.Contains(opensearchFlavours, c.OpensearchFlavour) {
+		return fmt.Errorf("unknown opensearchFlavour %s", c.OpensearchFlavour)
+	}
+	for _, s := range c.secrets() {
+		if s.value != "" && s.path != "" {
+			return fmt.Errorf("%s and %sFile are mutually exclusive",
+				s.field, s.field)
+		}
+	}
+	hasCert := isSet(c.OpensearchClientCertificate,
+		c.OpensearchClientCertificateFile)
+	if hasCert != isSet(c.OpensearchClientKey, c.OpensearchClientKeyFile) {
+		return fmt.Errorf("opensearchClientCertificate and " +
+			"opensearchClientKey must be specified together")
+	}
+	switch c.OpensearchAuthMode {
+	case authModeBasic:
+		if !isSet(c.OpensearchPassword, c.OpensearchPasswordFile) && !hasCert {
+			return fmt.Errorf("missing opensearchPassword")
+		}
+		if !isSet(c.OpensearchCACertificate, c.OpensearchCACertificateFile) &&
+			!*c.OpensearchCASystemPool &&
+			!*c.OpensearchInsecureSkipVerify {
+			return fmt.Errorf("missing opensearchCACertificate")
+		}
+	case authModeSigV4:
+		if c.SigV4Region == "" {
+			return fmt.Errorf("missing sigV4Region")
+		}
+		if !slices.Contains(sigV4Services, c.SigV4Service) {
+			return fmt.Errorf("unknown sigV4Service %s", c.SigV4Service)
+		}
+	default:
+		return fmt.Errorf("unknown opensearchAuthMode %s", c.OpensearchAuthMode)
+	}
+	if c.OpensearchDashboardsBaseURL == "" {
+		return fmt.Errorf("missing opensearchDashboardsBaseURL")
+	}
+	if isSet(c.OpensearchDashboardsClientCertificate,
+		c.OpensearchDashboardsClientCertificateFile) !=
+		isSet(c.OpensearchDashboardsClientKey,
+			c.OpensearchDashboardsClientKeyFile) {
+		return fmt.Errorf("opensearchDashboardsClientCertificate and " +
+			"opensearchDashboardsClientKey must be specified together")
+	}
+	for _, object := range c.Objects {
+		if !slices.Contains(syncObjects, object) {
+			return fmt.Errorf("unknown object %s", object)
+		}
+	}
+	for _, name := range c.BuiltinIndexTemplates {
+		if !sync.IsBuiltinIndexTemplate(name) {
+			return fmt.Errorf("unknown builtinIndexTemplates %s", name)
+		}
+	}
+	if p := c.BuiltinIndexTemplatePriority; p != nil && *p < 0 {
+		return fmt.Errorf("invalid builtinIndexTemplatePriority: %d", *p)
+	}
+	retention := sync.ISMRetention{Days: c.ISMRetentionDays}
+	if err := retention.Validate(); err != nil {
+		return fmt.Errorf("invalid ismRetentionDays: %v", err)
+	}
+	if err := validateGroupRoles(c.GroupRoles); err != nil {
+		return err
+	}
+	err := sync.ValidateDevelopmentOnlyGroupRoles(c.GroupRoles,
+		c.DevelopmentOnlyGroupRoles)
+	if err != nil {
+		return fmt.Errorf("invalid developmentOnlyGroupRoles: %v", err)
+	}
+	return nil
+}
+
+// readClusterConfigs reads the list of cluster configurations in the JSON
+// file at the given path. The cluster configurations are validated by the
+// caller, after optional fields are set to their default values.
+func readClusterConfigs(path string) ([]clusterConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open clusters file: %v", err)
+	}
+	defer f.Close()
+	var clusters []clusterConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&clusters); err != nil {
+		return nil, fmt.Errorf("couldn't decode clusters file: %v", err)
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no clusters in clusters file")
+	}
+	names := map[string]bool{}
+	for i := range clusters {
+		if clusters[i].Name == "" {
+			return nil, fmt.Errorf("missing name of cluster at index %d", i)
+		}
+		if names[clusters[i].Name] {
+			return nil, fmt.Errorf("duplicate cluster name %s", clusters[i].Name)
+		}
+		names[clusters[i].Name] = true
+	}
+	return clusters, nil
+}
+
+// newTarget initialises the Opensearch and Opensearch Dashboards clients for
+// the given resolved cluster configuration, and returns them in a
+// sync.Target.
+func newTarget(
+	log *zap.Logger,
+	c *clusterConfig,
+	opensearchTimeout,
+	dashboardsTimeout time.Duration,
+) (*sync.Target, error) {
+	transport, err := newOpensearchTransport(log, c.opensearchTLS)
+	if err != nil {
+		return nil, err
+	}
+	signer := newSigner(c.OpensearchAuthMode, c.SigV4Region, c.SigV4Service)
+	o, err := opensearch.NewClient(
+		log,
+		c.OpensearchBaseURL,
+		c.OpensearchUsername,
+		c.opensearchPassword,
+		transport,
+		signer,
+		c.OpensearchFlavour,
+		opensearchTimeout,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't init opensearch client: %v", err)
+	}
+	// the Opensearch Dashboards API only supports basic authentication
+	if c.OpensearchAuthMode == authModeBasic && c.opensearchPassword == nil &&
+		slices.Contains(c.Objects, "indexpatterns") {
+		return nil, fmt.Errorf(
+			"opensearch password is required to synchronise indexpatterns")
+	}
+	dashboardsTransport, err := newDashboardsTransport(log, c.dashboardsTLS)
+	if err != nil {
+		return nil, err
+	}
+	d, err := dashboards.NewClient(
+		c.OpensearchDashboardsBaseURL,
+		c.OpensearchUsername,
+		c.opensearchPassword,
+		dashboardsTransport,
+		signer,
+		dashboardsTimeout,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't init opensearch dashboards client: %v",
+			err)
+	}
+	name := c.Name
+	if c.implicit {
+		name = ""
+	}
+	return &sync.Target{
+		Name:                        name,
+		Opensearch:                  o,
+		Dashboards:                  d,
+		Objects:                     c.Objects,
+		LegacyIndexPatternDelimiter: *c.LegacyIndexPatternDelimiter,
+		Organizations:               *c.Organizations,
+		DevelopmentOnlyGroups:       c.DevelopmentOnlyGroups,
+		DevelopmentOnlyGroupRoles:   c.DevelopmentOnlyGroupRoles,
+		GroupRoles:                  c.GroupRoles,
+		BuiltinIndexTemplates: sync.BuiltinIndexTemplates{
+			Names:    c.BuiltinIndexTemplates,
+			Priority: *c.BuiltinIndexTemplatePriority,
+		},
+		IndexTemplates:  c.indexTemplates,
+		IngestPipelines: c.ingestPipelines,
+		ISMRetention: sync.ISMRetention{
+			Days:               c.ISMRetentionDays,
+			ProjectMetadataKey: c.ismProjectRetentionKey,
+		},
+	}, nil
+}
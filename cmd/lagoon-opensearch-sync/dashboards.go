@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/tlsconfig"
+	"go.uber.org/zap"
+)
+
+// dashboardsFlags are the command line flags which configure the Opensearch
+// Dashboards client.
+type dashboardsFlags struct {
+	OpensearchDashboardsBaseURL               string        `kong:"env='OPENSEARCH_DASHBOARDS_BASE_URL',help='Opensearch Dashboards Base URL'"`
+	OpensearchDashboardsClientTimeout         time.Duration `kong:"default='30s',env='OPENSEARCH_DASHBOARDS_CLIENT_TIMEOUT',help='Opensearch Dashboards HTTP client request timeout'"`
+	OpensearchDashboardsCACertificate         string        `kong:"env='OPENSEARCH_DASHBOARDS_CA_CERTIFICATE',xor='opensearch-dashboards-ca-certificate',help='Opensearch Dashboards CA Certificate bundle in PEM format. If not set, the system CA certificates are trusted'"`
+	OpensearchDashboardsCACertificateFile     string        `kong:"type='existingfile',env='OPENSEARCH_DASHBOARDS_CA_CERTIFICATE_FILE',xor='opensearch-dashboards-ca-certificate',help='Path to the Opensearch Dashboards CA Certificate bundle in PEM format'"`
+	OpensearchDashboardsCASystemPool          bool          `kong:"name='opensearch-dashboards-ca-system-pool',env='OPENSEARCH_DASHBOARDS_CA_SYSTEM_POOL',help='Trust the system CA certificates in addition to the Opensearch Dashboards CA Certificate'"`
+	OpensearchDashboardsInsecureSkipVerify    bool          `kong:"env='OPENSEARCH_DASHBOARDS_INSECURE_SKIP_VERIFY',help='Disable Opensearch Dashboards TLS certificate verification. Insecure, for local development only'"`
+	OpensearchDashboardsClientCertificate     string        `kong:"env='OPENSEARCH_DASHBOARDS_CLIENT_CERTIFICATE',xor='opensearch-dashboards-client-certificate',help='Opensearch Dashboards client certificate in PEM format, used for TLS client authentication'"`
+	OpensearchDashboardsClientCertificateFile string        `kong:"type='existingfile',env='OPENSEARCH_DASHBOARDS_CLIENT_CERTIFICATE_FILE',xor='opensearch-dashboards-client-certificate',help='Path to the Opensearch Dashboards client certificate in PEM format'"`
+	OpensearchDashboardsClientKey             string        `kong:"env='OPENSEARCH_DASHBOARDS_CLIENT_KEY',xor='opensearch-dashboards-client-key',help='Opensearch Dashboards client private key in PEM format'"`
+	OpensearchDashboardsClientKeyFile         string        `kong:"type='existingfile',env='OPENSEARCH_DASHBOARDS_CLIENT_KEY_FILE',xor='opensearch-dashboards-client-key',help='Path to the Opensearch Dashboards client private key in PEM format'"`
+	OpensearchDashboardsServerName            string        `kong:"env='OPENSEARCH_DASHBOARDS_SERVER_NAME',help='Override the host name used to verify the Opensearch Dashboards TLS certificate'"`
+}
+
+// tlsSource returns the Opensearch Dashboards TLS source.
+func (f *dashboardsFlags) tlsSource() (tlsconfig.Source, error) {
+	source, err := newTLSSource(
+		f.OpensearchDashboardsCACertificate,
+		f.OpensearchDashboardsCACertificateFile,
+		f.OpensearchDashboardsClientCertificate,
+		f.OpensearchDashboardsClientCertificateFile,
+		f.OpensearchDashboardsClientKey,
+		f.OpensearchDashboardsClientKeyFile,
+	)
+	if err != nil {
+		return tlsconfig.Source{}, err
+	}
+	source.SystemCertPool = f.OpensearchDashboardsCASystemPool
+	source.InsecureSkipVerify = f.OpensearchDashboardsInsecureSkipVerify
+	source.ServerName = f.OpensearchDashboardsServerName
+	return source, nil
+}
+
+// newDashboardsTransport returns a transport which connects to Opensearch
+// Dashboards using the TLS configuration from the given source.
+func newDashboardsTransport(
+	log *zap.Logger,
+	source tlsconfig.Source,
+) (*tlsconfig.Transport, error) {
+	transport, err := tlsconfig.NewTransport(log, source,
+		http.DefaultTransport.(*http.Transport).Clone())
+	if err != nil {
+		return nil, fmt.Errorf(
+			"couldn't construct opensearch dashboards TLS config: %v", err)
+	}
+	return transport, nil
+}
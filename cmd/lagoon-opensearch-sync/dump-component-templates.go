@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// DumpComponentTemplatesCmd represents the `dump-component-templates` command.
+type DumpComponentTemplatesCmd struct {
+	opensearchFlags `kong:"embed"`
+	Raw             bool `kong:"help='Dump the raw JSON recevied from the backend service.'"`
+}
+
+// Validate the dump-component-templates command flags.
+func (cmd *DumpComponentTemplatesCmd) Validate() error {
+	return cmd.opensearchFlags.validate()
+}
+
+// Run the dump-component-templates command.
+func (cmd *DumpComponentTemplatesCmd) Run(log *zap.Logger) error {
+	// get main process context, which cancels on SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	// init the opensearch client
+	o, err := cmd.newOpensearchClient(log)
+	if err != nil {
+		return err
+	}
+	if cmd.Raw {
+		data, err := o.RawComponentTemplates(ctx)
+		fmt.Println(string(data))
+		return err
+	}
+	// get the component templates
+	ct, err := o.ComponentTemplates(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get opensearch component templates: %v", err)
+	}
+	// marshal and dump
+	data, err := json.Marshal(ct)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal component templates: %v", err)
+	}
+	_, err = fmt.Println(string(data))
+	return err
+}
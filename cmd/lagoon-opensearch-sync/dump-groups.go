@@ -1,10 +1,13 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
@@ -12,10 +15,16 @@ import (
 
 // DumpGroupsCmd represents the `dump-groups` command.
 type DumpGroupsCmd struct {
-	KeycloakClientID     string `kong:"default='lagoon-opensearch-sync',env='KEYCLOAK_CLIENT_ID',help='Keycloak OAuth2 Client ID'"`
-	KeycloakClientSecret string `kong:"required,env='KEYCLOAK_CLIENT_SECRET',help='Keycloak OAuth2 Client Secret'"`
-	KeycloakBaseURL      string `kong:"required,env='KEYCLOAK_BASE_URL',help='Keycloak Base URL'"`
-	Raw                  bool   `kong:"help='Dump the raw JSON recevied from the backend service.'"`
+	Raw      bool `kong:"help='Dump the raw JSON recevied from the backend service.'"`
+	RawFirst int  `kong:"default='0',help='Offset of the first group in the raw JSON page. Requires --raw-max.'"`
+	RawMax   int  `kong:"default='0',help='Maximum number of groups in the raw JSON page, or 0 to dump all groups.'"`
+	// keycloak client fields
+	keycloakFlags `kong:"embed"`
+}
+
+// Validate the dump-groups command flags.
+func (cmd *DumpGroupsCmd) Validate() error {
+	return cmd.keycloakFlags.validate()
 }
 
 // Run the dump-groups command.
@@ -24,13 +33,12 @@ func (cmd *DumpGroupsCmd) Run() error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
 	defer stop()
 	// init the keycloak client
-	k, err := keycloak.NewClientCredentialsClient(ctx, cmd.KeycloakBaseURL,
-		cmd.KeycloakClientID, cmd.KeycloakClientSecret)
+	k, err := cmd.newKeycloakClient(ctx)
 	if err != nil {
-		return fmt.Errorf("couldn't init keycloak client: %v", err)
+		return err
 	}
 	if cmd.Raw {
-		data, err := k.RawGroups(ctx)
+		data, err := k.RawGroups(ctx, cmd.RawFirst, cmd.RawMax)
 		fmt.Println(string(data))
 		return err
 	}
@@ -38,6 +46,10 @@ func (cmd *DumpGroupsCmd) Run() error {
 	if err != nil {
 		return fmt.Errorf("couldn't get keycloak groups: %v", err)
 	}
+	// sort the groups so that the output is stable
+	slices.SortFunc(groups, func(a, b keycloak.Group) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
 	j, err := json.Marshal(groups)
 	if err != nil {
 		return fmt.Errorf("couldn't marshal groups: %v", err)
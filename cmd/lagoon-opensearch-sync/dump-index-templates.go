@@ -6,20 +6,19 @@ import (
 	"fmt"
 	"os/signal"
 	"syscall"
-	"time"
 
-	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
 	"go.uber.org/zap"
 )
 
 // DumpIndexTemplatesCmd represents the `dump-index-templates` command.
 type DumpIndexTemplatesCmd struct {
-	OpensearchUsername      string        `kong:"default='admin',env='OPENSEARCH_ADMIN_USERNAME',help='Opensearch admin user'"`
-	OpensearchPassword      string        `kong:"required,env='OPENSEARCH_ADMIN_PASSWORD',help='Opensearch admin password'"`
-	OpensearchBaseURL       string        `kong:"required,env='OPENSEARCH_BASE_URL',help='Opensearch Base URL'"`
-	OpensearchCACertificate string        `kong:"required,env='OPENSEARCH_CA_CERTIFICATE',help='Opensearch CA Certificate'"`
-	OpensearchClientTimeout time.Duration `kong:"default='30s',env='OPENSEARCH_CLIENT_TIMEOUT',help='Opensearch HTTP client request timeout'"`
-	Raw                     bool          `kong:"help='Dump the raw JSON recevied from the backend service.'"`
+	opensearchFlags `kong:"embed"`
+	Raw             bool `kong:"help='Dump the raw JSON recevied from the backend service.'"`
+}
+
+// Validate the dump-index-templates command flags.
+func (cmd *DumpIndexTemplatesCmd) Validate() error {
+	return cmd.opensearchFlags.validate()
 }
 
 // Run the dump-index-templates command.
@@ -28,16 +27,9 @@ func (cmd *DumpIndexTemplatesCmd) Run(log *zap.Logger) error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
 	defer stop()
 	// init the opensearch client
-	o, err := opensearch.NewClient(
-		log,
-		cmd.OpensearchBaseURL,
-		cmd.OpensearchUsername,
-		cmd.OpensearchPassword,
-		cmd.OpensearchCACertificate,
-		cmd.OpensearchClientTimeout,
-	)
+	o, err := cmd.newOpensearchClient(log)
 	if err != nil {
-		return fmt.Errorf("couldn't init opensearch client: %v", err)
+		return err
 	}
 	if cmd.Raw {
 		data, err := o.RawIndexTemplates(ctx)
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// DumpIngestPipelinesCmd represents the `dump-ingest-pipelines` command.
+type DumpIngestPipelinesCmd struct {
+	opensearchFlags `kong:"embed"`
+	Raw             bool `kong:"help='Dump the raw JSON recevied from the backend service.'"`
+}
+
+// Validate the dump-ingest-pipelines command flags.
+func (cmd *DumpIngestPipelinesCmd) Validate() error {
+	return cmd.opensearchFlags.validate()
+}
+
+// Run the dump-ingest-pipelines command.
+func (cmd *DumpIngestPipelinesCmd) Run(log *zap.Logger) error {
+	// get main process context, which cancels on SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	// init the opensearch client
+	o, err := cmd.newOpensearchClient(log)
+	if err != nil {
+		return err
+	}
+	if cmd.Raw {
+		data, err := o.RawIngestPipelines(ctx)
+		fmt.Println(string(data))
+		return err
+	}
+	// get the ingest pipelines
+	ip, err := o.IngestPipelines(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get opensearch ingest pipelines: %v", err)
+	}
+	// marshal and dump
+	data, err := json.Marshal(ip)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal ingest pipelines: %v", err)
+	}
+	_, err = fmt.Println(string(data))
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// DumpISMPoliciesCmd represents the `dump-ism-policies` command.
+type DumpISMPoliciesCmd struct {
+	opensearchFlags `kong:"embed"`
+	Raw             bool `kong:"help='Dump the raw JSON recevied from the backend service.'"`
+	RawSearchSize   uint `kong:"default='10000',help='Set the size parameter of the request, which controls the number of policies returned.'"`
+	RawFrom         int  `kong:"default='0',help='Set the from parameter of the request, which controls the offset of the first policy returned.'"`
+}
+
+// Validate the dump-ism-policies command flags.
+func (cmd *DumpISMPoliciesCmd) Validate() error {
+	return cmd.opensearchFlags.validate()
+}
+
+// Run the dump-ism-policies command.
+func (cmd *DumpISMPoliciesCmd) Run(log *zap.Logger) error {
+	// get main process context, which cancels on SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	// init the opensearch client
+	o, err := cmd.newOpensearchClient(log)
+	if err != nil {
+		return err
+	}
+	if cmd.Raw {
+		data, err := o.RawISMPolicies(ctx, cmd.RawSearchSize, cmd.RawFrom)
+		fmt.Println(string(data))
+		return err
+	}
+	// get the ISM policies
+	p, err := o.ISMPolicies(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get opensearch ISM policies: %v", err)
+	}
+	// marshal and dump
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal ISM policies: %v", err)
+	}
+	_, err = fmt.Println(string(data))
+	return err
+}
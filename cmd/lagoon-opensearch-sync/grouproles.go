@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+)
+
+// validateGroupRoles validates each of the given group role permission sets.
+func validateGroupRoles(groupRoles map[string]sync.GroupRolePermissions) error {
+	for groupRole, permissions := range groupRoles {
+		if err := permissions.Validate(); err != nil {
+			return fmt.Errorf("invalid group role %s: %v", groupRole, err)
+		}
+	}
+	return nil
+}
+
+// readGroupRoles reads and validates the map of Lagoon group roles to
+// permission sets in the JSON file at the given path.
+func readGroupRoles(path string) (map[string]sync.GroupRolePermissions, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open group roles file: %v", err)
+	}
+	defer f.Close()
+	var groupRoles map[string]sync.GroupRolePermissions
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&groupRoles); err != nil {
+		return nil, fmt.Errorf("couldn't decode group roles file: %v", err)
+	}
+	if err = validateGroupRoles(groupRoles); err != nil {
+		return nil, err
+	}
+	return groupRoles, nil
+}
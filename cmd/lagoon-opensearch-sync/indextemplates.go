@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+)
+
+// decodeIndexTemplate decodes the JSON or YAML index template body in data.
+func decodeIndexTemplate(
+	data []byte,
+) (opensearch.IndexTemplateDefinition, error) {
+	var def opensearch.IndexTemplateDefinition
+	if err := decodeObject(data, &def); err != nil {
+		return def, fmt.Errorf("couldn't decode index template: %v", err)
+	}
+	if len(def.IndexPatterns) == 0 {
+		return def, fmt.Errorf("missing index_patterns")
+	}
+	return def, nil
+}
+
+// readIndexTemplates reads the index templates in the directory at the given
+// path. Each file contains the body of a composable index template, and the
+// template is named after the file. See readObjectDir.
+func readIndexTemplates(
+	dir string,
+) (map[string]opensearch.IndexTemplate, error) {
+	defs, err := readObjectDir(dir, "index template",
+		sync.IsBuiltinIndexTemplate, decodeIndexTemplate)
+	if err != nil {
+		return nil, err
+	}
+	indexTemplates := map[string]opensearch.IndexTemplate{}
+	for name, def := range defs {
+		indexTemplates[name] = opensearch.IndexTemplate{
+			Name:                    name,
+			IndexTemplateDefinition: def,
+		}
+	}
+	return indexTemplates, nil
+}
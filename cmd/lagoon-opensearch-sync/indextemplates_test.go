@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDecodeIndexTemplate(t *testing.T) {
+	var testCases = map[string]struct {
+		input     string
+		expectErr bool
+	}{
+		"full template": {
+			input: `
+index_patterns:
+- custom-logs-*
+priority: 100
+template:
+  settings:
+    number_of_replicas: 1
+  aliases:
+    custom-logs: {}
+  mappings:
+    dynamic_templates:
+    - strings:
+        match_mapping_type: string
+        mapping:
+          type: keyword
+          null_value: NULL
+          copy_to: all_strings
+`,
+		},
+		"unknown field": {
+			input: `
+index_patterns:
+- custom-logs-*
+priorty: 100
+`,
+			expectErr: true,
+		},
+		"missing index patterns": {
+			input:     `priority: 100`,
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			_, err := decodeIndexTemplate([]byte(tc.input))
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+)
+
+// decodeIngestPipeline decodes the JSON or YAML ingest pipeline body in data.
+func decodeIngestPipeline(data []byte) (opensearch.IngestPipeline, error) {
+	var p opensearch.IngestPipeline
+	if err := decodeObject(data, &p); err != nil {
+		return p, fmt.Errorf("couldn't decode ingest pipeline: %v", err)
+	}
+	if len(p.Processors) == 0 {
+		return p, fmt.Errorf("missing processors")
+	}
+	return p, nil
+}
+
+// readIngestPipelines reads the ingest pipelines in the directory at the
+// given path. Each file contains the body of an ingest pipeline, and the
+// pipeline ID is the file name. See readObjectDir.
+func readIngestPipelines(
+	dir string,
+) (map[string]opensearch.IngestPipeline, error) {
+	return readObjectDir(dir, "ingest pipeline", sync.IsBuiltinIngestPipeline,
+		decodeIngestPipeline)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+)
+
+// keycloakFlags are the command line flags which configure the Keycloak
+// client. They are embedded in each command which connects to Keycloak.
+type keycloakFlags struct {
+	KeycloakClientID         string `kong:"default='lagoon-opensearch-sync',env='KEYCLOAK_CLIENT_ID',help='Keycloak OAuth2 Client ID'"`
+	KeycloakClientSecret     string `kong:"env='KEYCLOAK_CLIENT_SECRET',xor='keycloak-client-secret',help='Keycloak OAuth2 Client Secret'"`
+	KeycloakClientSecretFile string `kong:"type='existingfile',env='KEYCLOAK_CLIENT_SECRET_FILE',xor='keycloak-client-secret',help='Path to a file containing the Keycloak OAuth2 Client Secret. The file is reloaded when it changes'"`
+	KeycloakBaseURL          string `kong:"env='KEYCLOAK_BASE_URL',help='Keycloak Base URL'"`
+	KeycloakRealm            string `kong:"default='lagoon',env='KEYCLOAK_REALM',help='Keycloak realm containing the Lagoon groups'"`
+	KeycloakURLLayout        string `kong:"enum='auto,legacy,modern',default='auto',env='KEYCLOAK_URL_LAYOUT',help='Keycloak URL layout: legacy (/auth path prefix, Keycloak < 17), modern (no prefix), or auto to detect via OIDC discovery'"`
+	KeycloakPageSize         int    `kong:"default='500',env='KEYCLOAK_PAGE_SIZE',help='Number of groups requested per page from the Keycloak API, or 0 to request all groups at once'"`
+	KeycloakSubGroups        bool   `kong:"env='KEYCLOAK_SUBGROUPS',help='Recursively traverse Keycloak subgroups, so that nested Lagoon groups are included'"`
+}
+
+// validate the keycloak flags.
+func (f *keycloakFlags) validate() error {
+	if f.KeycloakBaseURL == "" {
+		return fmt.Errorf("missing flag: --keycloak-base-url")
+	}
+	if f.KeycloakClientSecret == "" && f.KeycloakClientSecretFile == "" {
+		return fmt.Errorf("missing flag: --keycloak-client-secret")
+	}
+	return nil
+}
+
+// newKeycloakClient initialises a Keycloak client from the flags.
+func (f *keycloakFlags) newKeycloakClient(
+	ctx context.Context,
+) (*keycloak.Client, error) {
+	clientSecret, err := secret.New(f.KeycloakClientSecret,
+		f.KeycloakClientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read keycloak client secret: %v", err)
+	}
+	k, err := keycloak.NewClientCredentialsClient(ctx, f.KeycloakBaseURL,
+		f.KeycloakRealm, f.KeycloakURLLayout, f.KeycloakClientID, clientSecret,
+		f.KeycloakPageSize, f.KeycloakSubGroups)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't init keycloak client: %v", err)
+	}
+	return k, nil
+}
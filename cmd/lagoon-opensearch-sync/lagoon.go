@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoonapi"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+)
+
+// lagoonFlags are the command line flags which configure the source of
+// Lagoon project and group data. They are embedded in each command which
+// requires Lagoon data.
+type lagoonFlags struct {
+	LagoonDataSource string `kong:"enum='db,api',default='db',env='LAGOON_DATA_SOURCE',help='Source of Lagoon project and group data: the Lagoon API DB, or the Lagoon GraphQL API'"`
+	// lagoon DB client fields
+	APIDBAddress      string `kong:"env='API_DB_ADDRESS',help='Lagoon API DB Address (host[:port])'"`
+	APIDBDatabase     string `kong:"default='infrastructure',env='API_DB_DATABASE',help='Lagoon API DB Database Name'"`
+	APIDBPassword     string `kong:"env='API_DB_PASSWORD',xor='apidb-password',help='Lagoon API DB Password'"`
+	APIDBPasswordFile string `kong:"type='existingfile',env='API_DB_PASSWORD_FILE',xor='apidb-password',help='Path to a file containing the Lagoon API DB Password. The file is reloaded when it changes'"`
+	APIDBUsername     string `kong:"default='api',env='API_DB_USERNAME',help='Lagoon API DB Username'"`
+	// lagoon API client fields
+	LagoonAPIURL           string        `kong:"name='lagoon-api-url',env='LAGOON_API_URL',help='Lagoon GraphQL API URL (e.g. https://api.example.com/graphql)'"`
+	LagoonAPIToken         string        `kong:"name='lagoon-api-token',env='LAGOON_API_TOKEN',xor='lagoon-api-token',help='Lagoon GraphQL API service token'"`
+	LagoonAPITokenFile     string        `kong:"name='lagoon-api-token-file',type='existingfile',env='LAGOON_API_TOKEN_FILE',xor='lagoon-api-token',help='Path to a file containing the Lagoon GraphQL API service token. The file is reloaded when it changes'"`
+	LagoonAPIClientTimeout time.Duration `kong:"default='30s',env='LAGOON_API_CLIENT_TIMEOUT',help='Lagoon GraphQL API HTTP client request timeout'"`
+}
+
+// validate the lagoon flags. The flags required depend on the data source.
+func (f *lagoonFlags) validate() error {
+	switch f.LagoonDataSource {
+	case "db":
+		if f.APIDBAddress == "" {
+			return fmt.Errorf("missing flag: --apidb-address")
+		}
+		if f.APIDBPassword == "" && f.APIDBPasswordFile == "" {
+			return fmt.Errorf("missing flag: --apidb-password")
+		}
+	case "api":
+		if f.LagoonAPIURL == "" {
+			return fmt.Errorf("missing flag: --lagoon-api-url")
+		}
+		if f.LagoonAPIToken == "" && f.LagoonAPITokenFile == "" {
+			return fmt.Errorf("missing flag: --lagoon-api-token")
+		}
+	}
+	return nil
+}
+
+// newLagoonClient initialises a client for the configured source of Lagoon
+// data.
+func (f *lagoonFlags) newLagoonClient(
+	ctx context.Context,
+) (sync.LagoonDBService, error) {
+	switch f.LagoonDataSource {
+	case "db":
+		dbConf := mysql.NewConfig()
+		dbConf.Addr = f.APIDBAddress
+		dbConf.DBName = f.APIDBDatabase
+		dbConf.Net = "tcp"
+		dbConf.User = f.APIDBUsername
+		password, err := secret.New(f.APIDBPassword, f.APIDBPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read lagoon DB password: %v", err)
+		}
+		l, err := lagoondb.NewClient(ctx, dbConf, password)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't init lagoon DBClient: %v", err)
+		}
+		return l, nil
+	case "api":
+		token, err := secret.New(f.LagoonAPIToken, f.LagoonAPITokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read lagoon API token: %v", err)
+		}
+		l, err := lagoonapi.NewClient(f.LagoonAPIURL, token,
+			f.LagoonAPIClientTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't init lagoon API client: %v", err)
+		}
+		return l, nil
+	default:
+		return nil, fmt.Errorf("unknown lagoon data source: %s",
+			f.LagoonDataSource)
+	}
+}
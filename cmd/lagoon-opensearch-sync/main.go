@@ -16,16 +16,20 @@ var (
 
 // CLI represents the command-line interface.
 type CLI struct {
-	Debug              bool                  `kong:"env='DEBUG',help='Enable debug logging'"`
-	Version            VersionCmd            `kong:"cmd,help='Print version information'"`
-	DumpProjects       DumpProjectsCmd       `kong:"cmd,help='Print Lagoon Projects JSON to standard out'"`
-	DumpGroups         DumpGroupsCmd         `kong:"cmd,help='Print Keycloak Groups JSON to standard out'"`
-	DumpRoles          DumpRolesCmd          `kong:"cmd,help='Print Opensearch Roles JSON to standard out'"`
-	DumpRolesmapping   DumpRolesmappingCmd   `kong:"cmd,help='Print Opensearch Rolesmapping JSON to standard out'"`
-	DumpTenants        DumpTenantsCmd        `kong:"cmd,help='Print Opensearch Tenants JSON to standard out'"`
-	DumpIndexTemplates DumpIndexTemplatesCmd `kong:"cmd,help='Print Opensearch Index Templates JSON to standard out'"`
-	DumpIndexPatterns  DumpIndexPatternsCmd  `kong:"cmd,help='Print Opensearch Index Patterns JSON to standard out'"`
-	Sync               SyncCmd               `kong:"cmd,default='1',help='Synchronise Opensearch configuration with Lagoon'"`
+	Debug                  bool                      `kong:"env='DEBUG',help='Enable debug logging'"`
+	Version                VersionCmd                `kong:"cmd,help='Print version information'"`
+	DumpProjects           DumpProjectsCmd           `kong:"cmd,help='Print Lagoon Projects JSON to standard out'"`
+	DumpGroups             DumpGroupsCmd             `kong:"cmd,help='Print Keycloak Groups JSON to standard out'"`
+	DumpRoles              DumpRolesCmd              `kong:"cmd,help='Print Opensearch Roles JSON to standard out'"`
+	DumpRolesmapping       DumpRolesmappingCmd       `kong:"cmd,help='Print Opensearch Rolesmapping JSON to standard out'"`
+	DumpTenants            DumpTenantsCmd            `kong:"cmd,help='Print Opensearch Tenants JSON to standard out'"`
+	DumpIndexTemplates     DumpIndexTemplatesCmd     `kong:"cmd,help='Print Opensearch Index Templates JSON to standard out'"`
+	DumpComponentTemplates DumpComponentTemplatesCmd `kong:"cmd,help='Print Opensearch Component Templates JSON to standard out'"`
+	DumpIngestPipelines    DumpIngestPipelinesCmd    `kong:"cmd,help='Print Opensearch Ingest Pipelines JSON to standard out'"`
+	DumpISMPolicies        DumpISMPoliciesCmd        `kong:"cmd,help='Print Opensearch ISM Policies JSON to standard out'"`
+	DumpIndexPatterns      DumpIndexPatternsCmd      `kong:"cmd,help='Print Opensearch Index Patterns JSON to standard out'"`
+	Report                 ReportCmd                 `kong:"cmd,help='Print reports on the Opensearch configuration'"`
+	Sync                   SyncCmd                   `kong:"cmd,default='1',help='Synchronise Opensearch configuration with Lagoon'"`
 }
 
 func main() {
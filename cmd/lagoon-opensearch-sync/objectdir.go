@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// objectFileExtensions are the file extensions of Opensearch object files.
+var objectFileExtensions = []string{".json", ".yaml", ".yml"}
+
+// decodeObject decodes the JSON or YAML Opensearch object body in data into
+// v. Unknown fields are rejected so that typos are not silently ignored.
+func decodeObject(data []byte, v any) error {
+	// YAMLToJSON passes JSON through unchanged, since JSON is valid YAML
+	buf, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("couldn't convert YAML to JSON: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// readObjectDir reads the Opensearch objects of the given kind in the
+// directory at the given path, keyed by name. Each file with a .json, .yaml,
+// or .yml extension contains the body of an object, which is decoded by
+// decode, and the object is named after the file without its extension.
+// Other files are ignored. A file named after an object for which isBuiltin
+// returns true is an error.
+func readObjectDir[T any](
+	dir string,
+	kind string,
+	isBuiltin func(string) bool,
+	decode func([]byte) (T, error),
+) (map[string]T, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %ss directory: %v", kind, err)
+	}
+	objects := map[string]T{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || !slices.Contains(objectFileExtensions, ext) {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if isBuiltin(name) {
+			return nil, fmt.Errorf("%s file %s conflicts with built-in %s %s",
+				kind, entry.Name(), kind, name)
+		}
+		if _, ok := objects[name]; ok {
+			return nil, fmt.Errorf("duplicate %s %s", kind, name)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read %s file: %v", kind, err)
+		}
+		object, err := decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s file %s: %v", kind, entry.Name(),
+				err)
+		}
+		objects[name] = object
+	}
+	return objects, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestReadObjectDir(t *testing.T) {
+	indexTemplate := "index_patterns: [custom-logs-*]\n"
+	ingestPipeline := `{"processors": [{"set": {"field": "a", "value": "b"}}]}`
+	var testCases = map[string]struct {
+		files       map[string]string
+		read        func(string) ([]string, error)
+		expect      []string
+		expectError bool
+	}{
+		"index templates": {
+			files: map[string]string{
+				"customlogs.yaml": indexTemplate,
+				"otherlogs.json":  `{"index_patterns": ["other-logs-*"]}`,
+				"README.md":       "ignored",
+			},
+			read:   readIndexTemplateNames,
+			expect: []string{"customlogs", "otherlogs"},
+		},
+		"built-in index template": {
+			files:       map[string]string{"routerlogs.yaml": indexTemplate},
+			read:        readIndexTemplateNames,
+			expectError: true,
+		},
+		"duplicate index template": {
+			files: map[string]string{
+				"customlogs.yaml": indexTemplate,
+				"customlogs.yml":  indexTemplate,
+			},
+			read:        readIndexTemplateNames,
+			expectError: true,
+		},
+		"ingest pipelines": {
+			files: map[string]string{
+				"custom-logs.json": ingestPipeline,
+				"README.md":        "ignored",
+			},
+			read:   readIngestPipelineIDs,
+			expect: []string{"custom-logs"},
+		},
+		"built-in ingest pipeline": {
+			files:       map[string]string{"lagoon-router-logs.json": ingestPipeline},
+			read:        readIngestPipelineIDs,
+			expectError: true,
+		},
+		"invalid ingest pipeline": {
+			files:       map[string]string{"custom-logs.json": `{"processors": []}`},
+			read:        readIngestPipelineIDs,
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			dir := tt.TempDir()
+			for file, data := range tc.files {
+				assert.NoError(tt,
+					os.WriteFile(filepath.Join(dir, file), []byte(data), 0600), file)
+			}
+			// directories are ignored, whatever their name
+			assert.NoError(tt, os.Mkdir(filepath.Join(dir, "subdir.json"), 0700),
+				"mkdir")
+			names, err := tc.read(dir)
+			if tc.expectError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expect, names, name)
+		})
+	}
+}
+
+// readIndexTemplateNames returns the sorted names of the index templates in
+// dir.
+func readIndexTemplateNames(dir string) ([]string, error) {
+	indexTemplates, err := readIndexTemplates(dir)
+	return slices.Sorted(maps.Keys(indexTemplates)), err
+}
+
+// readIngestPipelineIDs returns the sorted IDs of the ingest pipelines in
+// dir.
+func readIngestPipelineIDs(dir string) ([]string, error) {
+	ingestPipelines, err := readIngestPipelines(dir)
+	return slices.Sorted(maps.Keys(ingestPipelines)), err
+}
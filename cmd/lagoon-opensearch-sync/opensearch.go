@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sigv4"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/tlsconfig"
+	"go.uber.org/zap"
+)
+
+// opensearchFlags are the command line flags which configure the Opensearch
+// client. They are embedded in each command which connects to Opensearch.
+type opensearchFlags struct {
+	OpensearchUsername              string        `kong:"default='admin',env='OPENSEARCH_ADMIN_USERNAME',help='Opensearch admin user'"`
+	OpensearchPassword              string        `kong:"env='OPENSEARCH_ADMIN_PASSWORD',xor='opensearch-password',help='Opensearch admin password. Not required if a client certificate is given'"`
+	OpensearchPasswordFile          string        `kong:"type='existingfile',env='OPENSEARCH_ADMIN_PASSWORD_FILE',xor='opensearch-password',help='Path to a file containing the Opensearch admin password. The file is reloaded when it changes'"`
+	OpensearchBaseURL               string        `kong:"env='OPENSEARCH_BASE_URL',help='Opensearch Base URL'"`
+	OpensearchCACertificate         string        `kong:"env='OPENSEARCH_CA_CERTIFICATE',xor='opensearch-ca-certificate',help='Opensearch CA Certificate. May be a bundle of several PEM encoded certificates'"`
+	OpensearchCACertificateFile     string        `kong:"type='existingfile',env='OPENSEARCH_CA_CERTIFICATE_FILE',xor='opensearch-ca-certificate',help='Path to the Opensearch CA Certificate bundle in PEM format'"`
+	OpensearchCASystemPool          bool          `kong:"name='opensearch-ca-system-pool',env='OPENSEARCH_CA_SYSTEM_POOL',help='Trust the system CA certificates in addition to the Opensearch CA Certificate'"`
+	OpensearchInsecureSkipVerify    bool          `kong:"env='OPENSEARCH_INSECURE_SKIP_VERIFY',help='Disable Opensearch TLS certificate verification. Insecure, for local development only'"`
+	OpensearchServerName            string        `kong:"env='OPENSEARCH_SERVER_NAME',help='Override the host name used to verify the Opensearch TLS certificate'"`
+	OpensearchClientCertificate     string        `kong:"env='OPENSEARCH_CLIENT_CERTIFICATE',xor='opensearch-client-certificate',help='Opensearch client certificate in PEM format, used for TLS client authentication'"`
+	OpensearchClientCertificateFile string        `kong:"type='existingfile',env='OPENSEARCH_CLIENT_CERTIFICATE_FILE',xor='opensearch-client-certificate',help='Path to the Opensearch client certificate in PEM format'"`
+	OpensearchClientKey             string        `kong:"env='OPENSEARCH_CLIENT_KEY',xor='opensearch-client-key',help='Opensearch client private key in PEM format'"`
+	OpensearchClientKeyFile         string        `kong:"type='existingfile',env='OPENSEARCH_CLIENT_KEY_FILE',xor='opensearch-client-key',help='Path to the Opensearch client private key in PEM format'"`
+	OpensearchClientTimeout         time.Duration `kong:"default='30s',env='OPENSEARCH_CLIENT_TIMEOUT',help='Opensearch HTTP client request timeout'"`
+	OpensearchFlavour               string        `kong:"enum='auto,opensearch,opendistro',default='auto',env='OPENSEARCH_FLAVOUR',help='Opensearch cluster flavour, which determines the security API path prefix: opensearch, opendistro for Open Distro for Elasticsearch, or auto to detect from the cluster root endpoint'"`
+	OpensearchAuthMode              string        `kong:"enum='basic,sigv4',default='basic',env='OPENSEARCH_AUTH_MODE',help='Opensearch authentication mode: basic authentication and/or a client certificate, or AWS Signature Version 4 for Amazon OpenSearch Service'"`
+	SigV4Region                     string        `kong:"name='sigv4-region',env='AWS_REGION',help='AWS region of the Amazon OpenSearch Service domain'"`
+	SigV4Service                    string        `kong:"name='sigv4-service',enum='es,aoss',default='es',env='SIGV4_SERVICE',help='AWS service name used to sign requests: es for Amazon OpenSearch Service, or aoss for Amazon OpenSearch Serverless'"`
+}
+
+// Opensearch authentication modes.
+const (
+	authModeBasic = "basic"
+	authModeSigV4 = "sigv4"
+)
+
+// sigV4Services are the AWS services which requests may be signed for.
+var sigV4Services = []string{
+	sigv4.ServiceOpensearch,
+	sigv4.ServiceOpensearchServerless,
+}
+
+// newSigner returns an AWS Signature Version 4 request signer if the given
+// authentication mode requires one, and nil otherwise. Credentials are read
+// from the environment.
+func newSigner(authMode, region, service string) *sigv4.Signer {
+	if authMode != authModeSigV4 {
+		return nil
+	}
+	return sigv4.NewSigner(sigv4.DefaultCredentials(region), region, service)
+}
+
+// validate the opensearch flags.
+func (f *opensearchFlags) validate() error {
+	if f.OpensearchBaseURL == "" {
+		return fmt.Errorf("missing flag: --opensearch-base-url")
+	}
+	hasCert := f.OpensearchClientCertificate != "" ||
+		f.OpensearchClientCertificateFile != ""
+	hasKey := f.OpensearchClientKey != "" || f.OpensearchClientKeyFile != ""
+	if hasCert != hasKey {
+		return fmt.Errorf(
+			"opensearch client certificate and key must be specified together")
+	}
+	if f.OpensearchAuthMode == authModeSigV4 {
+		if f.SigV4Region == "" {
+			return fmt.Errorf("missing flag: --sigv4-region")
+		}
+		return nil
+	}
+	if f.OpensearchCACertificate == "" && f.OpensearchCACertificateFile == "" &&
+		!f.OpensearchCASystemPool && !f.OpensearchInsecureSkipVerify {
+		return fmt.Errorf("missing flag: --opensearch-ca-certificate")
+	}
+	hasPassword := f.OpensearchPassword != "" || f.OpensearchPasswordFile != ""
+	if !hasPassword && !hasCert {
+		return fmt.Errorf("missing flag: --opensearch-password")
+	}
+	return nil
+}
+
+// newTLSSource returns the TLS source containing the given PEM data, or the
+// contents of the given PEM files if the data is empty. PEM files are
+// reloaded when they change.
+func newTLSSource(
+	caCertificate,
+	caCertificateFile,
+	clientCertificate,
+	clientCertificateFile,
+	clientKey,
+	clientKeyFile string,
+) (tlsconfig.Source, error) {
+	ca, err := secret.New(caCertificate, caCertificateFile)
+	if err != nil {
+		return tlsconfig.Source{},
+			fmt.Errorf("couldn't read CA certificate: %v", err)
+	}
+	cert, err := secret.New(clientCertificate, clientCertificateFile)
+	if err != nil {
+		return tlsconfig.Source{},
+			fmt.Errorf("couldn't read client certificate: %v", err)
+	}
+	key, err := secret.New(clientKey, clientKeyFile)
+	if err != nil {
+		return tlsconfig.Source{},
+			fmt.Errorf("couldn't read client key: %v", err)
+	}
+	return tlsconfig.Source{
+		CACertificates:    ca,
+		ClientCertificate: cert,
+		ClientKey:         key,
+	}, nil
+}
+
+// tlsSource returns the Opensearch TLS source.
+func (f *opensearchFlags) tlsSource() (tlsconfig.Source, error) {
+	source, err := newTLSSource(
+		f.OpensearchCACertificate,
+		f.OpensearchCACertificateFile,
+		f.OpensearchClientCertificate,
+		f.OpensearchClientCertificateFile,
+		f.OpensearchClientKey,
+		f.OpensearchClientKeyFile,
+	)
+	if err != nil {
+		return tlsconfig.Source{}, err
+	}
+	source.SystemCertPool = f.OpensearchCASystemPool
+	source.InsecureSkipVerify = f.OpensearchInsecureSkipVerify
+	source.ServerName = f.OpensearchServerName
+	return source, nil
+}
+
+// password returns the Opensearch password, or nil if it is not set.
+func (f *opensearchFlags) password() (*secret.Value, error) {
+	password, err := secret.New(f.OpensearchPassword, f.OpensearchPasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read opensearch password: %v", err)
+	}
+	return password, nil
+}
+
+// newOpensearchTransport returns a transport which connects to Opensearch
+// using the TLS configuration from the given source.
+func newOpensearchTransport(
+	log *zap.Logger,
+	source tlsconfig.Source,
+) (*tlsconfig.Transport, error) {
+	transport, err := tlsconfig.NewTransport(log, source, &http.Transport{})
+	if err != nil {
+		return nil,
+			fmt.Errorf("couldn't construct opensearch TLS config: %v", err)
+	}
+	return transport, nil
+}
+
+// newOpensearchClient initialises an Opensearch client from the flags.
+func (f *opensearchFlags) newOpensearchClient(
+	log *zap.Logger,
+) (*opensearch.Client, error) {
+	source, err := f.tlsSource()
+	if err != nil {
+		return nil, err
+	}
+	password, err := f.password()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newOpensearchTransport(log, source)
+	if err != nil {
+		return nil, err
+	}
+	o, err := opensearch.NewClient(
+		log,
+		f.OpensearchBaseURL,
+		f.OpensearchUsername,
+		password,
+		transport,
+		newSigner(f.OpensearchAuthMode, f.SigV4Region, f.SigV4Service),
+		f.OpensearchFlavour,
+		f.OpensearchClientTimeout,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't init opensearch client: %v", err)
+	}
+	return o, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/report"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+// ReportCmd represents the `report` command.
+type ReportCmd struct {
+	Access ReportAccessCmd `kong:"cmd,help='Print which backend roles can read which Lagoon project logs'"`
+}
+
+// ReportAccessCmd represents the `report access` command.
+type ReportAccessCmd struct {
+	Format              string `kong:"enum='csv,json,markdown',default='csv',help='Report output format'"`
+	GroupProjectsSource string `kong:"enum='lagoon,keycloak,compare',default='lagoon',env='GROUP_PROJECTS_SOURCE',help='Source of Lagoon group project membership: the Lagoon data source, the lagoon-projects Keycloak group attribute used by older Lagoon versions, or compare to use Lagoon and log any disagreements with Keycloak'"`
+	// lagoon client fields
+	lagoonFlags `kong:"embed"`
+	// keycloak client fields
+	keycloakFlags `kong:"embed"`
+	// opensearch client fields
+	opensearchFlags `kong:"embed"`
+}
+
+// Validate the report access command flags.
+func (cmd *ReportAccessCmd) Validate() error {
+	if err := cmd.lagoonFlags.validate(); err != nil {
+		return err
+	}
+	if err := cmd.keycloakFlags.validate(); err != nil {
+		return err
+	}
+	return cmd.opensearchFlags.validate()
+}
+
+// Run the report access command.
+func (cmd *ReportAccessCmd) Run(log *zap.Logger) error {
+	// get main process context, which cancels on SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	// init lagoon client
+	l, err := cmd.newLagoonClient(ctx)
+	if err != nil {
+		return err
+	}
+	// init the keycloak client
+	kc, err := cmd.newKeycloakClient(ctx)
+	if err != nil {
+		return err
+	}
+	// select the source of group project membership
+	l, k, err := sync.WithGroupProjectsSource(log, l, kc,
+		cmd.GroupProjectsSource)
+	if err != nil {
+		return err
+	}
+	// init the opensearch client
+	o, err := cmd.newOpensearchClient(log)
+	if err != nil {
+		return err
+	}
+	// generate the report
+	entries, err := report.Access(ctx, log, l, k, o)
+	if err != nil {
+		return fmt.Errorf("couldn't generate access report: %v", err)
+	}
+	switch cmd.Format {
+	case "csv":
+		return report.WriteAccessCSV(os.Stdout, entries)
+	case "json":
+		return report.WriteAccessJSON(os.Stdout, entries)
+	case "markdown":
+		return report.WriteAccessMarkdown(os.Stdout, entries)
+	default:
+		return fmt.Errorf("unknown report format: %s", cmd.Format)
+	}
+}
@@ -2,15 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
-	"github.com/uselagoon/lagoon-opensearch-sync/internal/dashboards"
-	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
-	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
 	"go.uber.org/zap"
@@ -18,29 +18,280 @@ import (
 
 // SyncCmd represents the `sync` command.
 type SyncCmd struct {
-	DryRun                      bool          `kong:"env='DRY_RUN',help='Print actions that will be taken but do not persist any changes to Opensearch'"`
-	Once                        bool          `kong:"default='false',help='Run the sync once instead of forever at the given period'"`
-	Period                      time.Duration `kong:"default='8m',help='Period between synchronisation polls'"`
-	Objects                     []string      `kong:"enum='tenants,roles,rolesmapping,indexpatterns,indextemplates',default='tenants,roles,rolesmapping,indexpatterns,indextemplates',help='Opensearch objects which will be synchronized'"`
-	LegacyIndexPatternDelimiter bool          `kong:"default='false',help='Use the legacy -* index pattern delimiter instead of -_-*'"`
-	// lagoon DB client fields
-	APIDBAddress  string `kong:"required,env='API_DB_ADDRESS',help='Lagoon API DB Address (host[:port])'"`
-	APIDBDatabase string `kong:"default='infrastructure',env='API_DB_DATABASE',help='Lagoon API DB Database Name'"`
-	APIDBPassword string `kong:"required,env='API_DB_PASSWORD',help='Lagoon API DB Password'"`
-	APIDBUsername string `kong:"default='api',env='API_DB_USERNAME',help='Lagoon API DB Username'"`
+	DryRun                       bool           `kong:"env='DRY_RUN',help='Print actions that will be taken but do not persist any changes to Opensearch'"`
+	DryRunDiff                   string         `kong:"enum='none,jsonpatch,unified',default='none',env='DRY_RUN_DIFF',help='In dry run mode, print the changes to each Opensearch object to standard out as a JSON Patch or unified diff'"`
+	Once                         bool           `kong:"default='false',help='Run the sync once instead of forever at the given period'"`
+	Period                       time.Duration  `kong:"default='8m',help='Period between synchronisation polls'"`
+	Objects                      []string       `kong:"enum='tenants,roles,rolesmapping,indexpatterns,componenttemplates,ingestpipelines,indextemplates,ismpolicies',default='tenants,roles,rolesmapping,indexpatterns,indextemplates',help='Opensearch objects which will be synchronized. componenttemplates, ingestpipelines, and ismpolicies are not synchronized by default'"`
+	LegacyIndexPatternDelimiter  bool           `kong:"default='false',help='Use the legacy -* index pattern delimiter instead of -_-*'"`
+	Organizations                bool           `kong:"env='ORGANIZATIONS',help='Synchronise tenants, roles, rolesmapping, and index patterns for Lagoon organizations'"`
+	DevelopmentOnlyGroups        []string       `kong:"env='DEVELOPMENT_ONLY_GROUPS',help='Lagoon groups whose roles only grant access to the logs of development environments'"`
+	DevelopmentOnlyGroupRoles    []string       `kong:"env='DEVELOPMENT_ONLY_GROUP_ROLES',help='Lagoon group roles whose roles only grant access to the logs of development environments'"`
+	GroupRoles                   string         `kong:"type='existingfile',env='GROUP_ROLES_FILE',help='Path to a JSON file mapping Lagoon group roles to permission sets. If set, a role is generated for each group role of each Lagoon group'"`
+	BuiltinIndexTemplates        []string       `kong:"enum='applicationlogs,containerlogs,lagoonlogs,routerlogs',default='routerlogs',env='BUILTIN_INDEX_TEMPLATES',help='Built-in index templates which will be synchronized by the indextemplates object. applicationlogs, containerlogs, and lagoonlogs are not synchronized by default: enabling one overrides any other index template for its log family with a lower priority, and changes the mappings and settings of indices created after the next rollover. A Lagoon-owned built-in index template which is not listed is deleted'"`
+	BuiltinIndexTemplatePriority int            `kong:"default='50',env='BUILTIN_INDEX_TEMPLATE_PRIORITY',help='Priority of the built-in index templates. Opensearch applies only the highest priority index template which matches a new index, so set this below the priority of your own index templates for Lagoon logs to defer to them'"`
+	IndexTemplatesDir            string         `kong:"type='existingdir',env='INDEX_TEMPLATES_DIR',help='Path to a directory of JSON or YAML index template files. Each file is synchronised as a Lagoon-owned index template named after the file'"`
+	IngestPipelinesDir           string         `kong:"type='existingdir',env='INGEST_PIPELINES_DIR',help='Path to a directory of JSON or YAML ingest pipeline files. Each file is synchronised as a Lagoon-owned ingest pipeline with the ID of the file name'"`
+	ISMRetentionDays             map[string]int `kong:"mapsep=',',env='ISM_RETENTION_DAYS',help='Number of days to retain each Lagoon log family by ISM policies, e.g. router-logs=14,application-logs=30. Used by the ismpolicies object'"`
+	ISMProjectRetentionKey       string         `kong:"env='ISM_PROJECT_RETENTION_KEY',help='Key of the Lagoon project metadata which overrides the number of days to retain every log family of the project'"`
+	Clusters                     string         `kong:"type='existingfile',env='OPENSEARCH_CLUSTERS_FILE',help='Path to a JSON file listing the Opensearch clusters to synchronise. Overrides the single cluster Opensearch and Opensearch Dashboards flags'"`
+	MetricsAddress               string         `kong:"env='METRICS_ADDRESS',help='Serve Prometheus metrics on the given address (host:port)'"`
+	GroupProjectsSource          string         `kong:"enum='lagoon,keycloak,compare',default='lagoon',env='GROUP_PROJECTS_SOURCE',help='Source of Lagoon group project membership: the Lagoon data source, the lagoon-projects Keycloak group attribute used by older Lagoon versions, or compare to use Lagoon and log any disagreements with Keycloak'"`
+	// lagoon client fields
+	lagoonFlags `kong:"embed"`
 	// keycloak client fields
-	KeycloakClientID     string `kong:"default='lagoon-opensearch-sync',env='KEYCLOAK_CLIENT_ID',help='Keycloak OAuth2 Client ID'"`
-	KeycloakClientSecret string `kong:"required,env='KEYCLOAK_CLIENT_SECRET',help='Keycloak OAuth2 Client Secret'"`
-	KeycloakBaseURL      string `kong:"required,env='KEYCLOAK_BASE_URL',help='Keycloak Base URL'"`
+	keycloakFlags `kong:"embed"`
 	// opensearch client fields
-	OpensearchUsername      string        `kong:"default='admin',env='OPENSEARCH_ADMIN_USERNAME',help='Opensearch admin user'"`
-	OpensearchPassword      string        `kong:"required,env='OPENSEARCH_ADMIN_PASSWORD',help='Opensearch admin password'"`
-	OpensearchBaseURL       string        `kong:"required,env='OPENSEARCH_BASE_URL',help='Opensearch Base URL'"`
-	OpensearchCACertificate string        `kong:"required,env='OPENSEARCH_CA_CERTIFICATE',help='Opensearch CA Certificate'"`
-	OpensearchClientTimeout time.Duration `kong:"default='30s',env='OPENSEARCH_CLIENT_TIMEOUT',help='Opensearch HTTP client request timeout'"`
+	opensearchFlags `kong:"embed"`
 	// dashboards client fields
-	OpensearchDashboardsBaseURL       string        `kong:"required,env='OPENSEARCH_DASHBOARDS_BASE_URL',help='Opensearch Dashboards Base URL'"`
-	OpensearchDashboardsClientTimeout time.Duration `kong:"default='30s',env='OPENSEARCH_DASHBOARDS_CLIENT_TIMEOUT',help='Opensearch Dashboards HTTP client request timeout'"`
+	dashboardsFlags `kong:"embed"`
+}
+
+// Validate the sync command flags. The single cluster Opensearch and
+// Opensearch Dashboards flags are only required if a clusters file is not
+// given.
+func (cmd *SyncCmd) Validate() error {
+	if err := cmd.lagoonFlags.validate(); err != nil {
+		return err
+	}
+	if err := cmd.keycloakFlags.validate(); err != nil {
+		return err
+	}
+	retention := sync.ISMRetention{Days: cmd.ISMRetentionDays}
+	if err := retention.Validate(); err != nil {
+		return fmt.Errorf("invalid --ism-retention-days: %v", err)
+	}
+	if cmd.BuiltinIndexTemplatePriority < 0 {
+		return fmt.Errorf("invalid --builtin-index-template-priority: %d",
+			cmd.BuiltinIndexTemplatePriority)
+	}
+	if cmd.Clusters != "" {
+		return cmd.validateClustersFlags()
+	}
+	if err := cmd.opensearchFlags.validate(); err != nil {
+		return err
+	}
+	if cmd.OpensearchDashboardsBaseURL == "" {
+		return fmt.Errorf("missing flag: --opensearch-dashboards-base-url")
+	}
+	return nil
+}
+
+// validateClustersFlags checks that no client certificate flags are given
+// with a clusters file. Client certificates are not used as defaults for the
+// clusters in the clusters file, so they would otherwise be silently ignored.
+func (cmd *SyncCmd) validateClustersFlags() error {
+	for _, flag := range []struct {
+		name  string
+		value string
+	}{
+		{"opensearch-client-certificate", cmd.OpensearchClientCertificate},
+		{"opensearch-client-certificate-file", cmd.OpensearchClientCertificateFile},
+		{"opensearch-client-key", cmd.OpensearchClientKey},
+		{"opensearch-client-key-file", cmd.OpensearchClientKeyFile},
+		{"opensearch-dashboards-client-certificate",
+			cmd.OpensearchDashboardsClientCertificate},
+		{"opensearch-dashboards-client-certificate-file",
+			cmd.OpensearchDashboardsClientCertificateFile},
+		{"opensearch-dashboards-client-key", cmd.OpensearchDashboardsClientKey},
+		{"opensearch-dashboards-client-key-file",
+			cmd.OpensearchDashboardsClientKeyFile},
+	} {
+		if flag.value != "" {
+			return fmt.Errorf("--%s can't be used with --clusters: "+
+				"configure client certificates in the clusters file instead",
+				flag.name)
+		}
+	}
+	return nil
+}
+
+// clusterConfigs returns the configuration of each Opensearch cluster which
+// will be synchronised. If a clusters file is not given, a single implicit
+// cluster named "default" is configured from the command line flags.
+func (cmd *SyncCmd) clusterConfigs() ([]clusterConfig, error) {
+	var groupRoles map[string]sync.GroupRolePermissions
+	if cmd.GroupRoles != "" {
+		var err error
+		groupRoles, err = readGroupRoles(cmd.GroupRoles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var indexTemplates map[string]opensearch.IndexTemplate
+	if cmd.IndexTemplatesDir != "" {
+		var err error
+		indexTemplates, err = readIndexTemplates(cmd.IndexTemplatesDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var ingestPipelines map[string]opensearch.IngestPipeline
+	if cmd.IngestPipelinesDir != "" {
+		var err error
+		ingestPipelines, err = readIngestPipelines(cmd.IngestPipelinesDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cmd.Clusters == "" {
+		err := sync.ValidateDevelopmentOnlyGroupRoles(groupRoles,
+			cmd.DevelopmentOnlyGroupRoles)
+		if err != nil {
+			return nil, fmt.Errorf("invalid development-only group roles: %v", err)
+		}
+		password, err := cmd.opensearchFlags.password()
+		if err != nil {
+			return nil, err
+		}
+		opensearchTLS, err := cmd.opensearchFlags.tlsSource()
+		if err != nil {
+			return nil, err
+		}
+		dashboardsTLS, err := cmd.dashboardsFlags.tlsSource()
+		if err != nil {
+			return nil, err
+		}
+		return []clusterConfig{{
+			Name:                         "default",
+			OpensearchBaseURL:            cmd.OpensearchBaseURL,
+			OpensearchUsername:           cmd.OpensearchUsername,
+			OpensearchFlavour:            cmd.OpensearchFlavour,
+			OpensearchAuthMode:           cmd.OpensearchAuthMode,
+			SigV4Region:                  cmd.SigV4Region,
+			SigV4Service:                 cmd.SigV4Service,
+			OpensearchDashboardsBaseURL:  cmd.OpensearchDashboardsBaseURL,
+			Objects:                      cmd.Objects,
+			LegacyIndexPatternDelimiter:  &cmd.LegacyIndexPatternDelimiter,
+			Organizations:                &cmd.Organizations,
+			DevelopmentOnlyGroups:        cmd.DevelopmentOnlyGroups,
+			DevelopmentOnlyGroupRoles:    cmd.DevelopmentOnlyGroupRoles,
+			GroupRoles:                   groupRoles,
+			BuiltinIndexTemplates:        cmd.BuiltinIndexTemplates,
+			BuiltinIndexTemplatePriority: &cmd.BuiltinIndexTemplatePriority,
+			indexTemplates:               indexTemplates,
+			ingestPipelines:              ingestPipelines,
+			ISMRetentionDays:             cmd.ISMRetentionDays,
+			ismProjectRetentionKey:       cmd.ISMProjectRetentionKey,
+			implicit:                     true,
+			opensearchPassword:           password,
+			opensearchTLS:                opensearchTLS,
+			dashboardsTLS:                dashboardsTLS,
+		}}, nil
+	}
+	clusters, err := readClusterConfigs(cmd.Clusters)
+	if err != nil {
+		return nil, err
+	}
+	for i := range clusters {
+		if clusters[i].OpensearchUsername == "" {
+			clusters[i].OpensearchUsername = cmd.OpensearchUsername
+		}
+		if clusters[i].Objects == nil {
+			clusters[i].Objects = cmd.Objects
+		}
+		if clusters[i].LegacyIndexPatternDelimiter == nil {
+			clusters[i].LegacyIndexPatternDelimiter =
+				&cmd.LegacyIndexPatternDelimiter
+		}
+		if clusters[i].Organizations == nil {
+			clusters[i].Organizations = &cmd.Organizations
+		}
+		if clusters[i].DevelopmentOnlyGroups == nil {
+			clusters[i].DevelopmentOnlyGroups = cmd.DevelopmentOnlyGroups
+		}
+		if clusters[i].DevelopmentOnlyGroupRoles == nil {
+			clusters[i].DevelopmentOnlyGroupRoles = cmd.DevelopmentOnlyGroupRoles
+		}
+		if clusters[i].GroupRoles == nil {
+			clusters[i].GroupRoles = groupRoles
+		}
+		if clusters[i].BuiltinIndexTemplates == nil {
+			clusters[i].BuiltinIndexTemplates = cmd.BuiltinIndexTemplates
+		}
+		if clusters[i].BuiltinIndexTemplatePriority == nil {
+			clusters[i].BuiltinIndexTemplatePriority =
+				&cmd.BuiltinIndexTemplatePriority
+		}
+		if clusters[i].ISMRetentionDays == nil {
+			clusters[i].ISMRetentionDays = cmd.ISMRetentionDays
+		}
+		clusters[i].ismProjectRetentionKey = cmd.ISMProjectRetentionKey
+		if clusters[i].OpensearchCASystemPool == nil {
+			clusters[i].OpensearchCASystemPool = &cmd.OpensearchCASystemPool
+		}
+		if clusters[i].OpensearchInsecureSkipVerify == nil {
+			clusters[i].OpensearchInsecureSkipVerify =
+				&cmd.OpensearchInsecureSkipVerify
+		}
+		if clusters[i].OpensearchDashboardsCASystemPool == nil {
+			clusters[i].OpensearchDashboardsCASystemPool =
+				&cmd.OpensearchDashboardsCASystemPool
+		}
+		if clusters[i].OpensearchDashboardsInsecureSkipVerify == nil {
+			clusters[i].OpensearchDashboardsInsecureSkipVerify =
+				&cmd.OpensearchDashboardsInsecureSkipVerify
+		}
+		if clusters[i].OpensearchFlavour == "" {
+			clusters[i].OpensearchFlavour = cmd.OpensearchFlavour
+		}
+		if clusters[i].OpensearchAuthMode == "" {
+			clusters[i].OpensearchAuthMode = cmd.OpensearchAuthMode
+		}
+		if clusters[i].SigV4Region == "" {
+			clusters[i].SigV4Region = cmd.SigV4Region
+		}
+		if clusters[i].SigV4Service == "" {
+			clusters[i].SigV4Service = cmd.SigV4Service
+		}
+		if err = clusters[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid cluster %s: %v", clusters[i].Name, err)
+		}
+		if err = clusters[i].resolve(); err != nil {
+			return nil, fmt.Errorf("invalid cluster %s: %v", clusters[i].Name, err)
+		}
+		clusters[i].indexTemplates = indexTemplates
+		if clusters[i].IndexTemplatesDir != "" {
+			clusters[i].indexTemplates, err =
+				readIndexTemplates(clusters[i].IndexTemplatesDir)
+			if err != nil {
+				return nil,
+					fmt.Errorf("invalid cluster %s: %v", clusters[i].Name, err)
+			}
+		}
+		clusters[i].ingestPipelines = ingestPipelines
+		if clusters[i].IngestPipelinesDir != "" {
+			clusters[i].ingestPipelines, err =
+				readIngestPipelines(clusters[i].IngestPipelinesDir)
+			if err != nil {
+				return nil,
+					fmt.Errorf("invalid cluster %s: %v", clusters[i].Name, err)
+			}
+		}
+	}
+	return clusters, nil
+}
+
+// serveMetrics serves Prometheus metrics on the given address until the
+// context is cancelled.
+func serveMetrics(ctx context.Context, log *zap.Logger, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Warn("couldn't shut down metrics server", zap.Error(err))
+		}
+	}()
+	err := srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("couldn't serve metrics", zap.Error(err))
+	}
 }
 
 // Run the sync command.
@@ -48,50 +299,52 @@ func (cmd *SyncCmd) Run(log *zap.Logger) error {
 	// get main process context, which cancels on SIGTERM
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
 	defer stop()
-	// init lagoon DB client
-	dbConf := mysql.NewConfig()
-	dbConf.Addr = cmd.APIDBAddress
-	dbConf.DBName = cmd.APIDBDatabase
-	dbConf.Net = "tcp"
-	dbConf.Passwd = cmd.APIDBPassword
-	dbConf.User = cmd.APIDBUsername
-	l, err := lagoondb.NewClient(ctx, dbConf.FormatDSN())
+	// read the opensearch cluster configuration
+	clusters, err := cmd.clusterConfigs()
 	if err != nil {
-		return fmt.Errorf("couldn't init lagoon DBClient: %v", err)
+		return err
 	}
-	// init the keycloak client
-	k, err := keycloak.NewClientCredentialsClient(ctx, cmd.KeycloakBaseURL,
-		cmd.KeycloakClientID,
-		cmd.KeycloakClientSecret)
+	// init lagoon client
+	l, err := cmd.newLagoonClient(ctx)
 	if err != nil {
-		return fmt.Errorf("couldn't init keycloak client: %v", err)
-	}
-	// init the opensearch client
-	o, err := opensearch.NewClient(
-		log,
-		cmd.OpensearchBaseURL,
-		cmd.OpensearchUsername,
-		cmd.OpensearchPassword,
-		cmd.OpensearchCACertificate,
-		cmd.OpensearchClientTimeout,
-	)
+		return err
+	}
+	// init the keycloak client
+	kc, err := cmd.newKeycloakClient(ctx)
 	if err != nil {
-		return fmt.Errorf("couldn't init opensearch client: %v", err)
-	}
-	// init the opensearch dashboards client
-	d, err := dashboards.NewClient(
-		cmd.OpensearchDashboardsBaseURL,
-		cmd.OpensearchUsername,
-		cmd.OpensearchPassword,
-		cmd.OpensearchDashboardsClientTimeout,
-	)
+		return err
+	}
+	// select the source of group project membership
+	l, k, err := sync.WithGroupProjectsSource(log, l, kc,
+		cmd.GroupProjectsSource)
 	if err != nil {
-		return fmt.Errorf("couldn't init opensearch client: %v", err)
+		return err
+	}
+	// init the opensearch and opensearch dashboards clients
+	var targets []sync.Target
+	for i := range clusters {
+		target, err := newTarget(log, &clusters[i], cmd.OpensearchClientTimeout,
+			cmd.OpensearchDashboardsClientTimeout)
+		if err != nil {
+			return fmt.Errorf("couldn't init cluster %s: %v", clusters[i].Name, err)
+		}
+		targets = append(targets, *target)
+	}
+	// start the metrics server
+	if cmd.MetricsAddress != "" {
+		go serveMetrics(ctx, log, cmd.MetricsAddress)
+	}
+	// init the dry run diff writer
+	var diff *sync.DiffWriter
+	if cmd.DryRun && cmd.DryRunDiff != "none" {
+		diff, err = sync.NewDiffWriter(os.Stdout, cmd.DryRunDiff)
+		if err != nil {
+			return fmt.Errorf("couldn't init dry run diff writer: %v", err)
+		}
 	}
 	// run sync immediately
 	log.Debug("Starting sync")
-	err = sync.Sync(ctx, log, l, k, o, d, cmd.DryRun, cmd.Objects,
-		cmd.LegacyIndexPatternDelimiter)
+	err = sync.Sync(ctx, log, l, k, targets, cmd.DryRun, diff)
 	if err != nil {
 		return err
 	}
@@ -107,8 +360,7 @@ func (cmd *SyncCmd) Run(log *zap.Logger) error {
 			return nil
 		case <-ticker.C:
 			log.Debug("Starting sync")
-			err = sync.Sync(ctx, log, l, k, o, d, cmd.DryRun, cmd.Objects,
-				cmd.LegacyIndexPatternDelimiter)
+			err = sync.Sync(ctx, log, l, k, targets, cmd.DryRun, diff)
 			if err != nil {
 				return err
 			}
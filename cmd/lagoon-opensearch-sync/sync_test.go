@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestClusterConfigsIndexTemplates(t *testing.T) {
+	var testCases = map[string]struct {
+		clusters string
+	}{
+		"single cluster": {},
+		"clusters file":  {clusters: "testdata/clusters.json"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			cmd := SyncCmd{
+				Objects:           []string{"indextemplates"},
+				IndexTemplatesDir: "testdata/indextemplates",
+				Clusters:          tc.clusters,
+				opensearchFlags: opensearchFlags{
+					OpensearchBaseURL:            "https://opensearch:9200",
+					OpensearchPassword:           "password",
+					OpensearchInsecureSkipVerify: true,
+					OpensearchFlavour:            "auto",
+					OpensearchAuthMode:           authModeBasic,
+				},
+				dashboardsFlags: dashboardsFlags{
+					OpensearchDashboardsBaseURL: "http://dashboards:5601",
+				},
+			}
+			clusters, err := cmd.clusterConfigs()
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, 1, len(clusters), name)
+			names := slices.Sorted(maps.Keys(clusters[0].indexTemplates))
+			assert.Equal(tt, []string{"customlogs"}, names, name)
+		})
+	}
+}
+
+func TestSyncCmdValidateClusters(t *testing.T) {
+	var testCases = map[string]struct {
+		opensearchFlags opensearchFlags
+		dashboardsFlags dashboardsFlags
+		expectError     bool
+	}{
+		"no client certificate": {},
+		"opensearch client certificate": {
+			opensearchFlags: opensearchFlags{
+				OpensearchClientCertificateFile: "testdata/client.crt",
+				OpensearchClientKeyFile:         "testdata/client.key",
+			},
+			expectError: true,
+		},
+		"dashboards client key": {
+			dashboardsFlags: dashboardsFlags{
+				OpensearchDashboardsClientKey: "key",
+			},
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			cmd := SyncCmd{
+				Clusters: "testdata/clusters.json",
+				lagoonFlags: lagoonFlags{
+					LagoonDataSource: "db",
+					APIDBAddress:     "mariadb:3306",
+					APIDBPassword:    "password",
+				},
+				keycloakFlags: keycloakFlags{
+					KeycloakBaseURL:      "https://keycloak",
+					KeycloakClientSecret: "secret",
+				},
+				opensearchFlags: tc.opensearchFlags,
+				dashboardsFlags: tc.dashboardsFlags,
+			}
+			err := cmd.Validate()
+			if tc.expectError {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
+
+func TestOpensearchFlagsValidate(t *testing.T) {
+	var testCases = map[string]struct {
+		input       opensearchFlags
+		expectError bool
+	}{
+		"basic": {
+			input: opensearchFlags{
+				OpensearchBaseURL:      "https://opensearch:9200",
+				OpensearchPassword:     "password",
+				OpensearchCASystemPool: true,
+				OpensearchAuthMode:     authModeBasic,
+			},
+		},
+		"basic client certificate without key": {
+			input: opensearchFlags{
+				OpensearchBaseURL:           "https://opensearch:9200",
+				OpensearchPassword:          "password",
+				OpensearchCASystemPool:      true,
+				OpensearchClientCertificate: "cert",
+				OpensearchAuthMode:          authModeBasic,
+			},
+			expectError: true,
+		},
+		"sigv4": {
+			input: opensearchFlags{
+				OpensearchBaseURL:  "https://opensearch:9200",
+				OpensearchAuthMode: authModeSigV4,
+				SigV4Region:        "us-east-1",
+			},
+		},
+		"sigv4 client key without certificate": {
+			input: opensearchFlags{
+				OpensearchBaseURL:   "https://opensearch:9200",
+				OpensearchClientKey: "key",
+				OpensearchAuthMode:  authModeSigV4,
+				SigV4Region:         "us-east-1",
+			},
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			err := tc.input.validate()
+			if tc.expectError {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
+
+func TestClusterConfigsCACertificateFile(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	assert.NoError(t, os.WriteFile(caFile, []byte("ca"), 0600), "write CA")
+	clustersFile := filepath.Join(dir, "clusters.json")
+	clustersJSON, err := json.Marshal([]map[string]any{{
+		"name":                        "cluster-a",
+		"opensearchBaseURL":           "https://opensearch:9200",
+		"opensearchPassword":          "password",
+		"opensearchCACertificateFile": caFile,
+		"opensearchDashboardsBaseURL": "http://dashboards:5601",
+	}})
+	assert.NoError(t, err, "marshal clusters")
+	assert.NoError(t, os.WriteFile(clustersFile, clustersJSON, 0600),
+		"write clusters")
+	cmd := SyncCmd{
+		Clusters: clustersFile,
+		opensearchFlags: opensearchFlags{
+			OpensearchFlavour:  "auto",
+			OpensearchAuthMode: authModeBasic,
+		},
+	}
+	clusters, err := cmd.clusterConfigs()
+	assert.NoError(t, err, "clusterConfigs")
+	ca, err := clusters[0].opensearchTLS.CACertificates.Get()
+	assert.NoError(t, err, "CA certificates")
+	assert.Equal(t, "ca", ca, "CA certificates")
+}
+
+func TestClusterConfigsSecretFiles(t *testing.T) {
+	var testCases = map[string]struct {
+		cluster     map[string]any
+		expectError bool
+	}{
+		"password file": {
+			cluster: map[string]any{"opensearchPasswordFile": "password"},
+		},
+		"password and password file": {
+			cluster: map[string]any{
+				"opensearchPassword":     "inline",
+				"opensearchPasswordFile": "password",
+			},
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			dir := tt.TempDir()
+			passwordFile := filepath.Join(dir, "password")
+			assert.NoError(tt, os.WriteFile(passwordFile, []byte("old\n"), 0600),
+				"write password")
+			cluster := map[string]any{
+				"name":                         "cluster-a",
+				"opensearchBaseURL":            "https://opensearch:9200",
+				"opensearchInsecureSkipVerify": true,
+				"opensearchDashboardsBaseURL":  "http://dashboards:5601",
+			}
+			for k, v := range tc.cluster {
+				if v == "password" {
+					v = passwordFile
+				}
+				cluster[k] = v
+			}
+			clustersFile := filepath.Join(dir, "clusters.json")
+			clustersJSON, err := json.Marshal([]map[string]any{cluster})
+			assert.NoError(tt, err, "marshal clusters")
+			assert.NoError(tt, os.WriteFile(clustersFile, clustersJSON, 0600),
+				"write clusters")
+			cmd := SyncCmd{
+				Clusters: clustersFile,
+				opensearchFlags: opensearchFlags{
+					OpensearchFlavour:  "auto",
+					OpensearchAuthMode: authModeBasic,
+				},
+			}
+			clusters, err := cmd.clusterConfigs()
+			if tc.expectError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			password, err := clusters[0].opensearchPassword.Get()
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, "old", password, name)
+			assert.NoError(tt, os.WriteFile(passwordFile, []byte("rotated\n"), 0600),
+				"write rotated password")
+			password, err = clusters[0].opensearchPassword.Get()
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, "rotated", password, name)
+		})
+	}
+}
+
+func TestClusterConfigsBuiltinIndexTemplates(t *testing.T) {
+	var testCases = map[string]struct {
+		cluster        map[string]any
+		expectNames    []string
+		expectPriority int
+		expectError    bool
+	}{
+		"flag defaults": {
+			cluster:        map[string]any{},
+			expectNames:    []string{"routerlogs"},
+			expectPriority: 50,
+		},
+		"cluster override": {
+			cluster: map[string]any{
+				"builtinIndexTemplates":        []string{"lagoonlogs", "routerlogs"},
+				"builtinIndexTemplatePriority": 10,
+			},
+			expectNames:    []string{"lagoonlogs", "routerlogs"},
+			expectPriority: 10,
+		},
+		"unknown built-in index template": {
+			cluster: map[string]any{
+				"builtinIndexTemplates": []string{"customlogs"},
+			},
+			expectError: true,
+		},
+		"negative priority": {
+			cluster: map[string]any{
+				"builtinIndexTemplatePriority": -1,
+			},
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			cluster := map[string]any{
+				"name":                         "cluster-a",
+				"opensearchBaseURL":            "https://opensearch:9200",
+				"opensearchPassword":           "password",
+				"opensearchInsecureSkipVerify": true,
+				"opensearchDashboardsBaseURL":  "http://dashboards:5601",
+			}
+			maps.Copy(cluster, tc.cluster)
+			clustersJSON, err := json.Marshal([]map[string]any{cluster})
+			assert.NoError(tt, err, "marshal clusters")
+			clustersFile := filepath.Join(tt.TempDir(), "clusters.json")
+			assert.NoError(tt, os.WriteFile(clustersFile, clustersJSON, 0600),
+				"write clusters")
+			cmd := SyncCmd{
+				Clusters:                     clustersFile,
+				BuiltinIndexTemplates:        []string{"routerlogs"},
+				BuiltinIndexTemplatePriority: 50,
+				opensearchFlags: opensearchFlags{
+					OpensearchFlavour:  "auto",
+					OpensearchAuthMode: authModeBasic,
+				},
+			}
+			clusters, err := cmd.clusterConfigs()
+			if tc.expectError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectNames, clusters[0].BuiltinIndexTemplates, name)
+			assert.Equal(tt, tc.expectPriority,
+				*clusters[0].BuiltinIndexTemplatePriority, name)
+		})
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sigv4"
 )
 
 // Client is an Opensearch Dashboards client.
@@ -14,11 +17,15 @@ type Client struct {
 	httpClient *http.Client
 }
 
-// NewClient creates a new Opensearch Dashboards client.
+// NewClient creates a new Opensearch Dashboards client. The transport is
+// usually a tlsconfig.Transport. If signer is not nil, requests are signed with
+// AWS Signature Version 4 instead of using basic authentication.
 func NewClient(
 	baseURL,
-	username,
-	password string,
+	username string,
+	password *secret.Value,
+	transport http.RoundTripper,
+	signer *sigv4.Signer,
 	timeout time.Duration,
 ) (*Client, error) {
 	// parse URL
@@ -29,6 +36,6 @@ func NewClient(
 	// construct client
 	return &Client{
 		baseURL:    u,
-		httpClient: httpClient(username, password, timeout),
+		httpClient: httpClient(username, password, transport, signer, timeout),
 	}, nil
 }
@@ -1,36 +1,58 @@
 package dashboards
 
 import (
+	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sigv4"
 )
 
 // AuthenticatedRoundTripper implements the http.RoundTripper interface
 type AuthenticatedRoundTripper struct {
-	username string
-	password string
+	roundTripper http.RoundTripper
+	username     string
+	password     *secret.Value
 }
 
 // RoundTrip sets the basic authentication header and then handles the request
-// using the http.DefaultTransport.
+// using the configured transport. The password is loaded on each request, so
+// that a rotated password is used without restarting.
 func (art *AuthenticatedRoundTripper) RoundTrip(
 	req *http.Request,
 ) (*http.Response, error) {
-	req.SetBasicAuth(art.username, art.password)
-	return http.DefaultTransport.RoundTrip(req)
+	password, err := art.password.Get()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load password: %v", err)
+	}
+	req.SetBasicAuth(art.username, password)
+	return art.roundTripper.RoundTrip(req)
 }
 
+// httpClient constructs an http.Client using the given transport. If a signer
+// is given, requests are signed with AWS Signature Version 4 instead of using
+// basic authentication.
 func httpClient(
-	username,
-	password string,
+	username string,
+	password *secret.Value,
+	transport http.RoundTripper,
+	signer *sigv4.Signer,
 	timeout time.Duration,
 ) *http.Client {
+	if signer != nil {
+		return &http.Client{
+			Timeout:   timeout,
+			Transport: sigv4.NewRoundTripper(transport, signer),
+		}
+	}
 	// construct http.Client with automatic basic auth
 	return &http.Client{
 		Timeout: timeout,
 		Transport: &AuthenticatedRoundTripper{
-			username: username,
-			password: password,
+			roundTripper: transport,
+			username:     username,
+			password:     password,
 		},
 	}
 }
@@ -42,6 +42,8 @@ func (c *Client) CreateIndexPattern(ctx context.Context,
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("osd-xsrf", "true")
+	// Kibana, used with Open Distro for Elasticsearch, requires kbn-xsrf
+	req.Header.Set("kbn-xsrf", "true")
 	switch tenant {
 	case "global_tenant":
 		// the global tenant is special cased in the dashboards security plugin
@@ -81,6 +83,8 @@ func (c *Client) DeleteIndexPattern(ctx context.Context,
 		return fmt.Errorf("couldn't construct delete request: %v", err)
 	}
 	req.Header.Set("osd-xsrf", "true")
+	// Kibana, used with Open Distro for Elasticsearch, requires kbn-xsrf
+	req.Header.Set("kbn-xsrf", "true")
 	switch tenant {
 	case "global_tenant":
 		// the global tenant is special cased in the dashboards security plugin
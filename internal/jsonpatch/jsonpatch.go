@@ -0,0 +1,154 @@
+// Package jsonpatch implements generation of RFC 6902 JSON Patch documents.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Operation is a single JSON Patch operation.
+// https://datatracker.ietf.org/doc/html/rfc6902#section-4
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler. It omits the value field from remove
+// operations, but includes it in all other operations even if it is null.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{Op: o.Op, Path: o.Path})
+	}
+	type operation Operation // avoid recursion
+	return json.Marshal(operation(o))
+}
+
+// pointerEscaper escapes a JSON Pointer reference token.
+// https://datatracker.ietf.org/doc/html/rfc6901#section-3
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Pointer returns the JSON Pointer which references the given tokens, which
+// are escaped.
+func Pointer(tokens ...string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(pointerEscaper.Replace(token))
+	}
+	return b.String()
+}
+
+// normalize round-trips the given value through JSON so that it can be
+// compared structurally.
+func normalize(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal value: %v", err)
+	}
+	var n any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&n); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal value: %v", err)
+	}
+	return n, nil
+}
+
+// Diff returns the JSON Patch operations which transform the JSON
+// representation of a into the JSON representation of b.
+//
+// If a marshals to null, the patch consists of a single add operation on the
+// whole document. If b marshals to null, the patch consists of a single
+// remove operation on the whole document.
+func Diff(a, b any) ([]Operation, error) {
+	na, err := normalize(a)
+	if err != nil {
+		return nil, err
+	}
+	nb, err := normalize(b)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case na == nil && nb == nil:
+		return nil, nil
+	case na == nil:
+		return []Operation{{Op: "add", Path: "", Value: nb}}, nil
+	case nb == nil:
+		return []Operation{{Op: "remove", Path: ""}}, nil
+	}
+	return diff(nil, "", na, nb), nil
+}
+
+// diff appends the operations required to transform a into b at the given
+// path to ops.
+func diff(ops []Operation, path string, a, b any) []Operation {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			kPath := path + "/" + pointerEscaper.Replace(k)
+			aValue, aOK := av[k]
+			bValue, bOK := bv[k]
+			switch {
+			case !aOK:
+				ops = append(ops, Operation{Op: "add", Path: kPath, Value: bValue})
+			case !bOK:
+				ops = append(ops, Operation{Op: "remove", Path: kPath})
+			default:
+				ops = diff(ops, kPath, aValue, bValue)
+			}
+		}
+		return ops
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		common := min(len(av), len(bv))
+		for i := range common {
+			ops = diff(ops, path+"/"+strconv.Itoa(i), av[i], bv[i])
+		}
+		for i := common; i < len(bv); i++ {
+			ops = append(ops, Operation{
+				Op:    "add",
+				Path:  path + "/" + strconv.Itoa(i),
+				Value: bv[i],
+			})
+		}
+		// remove from the end so that earlier indices remain valid
+		for i := len(av) - 1; i >= common; i-- {
+			ops = append(ops, Operation{
+				Op:   "remove",
+				Path: path + "/" + strconv.Itoa(i),
+			})
+		}
+		return ops
+	}
+	if reflect.DeepEqual(a, b) {
+		return ops
+	}
+	return append(ops, Operation{Op: "replace", Path: path, Value: b})
+}
@@ -0,0 +1,100 @@
+package jsonpatch_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
+)
+
+func TestDiff(t *testing.T) {
+	type document struct {
+		Name     string            `json:"name,omitempty"`
+		Patterns []string          `json:"patterns,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+	}
+	var testCases = map[string]struct {
+		a      any
+		b      any
+		expect string
+	}{
+		"no diff": {
+			a:      document{Name: "foo", Patterns: []string{"a", "b"}},
+			b:      document{Name: "foo", Patterns: []string{"a", "b"}},
+			expect: `null`,
+		},
+		"create": {
+			a:      nil,
+			b:      document{Name: "foo"},
+			expect: `[{"op":"add","path":"","value":{"name":"foo"}}]`,
+		},
+		"delete": {
+			a:      document{Name: "foo"},
+			b:      nil,
+			expect: `[{"op":"remove","path":""}]`,
+		},
+		"replace scalar": {
+			a:      document{Name: "foo"},
+			b:      document{Name: "bar"},
+			expect: `[{"op":"replace","path":"/name","value":"bar"}]`,
+		},
+		"add and remove fields": {
+			a: document{Name: "foo"},
+			b: document{Patterns: []string{"a"}},
+			expect: `[{"op":"remove","path":"/name"},` +
+				`{"op":"add","path":"/patterns","value":["a"]}]`,
+		},
+		"grow slice": {
+			a: document{Patterns: []string{"a"}},
+			b: document{Patterns: []string{"a", "b", "c"}},
+			expect: `[{"op":"add","path":"/patterns/1","value":"b"},` +
+				`{"op":"add","path":"/patterns/2","value":"c"}]`,
+		},
+		"shrink slice": {
+			a: document{Patterns: []string{"a", "b", "c"}},
+			b: document{Patterns: []string{"x"}},
+			expect: `[{"op":"replace","path":"/patterns/0","value":"x"},` +
+				`{"op":"remove","path":"/patterns/2"},` +
+				`{"op":"remove","path":"/patterns/1"}]`,
+		},
+		"escape pointer": {
+			a:      document{Labels: map[string]string{"a/b~c": "1"}},
+			b:      document{Labels: map[string]string{"a/b~c": "2"}},
+			expect: `[{"op":"replace","path":"/labels/a~1b~0c","value":"2"}]`,
+		},
+		"replace with null": {
+			a:      map[string]any{"a": 1},
+			b:      map[string]any{"a": nil},
+			expect: `[{"op":"replace","path":"/a","value":null}]`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ops, err := jsonpatch.Diff(tc.a, tc.b)
+			assert.NoError(tt, err, name)
+			data, err := json.Marshal(ops)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expect, string(data), name)
+		})
+	}
+}
+
+func TestPointer(t *testing.T) {
+	var testCases = map[string]struct {
+		tokens []string
+		expect string
+	}{
+		"whole document": {tokens: nil, expect: ""},
+		"single token":   {tokens: []string{"p1"}, expect: "/p1"},
+		"escaped tokens": {
+			tokens: []string{"a/b", "c~d"},
+			expect: "/a~1b/c~0d",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expect, jsonpatch.Pointer(tc.tokens...), name)
+		})
+	}
+}
@@ -6,27 +6,44 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
 )
 
 // Client is a Keycloak admin client.
 type Client struct {
 	baseURL    *url.URL
+	realm      string
+	pageSize   int
+	subGroups  bool
 	httpClient *http.Client
 }
 
-// NewClientCredentialsClient creates a new keycloak client.
-func NewClientCredentialsClient(ctx context.Context, baseURL, clientID,
-	clientSecret string) (*Client, error) {
+// NewClientCredentialsClient creates a new keycloak client for the given
+// realm. The layout is one of the Layout* constants, and determines the path
+// prefix of the Keycloak API. Groups are requested in pages of pageSize
+// groups, or all at once if pageSize is less than one. If subGroups is true,
+// subgroups are recursively traversed and included in the list of groups.
+// The client secret is reloaded before each new token is requested.
+func NewClientCredentialsClient(ctx context.Context, baseURL, realm, layout,
+	clientID string, clientSecret *secret.Value, pageSize int,
+	subGroups bool) (*Client, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse base URL %s: %v", baseURL, err)
 	}
-	httpClient, err := httpClient(ctx, *u, "lagoon", clientID, clientSecret)
+	provider, prefix, err := discover(ctx, *u, realm, layout)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get keycloak http client: %v", err)
+		return nil, fmt.Errorf("couldn't get new OIDC provider: %v", err)
 	}
+	// all other API requests are made relative to the detected prefix
+	u.Path = prefix
 	return &Client{
-		baseURL:    u,
-		httpClient: httpClient,
+		baseURL:   u,
+		realm:     realm,
+		pageSize:  pageSize,
+		subGroups: subGroups,
+		httpClient: httpClient(ctx, provider.Endpoint().TokenURL, clientID,
+			clientSecret),
 	}, nil
 }
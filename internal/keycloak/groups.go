@@ -8,12 +8,24 @@ import (
 	"io"
 	"net/http"
 	"path"
+	"slices"
+	"strconv"
 )
 
 // Group represents a Keycloak Group. It holds the fields required when getting
 // a list of groups from keycloak.
 type Group struct {
-	ID string `json:"id"`
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	// ParentPath is the path of the parent group of a subgroup, and is empty
+	// for top-level groups. It is not part of the Keycloak representation,
+	// and is set when subgroups are flattened.
+	ParentPath string `json:"parentPath,omitempty"`
+	// SubGroups are embedded by older versions of Keycloak. Newer versions
+	// instead return SubGroupCount, and the subgroups must be requested
+	// separately.
+	SubGroups     []Group `json:"subGroups,omitempty"`
+	SubGroupCount int     `json:"subGroupCount,omitempty"`
 	GroupUpdateRepresentation
 }
 
@@ -23,45 +35,257 @@ type GroupUpdateRepresentation struct {
 	Attributes map[string][]string `json:"attributes"`
 }
 
-// RawGroups returns the raw JSON group representation from the Keycloak API.
-func (c *Client) RawGroups(ctx context.Context) ([]byte, error) {
-	groupsURL := *c.baseURL
-	groupsURL.Path = path.Join(c.baseURL.Path,
-		"/auth/admin/realms/lagoon/groups")
-	req, err := http.NewRequestWithContext(ctx, "GET", groupsURL.String(), nil)
+// groupsCount is the response of the groups count endpoint.
+type groupsCount struct {
+	Count int `json:"count"`
+}
+
+// get performs a GET request against the Keycloak admin API of the client's
+// realm. The caller must close the response body.
+func (c *Client) get(ctx context.Context, subPath string,
+	query map[string]string) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path = path.Join(c.baseURL.Path, "admin/realms", c.realm, subPath)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't construct groups request: %v", err)
+		return nil, fmt.Errorf("couldn't construct request: %v", err)
 	}
 	q := req.URL.Query()
-	q.Add("subGroupsCount", "false")
-	q.Add("briefRepresentation", "false")
+	for k, v := range query {
+		q.Add(k, v)
+	}
 	req.URL.RawQuery = q.Encode()
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get groups: %v", err)
+		return nil, err
 	}
-	defer res.Body.Close()
 	if res.StatusCode > 299 {
+		defer res.Body.Close()
 		body, _ := io.ReadAll(res.Body)
-		return nil, fmt.Errorf("bad groups response: %d\n%s", res.StatusCode, body)
+		return nil, fmt.Errorf("bad response: %d\n%s", res.StatusCode, body)
+	}
+	return res, nil
+}
+
+// groupsRequest requests a page of groups from the Keycloak API at the given
+// sub path. If max is less than one, all groups are requested. The caller
+// must close the response body.
+func (c *Client) groupsRequest(ctx context.Context, subPath string, first,
+	max int) (*http.Response, error) {
+	query := map[string]string{
+		"subGroupsCount":      strconv.FormatBool(c.subGroups),
+		"briefRepresentation": "false",
+	}
+	if max > 0 {
+		query["first"] = strconv.Itoa(first)
+		query["max"] = strconv.Itoa(max)
+	}
+	res, err := c.get(ctx, subPath, query)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get groups: %v", err)
+	}
+	return res, nil
+}
+
+// RawGroups returns the raw JSON group representation from the Keycloak API.
+// If max is greater than zero, only the page of at most max groups starting
+// at offset first is returned.
+func (c *Client) RawGroups(ctx context.Context, first, max int) ([]byte, error) {
+	res, err := c.groupsRequest(ctx, "groups", first, max)
+	if err != nil {
+		return nil, err
 	}
+	defer res.Body.Close()
 	return io.ReadAll(res.Body)
 }
 
-// Groups returns all Keycloak Groups including their attributes.
-func (c *Client) Groups(ctx context.Context) ([]Group, error) {
-	data, err := c.RawGroups(ctx)
+// countGroups returns the number of top-level groups in the realm.
+func (c *Client) countGroups(ctx context.Context) (int, error) {
+	res, err := c.get(ctx, "groups/count", map[string]string{"top": "true"})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get groups count: %v", err)
+	}
+	defer res.Body.Close()
+	var count groupsCount
+	if err = json.NewDecoder(res.Body).Decode(&count); err != nil {
+		return 0, fmt.Errorf("couldn't decode groups count: %v", err)
+	}
+	return count.Count, nil
+}
+
+// decodeGroups decodes a JSON array of groups from r one element at a time,
+// and passes each group to fn. It returns the number of groups decoded.
+func decodeGroups(r io.Reader, fn func(Group) error) (int, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read array start: %v", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return 0, fmt.Errorf("unexpected token %v, expected array start", tok)
+	}
+	var n int
+	for dec.More() {
+		var group Group
+		if err = dec.Decode(&group); err != nil {
+			return n, fmt.Errorf("couldn't decode group: %v", err)
+		}
+		if err = fn(group); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if _, err = dec.Token(); err != nil {
+		return n, fmt.Errorf("couldn't read array end: %v", err)
+	}
+	return n, nil
+}
+
+// groupsPage appends the page of at most max groups at the given sub path
+// starting at offset first to groups, and returns the number of groups in
+// the page. The seen map is used to detect groups which appear in more than
+// one page.
+func (c *Client) groupsPage(ctx context.Context, subPath string, first,
+	max int, groups *[]Group, seen map[string]bool) (int, error) {
+	res, err := c.groupsRequest(ctx, subPath, first, max)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get groups from Keycloak API: %v", err)
+		return 0, err
+	}
+	defer res.Body.Close()
+	return decodeGroups(res.Body, func(group Group) error {
+		if seen[group.ID] {
+			return fmt.Errorf("inconsistent paging: duplicate group ID %s",
+				group.ID)
+		}
+		seen[group.ID] = true
+		*groups = append(*groups, group)
+		return nil
+	})
+}
+
+// childGroups returns the direct subgroups of the group with the given ID,
+// requested in pages if the client has a page size greater than zero.
+func (c *Client) childGroups(ctx context.Context, id string) ([]Group, error) {
+	var children []Group
+	seen := map[string]bool{}
+	subPath := path.Join("groups", id, "children")
+	if c.pageSize < 1 {
+		_, err := c.groupsPage(ctx, subPath, 0, 0, &children, seen)
+		return children, err
+	}
+	for first := 0; ; first += c.pageSize {
+		n, err := c.groupsPage(ctx, subPath, first, c.pageSize, &children, seen)
+		if err != nil {
+			return nil, err
+		}
+		if n < c.pageSize {
+			return children, nil
+		}
+	}
+}
+
+// flattenGroups recursively traverses the subgroups of the given groups, and
+// returns a flattened list of groups with the ParentPath of each subgroup
+// set. Lagoon role subgroups, which only exist to assign roles to the members
+// of their parent group, are omitted.
+//
+// Embedded subgroups are used where available, and otherwise subgroups are
+// requested from the Keycloak API.
+func (c *Client) flattenGroups(ctx context.Context, groups []Group,
+	seen map[string]bool) ([]Group, error) {
+	var flat []Group
+	var walk func(parentPath string, groups []Group) error
+	walk = func(parentPath string, groups []Group) error {
+		for _, group := range groups {
+			if parentPath != "" &&
+				slices.Contains(group.Attributes["type"], "role-subgroup") {
+				continue
+			}
+			// top-level groups have already been checked for duplicates
+			if parentPath != "" {
+				if seen[group.ID] {
+					return fmt.Errorf("duplicate group ID %s", group.ID)
+				}
+				seen[group.ID] = true
+			}
+			children := group.SubGroups
+			if group.SubGroupCount > len(children) {
+				var err error
+				children, err = c.childGroups(ctx, group.ID)
+				if err != nil {
+					return fmt.Errorf("couldn't get subgroups of %s: %v",
+						group.Name, err)
+				}
+			}
+			if group.Path == "" {
+				group.Path = parentPath + "/" + group.Name
+			}
+			group.ParentPath = parentPath
+			group.SubGroups = nil
+			group.SubGroupCount = 0
+			flat = append(flat, group)
+			if err := walk(group.Path, children); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
+	return flat, walk("", groups)
+}
+
+// Groups returns all Keycloak Groups including their attributes.
+//
+// If the client has subgroup traversal enabled, subgroups are included in
+// the returned list. Otherwise only top-level groups are returned.
+//
+// If the client has a page size greater than zero, groups are requested in
+// pages of that size. In this case the group count is checked before and
+// after paging, and an error is returned if groups were added or removed
+// while paging since some groups may have been skipped.
+func (c *Client) Groups(ctx context.Context) ([]Group, error) {
 	var groups []Group
-	if err = json.Unmarshal(data, &groups); err != nil {
-		return nil, fmt.Errorf("couldn't unmarshal groups from Keycloak API: %v", err)
+	seen := map[string]bool{}
+	if c.pageSize < 1 {
+		_, err := c.groupsPage(ctx, "groups", 0, 0, &groups, seen)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get groups from Keycloak API: %v", err)
+		}
+	} else {
+		before, err := c.countGroups(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for first := 0; ; first += c.pageSize {
+			n, err := c.groupsPage(ctx, "groups", first, c.pageSize, &groups,
+				seen)
+			if err != nil {
+				return nil,
+					fmt.Errorf("couldn't get groups from Keycloak API: %v", err)
+			}
+			if n < c.pageSize {
+				break
+			}
+		}
+		after, err := c.countGroups(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if before != after || len(groups) != after {
+			return nil, fmt.Errorf("inconsistent paging: group count %d before, "+
+				"%d after, %d received", before, after, len(groups))
+		}
 	}
 	if len(groups) == 0 {
 		// https://github.com/uselagoon/lagoon-opensearch-sync/issues/150
 		return nil,
 			errors.New("empty groups response from Keycloak. Permissions issue?")
 	}
-	return groups, json.Unmarshal(data, &groups)
+	if c.subGroups {
+		return c.flattenGroups(ctx, groups, seen)
+	}
+	for i := range groups {
+		groups[i].SubGroups = nil
+		groups[i].SubGroupCount = 0
+	}
+	return groups, nil
 }
@@ -3,19 +3,56 @@ package keycloak_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
 )
 
+// paging determines how the mock keycloak responds to paged group requests.
+type paging int
+
+const (
+	// pagingConsistent responds with the requested page of groups.
+	pagingConsistent paging = iota
+	// pagingIgnored ignores the paging parameters and responds with all
+	// groups.
+	pagingIgnored
+	// pagingGroupAdded responds with a group count which increases after the
+	// first request.
+	pagingGroupAdded
+)
+
+// writeGroupsPage writes the page of groups requested by r.
+func writeGroupsPage(tt *testing.T, w http.ResponseWriter, r *http.Request,
+	groups []json.RawMessage, p paging) {
+	page := groups
+	q := r.URL.Query()
+	if q.Has("max") && p != pagingIgnored {
+		first, _ := strconv.Atoi(q.Get("first"))
+		max, _ := strconv.Atoi(q.Get("max"))
+		page = groups[min(first, len(groups)):min(first+max, len(groups))]
+	}
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		tt.Fatal(err)
+	}
+}
+
 // newTestGroupsServer sets up a mock keycloak which responds with
-// appropriate group JSON data to exercise Groups.
-func newTestGroupsServer(tt *testing.T, testDataPath string) *httptest.Server {
+// appropriate group JSON data to exercise Groups. The prefix and realm
+// determine the URL layout of the mock keycloak.
+func newTestGroupsServer(tt *testing.T, testDataPath, prefix,
+	realm string, p paging) *httptest.Server {
 	// load the discovery JSON first, because the mux closure needs to
 	// reference its buffer
 	discoveryBuf, err := os.ReadFile("testdata/realm.oidc.discovery.json")
@@ -23,9 +60,29 @@ func newTestGroupsServer(tt *testing.T, testDataPath string) *httptest.Server {
 		tt.Fatal(err)
 		return nil
 	}
+	groupsBuf, err := os.ReadFile(testDataPath)
+	if err != nil {
+		tt.Fatal(err)
+		return nil
+	}
+	var groups []json.RawMessage
+	if err = json.Unmarshal(groupsBuf, &groups); err != nil {
+		tt.Fatal(err)
+		return nil
+	}
+	usersBuf, err := os.ReadFile("testdata/users.json")
+	if err != nil {
+		tt.Fatal(err)
+		return nil
+	}
+	var users []json.RawMessage
+	if err = json.Unmarshal(usersBuf, &users); err != nil {
+		tt.Fatal(err)
+		return nil
+	}
 	// configure router with the URLs that OIDC discovery and JWKS require
 	mux := http.NewServeMux()
-	mux.HandleFunc("/auth/realms/lagoon/.well-known/openid-configuration",
+	mux.HandleFunc(prefix+"/realms/"+realm+"/.well-known/openid-configuration",
 		func(w http.ResponseWriter, r *http.Request) {
 			d := bytes.NewBuffer(discoveryBuf)
 			_, err = io.Copy(w, d)
@@ -34,14 +91,39 @@ func newTestGroupsServer(tt *testing.T, testDataPath string) *httptest.Server {
 			}
 		})
 	// configure the "all groups" path
-	mux.HandleFunc("/auth/admin/realms/lagoon/groups",
+	mux.HandleFunc(prefix+"/admin/realms/"+realm+"/groups",
 		func(w http.ResponseWriter, r *http.Request) {
-			f, err := os.Open(testDataPath)
-			if err != nil {
+			writeGroupsPage(tt, w, r, groups, p)
+		})
+	// configure the subgroups path, which serves testdata/children/<id>.json
+	mux.HandleFunc(prefix+"/admin/realms/"+realm+"/groups/{id}/children",
+		func(w http.ResponseWriter, r *http.Request) {
+			var children []json.RawMessage
+			buf, err := os.ReadFile(
+				filepath.Join("testdata/children", r.PathValue("id")+".json"))
+			if err == nil {
+				err = json.Unmarshal(buf, &children)
+			}
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
 				tt.Fatal(err)
-				return
 			}
-			_, err = io.Copy(w, f)
+			writeGroupsPage(tt, w, r, children, p)
+		})
+	// configure the users path
+	mux.HandleFunc(prefix+"/admin/realms/"+realm+"/users",
+		func(w http.ResponseWriter, r *http.Request) {
+			writeGroupsPage(tt, w, r, users, p)
+		})
+	// configure the groups count path
+	var countRequests int
+	mux.HandleFunc(prefix+"/admin/realms/"+realm+"/groups/count",
+		func(w http.ResponseWriter, r *http.Request) {
+			count := len(groups)
+			if p == pagingGroupAdded {
+				count += countRequests
+			}
+			countRequests++
+			_, err := fmt.Fprintf(w, `{"count":%d}`, count)
 			if err != nil {
 				tt.Fatal(err)
 			}
@@ -50,7 +132,8 @@ func newTestGroupsServer(tt *testing.T, testDataPath string) *httptest.Server {
 	// now replace the example URL in the discovery JSON with the actual
 	// httptest server URL
 	discoveryBuf = bytes.ReplaceAll(discoveryBuf,
-		[]byte("https://keycloak.example.com"), []byte(ts.URL))
+		[]byte("https://keycloak.example.com/auth/realms/lagoon"),
+		[]byte(ts.URL+prefix+"/realms/"+realm))
 	return ts
 }
 
@@ -64,7 +147,8 @@ func TestGroups(t *testing.T) {
 			input: "testdata/groups.json",
 			expect: []keycloak.Group{
 				{
-					ID: "f6697da3-016a-43cd-ba9f-3f5b91b45302",
+					ID:   "f6697da3-016a-43cd-ba9f-3f5b91b45302",
+					Path: "/drupal-example",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "drupal-example",
 						Attributes: map[string][]string{
@@ -74,7 +158,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "9772ddcc-01ea-470a-9c6a-9729fb755ea2",
+					ID:   "9772ddcc-01ea-470a-9c6a-9729fb755ea2",
+					Path: "/internaltest",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "internaltest",
 						Attributes: map[string][]string{
@@ -84,7 +169,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "3fc60c90-b72d-4704-8a57-80438adac98d",
+					ID:   "3fc60c90-b72d-4704-8a57-80438adac98d",
+					Path: "/project-beta-ui",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "project-beta-ui",
 						Attributes: map[string][]string{
@@ -94,7 +180,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "8fb9508c-a7e6-445b-a8bb-f28bb0b6eb2d",
+					ID:   "8fb9508c-a7e6-445b-a8bb-f28bb0b6eb2d",
+					Path: "/project-drupal-example",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "project-drupal-example",
 						Attributes: map[string][]string{
@@ -104,7 +191,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "7d5f5769-6904-42cd-9418-d01a1daae6b5",
+					ID:   "7d5f5769-6904-42cd-9418-d01a1daae6b5",
+					Path: "/project-drupal9-base",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "project-drupal9-base",
 						Attributes: map[string][]string{
@@ -114,7 +202,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "372b0aae-40f1-4af2-b9dd-a4af1d21c845",
+					ID:   "372b0aae-40f1-4af2-b9dd-a4af1d21c845",
+					Path: "/project-drupal9-solr",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "project-drupal9-solr",
 						Attributes: map[string][]string{
@@ -124,7 +213,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "9e49d864-d78c-4875-ae46-57daa7151ebe",
+					ID:   "9e49d864-d78c-4875-ae46-57daa7151ebe",
+					Path: "/project-example-ruby-on-rails",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "project-example-ruby-on-rails",
 						Attributes: map[string][]string{
@@ -135,7 +225,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "0a442bdd-e89d-4871-8552-80fcc386e236",
+					ID:   "0a442bdd-e89d-4871-8552-80fcc386e236",
+					Path: "/project-lagoon-website",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "project-lagoon-website",
 						Attributes: map[string][]string{
@@ -145,7 +236,8 @@ func TestGroups(t *testing.T) {
 					},
 				},
 				{
-					ID: "7cd0cca1-ab32-442f-ba85-adc83d6d6d1a",
+					ID:   "7cd0cca1-ab32-442f-ba85-adc83d6d6d1a",
+					Path: "/project-react-example",
 					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
 						Name: "project-react-example",
 						Attributes: map[string][]string{
@@ -164,14 +256,19 @@ func TestGroups(t *testing.T) {
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(tt *testing.T) {
-			ts := newTestGroupsServer(tt, tc.input)
+			ts := newTestGroupsServer(tt, tc.input, "/auth", "lagoon",
+				pagingConsistent)
 			defer ts.Close()
 			ctx := context.Background()
 			k, err := keycloak.NewClientCredentialsClient(
 				ctx,
 				ts.URL,
+				"lagoon",
+				keycloak.LayoutAuto,
 				"test-client-id",
-				"test-client-secret",
+				secret.Static("test-client-secret"),
+				0,
+				false,
 			)
 			if err != nil {
 				tt.Fatal(err)
@@ -189,3 +286,248 @@ func TestGroups(t *testing.T) {
 		})
 	}
 }
+
+func TestLayouts(t *testing.T) {
+	var testCases = map[string]struct {
+		serverPrefix string
+		serverRealm  string
+		realm        string
+		layout       string
+		expectError  bool
+	}{
+		"legacy layout": {
+			serverPrefix: "/auth",
+			serverRealm:  "lagoon",
+			realm:        "lagoon",
+			layout:       keycloak.LayoutLegacy,
+		},
+		"modern layout": {
+			serverRealm: "lagoon",
+			realm:       "lagoon",
+			layout:      keycloak.LayoutModern,
+		},
+		"auto detect legacy layout": {
+			serverPrefix: "/auth",
+			serverRealm:  "lagoon",
+			realm:        "lagoon",
+			layout:       keycloak.LayoutAuto,
+		},
+		"auto detect modern layout": {
+			serverRealm: "lagoon",
+			realm:       "lagoon",
+			layout:      keycloak.LayoutAuto,
+		},
+		"custom realm": {
+			serverRealm: "example",
+			realm:       "example",
+			layout:      keycloak.LayoutAuto,
+		},
+		"legacy layout on modern keycloak": {
+			serverRealm: "lagoon",
+			realm:       "lagoon",
+			layout:      keycloak.LayoutLegacy,
+			expectError: true,
+		},
+		"modern layout on legacy keycloak": {
+			serverPrefix: "/auth",
+			serverRealm:  "lagoon",
+			realm:        "lagoon",
+			layout:       keycloak.LayoutModern,
+			expectError:  true,
+		},
+		"wrong realm": {
+			serverRealm: "lagoon",
+			realm:       "example",
+			layout:      keycloak.LayoutAuto,
+			expectError: true,
+		},
+		"unknown layout": {
+			serverRealm: "lagoon",
+			realm:       "lagoon",
+			layout:      "invalid",
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := newTestGroupsServer(tt, "testdata/groups.json", tc.serverPrefix,
+				tc.serverRealm, pagingConsistent)
+			defer ts.Close()
+			ctx := context.Background()
+			k, err := keycloak.NewClientCredentialsClient(
+				ctx,
+				ts.URL,
+				tc.realm,
+				tc.layout,
+				"test-client-id",
+				secret.Static("test-client-secret"),
+				0,
+				false,
+			)
+			if tc.expectError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			// override internal client credentials HTTP client for testing
+			k.UseDefaultHTTPClient()
+			groups, err := k.Groups(ctx)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, 9, len(groups), name)
+		})
+	}
+}
+
+func TestGroupsPaging(t *testing.T) {
+	var testCases = map[string]struct {
+		input       string
+		pageSize    int
+		paging      paging
+		expectError bool
+	}{
+		"unpaged":             {input: "testdata/groups.json"},
+		"single page":         {input: "testdata/groups.json", pageSize: 100},
+		"exact pages":         {input: "testdata/groups.json", pageSize: 3},
+		"partial final page":  {input: "testdata/groups.json", pageSize: 2},
+		"page size one":       {input: "testdata/groups.json", pageSize: 1},
+		"empty groups":        {input: "testdata/groups.empty.json", pageSize: 2, expectError: true},
+		"duplicate groups":    {input: "testdata/groups.json", pageSize: 2, paging: pagingIgnored, expectError: true},
+		"group added":         {input: "testdata/groups.json", pageSize: 2, paging: pagingGroupAdded, expectError: true},
+		"group added unpaged": {input: "testdata/groups.json", paging: pagingGroupAdded},
+	}
+	// the unpaged groups are the expected result of a successful paged request
+	ts := newTestGroupsServer(t, "testdata/groups.json", "/auth", "lagoon",
+		pagingConsistent)
+	ctx := context.Background()
+	k, err := keycloak.NewClientCredentialsClient(ctx, ts.URL, "lagoon",
+		keycloak.LayoutAuto, "test-client-id",
+		secret.Static("test-client-secret"), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.UseDefaultHTTPClient()
+	expect, err := k.Groups(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := newTestGroupsServer(tt, tc.input, "/auth", "lagoon", tc.paging)
+			defer ts.Close()
+			k, err := keycloak.NewClientCredentialsClient(ctx, ts.URL, "lagoon",
+				keycloak.LayoutAuto, "test-client-id",
+				secret.Static("test-client-secret"),
+				tc.pageSize, false)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			// override internal client credentials HTTP client for testing
+			k.UseDefaultHTTPClient()
+			groups, err := k.Groups(ctx)
+			if tc.expectError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, expect, groups, name)
+		})
+	}
+}
+
+func TestGroupsSubGroups(t *testing.T) {
+	expectNested := []keycloak.Group{
+		{
+			ID:   "10000000-0000-0000-0000-000000000001",
+			Path: "/acme",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name:       "acme",
+				Attributes: map[string][]string{},
+			},
+		},
+		{
+			ID:         "10000000-0000-0000-0000-000000000003",
+			Path:       "/acme/acme-team",
+			ParentPath: "/acme",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "acme-team",
+				Attributes: map[string][]string{
+					"lagoon-projects": {`1,2`},
+				},
+			},
+		},
+		{
+			ID:         "10000000-0000-0000-0000-000000000005",
+			Path:       "/acme/acme-team/acme-team-sub",
+			ParentPath: "/acme/acme-team",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "acme-team-sub",
+				Attributes: map[string][]string{
+					"lagoon-projects": {`3`},
+				},
+			},
+		},
+		{
+			ID:   "10000000-0000-0000-0000-000000000006",
+			Path: "/solo",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "solo",
+				Attributes: map[string][]string{
+					"lagoon-projects": {`4`},
+				},
+			},
+		},
+	}
+	expectTopLevel := []keycloak.Group{expectNested[0], expectNested[3]}
+	var testCases = map[string]struct {
+		input     string
+		subGroups bool
+		pageSize  int
+		expect    []keycloak.Group
+	}{
+		"embedded subgroups": {
+			input:     "testdata/groups.nested.embedded.json",
+			subGroups: true,
+			expect:    expectNested,
+		},
+		"embedded subgroups disabled": {
+			input:  "testdata/groups.nested.embedded.json",
+			expect: expectTopLevel,
+		},
+		"requested subgroups": {
+			input:     "testdata/groups.nested.json",
+			subGroups: true,
+			expect:    expectNested,
+		},
+		"requested subgroups paged": {
+			input:     "testdata/groups.nested.json",
+			subGroups: true,
+			pageSize:  1,
+			expect:    expectNested,
+		},
+		"requested subgroups disabled": {
+			input:  "testdata/groups.nested.json",
+			expect: expectTopLevel,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := newTestGroupsServer(tt, tc.input, "/auth", "lagoon",
+				pagingConsistent)
+			defer ts.Close()
+			ctx := context.Background()
+			k, err := keycloak.NewClientCredentialsClient(ctx, ts.URL, "lagoon",
+				keycloak.LayoutAuto, "test-client-id",
+				secret.Static("test-client-secret"),
+				tc.pageSize, tc.subGroups)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			// override internal client credentials HTTP client for testing
+			k.UseDefaultHTTPClient()
+			groups, err := k.Groups(ctx)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expect, groups, name)
+		})
+	}
+}
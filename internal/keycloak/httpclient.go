@@ -2,26 +2,107 @@ package keycloak
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"sync"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
-func httpClient(ctx context.Context, u url.URL, realm, clientID,
-	clientSecret string) (*http.Client, error) {
-	u.Path = path.Join(u.Path, fmt.Sprintf("/auth/realms/%s", realm))
-	provider, err := oidc.NewProvider(ctx, u.String())
-	if err != nil {
-		return nil, fmt.Errorf("couldn't get new OIDC provider: %v", err)
+// Keycloak URL layouts.
+const (
+	// LayoutAuto detects the URL layout by trying the OIDC discovery document
+	// at the legacy location first, and then at the modern location.
+	LayoutAuto = "auto"
+	// LayoutLegacy is the URL layout used by Keycloak versions prior to 17,
+	// where all paths are prefixed with /auth.
+	LayoutLegacy = "legacy"
+	// LayoutModern is the URL layout used by Keycloak 17+ by default, where
+	// paths have no prefix.
+	LayoutModern = "modern"
+)
+
+// layoutPrefixes maps URL layouts to path prefixes.
+var layoutPrefixes = map[string]string{
+	LayoutLegacy: "/auth",
+	LayoutModern: "",
+}
+
+// discover the OIDC provider for the given realm using the given URL layout.
+// It returns the provider, and the path prefix which should be used for other
+// Keycloak API requests.
+func discover(ctx context.Context, u url.URL, realm,
+	layout string) (*oidc.Provider, string, error) {
+	var layouts []string
+	switch layout {
+	case LayoutAuto:
+		layouts = []string{LayoutLegacy, LayoutModern}
+	case LayoutLegacy, LayoutModern:
+		layouts = []string{layout}
+	default:
+		return nil, "", fmt.Errorf("unknown URL layout: %s", layout)
 	}
-	c := clientcredentials.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		TokenURL:     provider.Endpoint().TokenURL,
+	var errs []error
+	for _, l := range layouts {
+		prefix := layoutPrefixes[l]
+		issuerURL := u
+		issuerURL.Path = path.Join(u.Path, prefix, "realms", realm)
+		provider, err := oidc.NewProvider(ctx, issuerURL.String())
+		if err == nil {
+			return provider, path.Join(u.Path, prefix), nil
+		}
+		errs = append(errs, fmt.Errorf("%s layout: %v", l, err))
 	}
-	return c.Client(ctx), nil
+	return nil, "", errors.Join(errs...)
+}
+
+// reloadingTokenSource is an oauth2.TokenSource which uses the client
+// credentials flow. If the client secret changes, cached tokens are discarded
+// and new tokens are requested using the new secret.
+type reloadingTokenSource struct {
+	ctx          context.Context
+	tokenURL     string
+	clientID     string
+	clientSecret *secret.Value
+
+	mu          sync.Mutex
+	generation  uint64
+	tokenSource oauth2.TokenSource
+}
+
+// Token implements the oauth2.TokenSource interface.
+func (r *reloadingTokenSource) Token() (*oauth2.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clientSecret, generation, err := r.clientSecret.Load()
+	if err != nil && r.tokenSource == nil {
+		return nil, fmt.Errorf("couldn't load client secret: %v", err)
+	}
+	// if the secret couldn't be reloaded, keep using the last good secret
+	if r.tokenSource == nil || generation != r.generation {
+		c := clientcredentials.Config{
+			ClientID:     r.clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     r.tokenURL,
+		}
+		r.tokenSource = c.TokenSource(r.ctx)
+		r.generation = generation
+	}
+	return r.tokenSource.Token()
+}
+
+func httpClient(ctx context.Context, tokenURL, clientID string,
+	clientSecret *secret.Value) *http.Client {
+	return oauth2.NewClient(ctx, &reloadingTokenSource{
+		ctx:          ctx,
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	})
 }
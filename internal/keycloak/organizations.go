@@ -0,0 +1,92 @@
+package keycloak
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Keycloak user attributes in which Lagoon stores the comma-separated IDs of
+// the organizations of which the user is an owner, admin, or viewer.
+const (
+	organizationOwnerAttribute  = "lagoon-organizations"
+	organizationAdminAttribute  = "lagoon-organizations-admin"
+	organizationViewerAttribute = "lagoon-organizations-viewer"
+)
+
+// OrganizationMembers holds the usernames of the owners and viewers of a
+// Lagoon organization.
+type OrganizationMembers struct {
+	// Owners are the organization owners and admins.
+	Owners []string
+	// Viewers are the organization viewers.
+	Viewers []string
+}
+
+// organizationIDs parses the given attribute of the given user, and returns
+// the organization IDs it contains. Values which are not valid organization
+// IDs are logged and skipped.
+func organizationIDs(log *zap.Logger, user User, attribute string) []int {
+	var ids []int
+	for _, value := range user.Attributes[attribute] {
+		for field := range strings.SplitSeq(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				log.Warn("couldn't parse organization ID in user attribute",
+					zap.String("username", user.Username),
+					zap.String("attribute", attribute),
+					zap.String("value", value),
+					zap.Error(err))
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// OrganizationMembersMap parses the Lagoon organization attributes of each of
+// the given users, and returns a map of organization IDs to the usernames of
+// the organization owners and viewers, ordered by username. Organization
+// admins are included in the owners. Organizations without owners or viewers
+// are omitted.
+func OrganizationMembersMap(
+	log *zap.Logger,
+	users []User,
+) map[int]OrganizationMembers {
+	members := map[int]OrganizationMembers{}
+	for _, user := range users {
+		for _, attribute := range []string{
+			organizationOwnerAttribute,
+			organizationAdminAttribute,
+		} {
+			for _, id := range organizationIDs(log, user, attribute) {
+				m := members[id]
+				if !slices.Contains(m.Owners, user.Username) {
+					m.Owners = append(m.Owners, user.Username)
+				}
+				members[id] = m
+			}
+		}
+		for _, id := range organizationIDs(log, user,
+			organizationViewerAttribute) {
+			m := members[id]
+			if !slices.Contains(m.Viewers, user.Username) {
+				m.Viewers = append(m.Viewers, user.Username)
+			}
+			members[id] = m
+		}
+	}
+	for id, m := range members {
+		slices.Sort(m.Owners)
+		slices.Sort(m.Viewers)
+		members[id] = m
+	}
+	return members
+}
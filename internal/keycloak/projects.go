@@ -0,0 +1,50 @@
+package keycloak
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// projectsAttribute is the Keycloak group attribute in which older versions
+// of Lagoon store the comma-separated IDs of the projects in the group.
+const projectsAttribute = "lagoon-projects"
+
+// GroupProjectsMap parses the lagoon-projects attribute of each of the given
+// groups, and returns a map of Group (UU)IDs to Project IDs, ordered by
+// project ID. Groups without projects are omitted. Values which are not valid
+// project IDs are logged and skipped, so that one malformed attribute doesn't
+// prevent the membership of every other group from being read. This is an
+// alternative to the Lagoon API DB kc_group_projects table for older versions
+// of Lagoon.
+func GroupProjectsMap(log *zap.Logger, groups []Group) map[string][]int {
+	groupProjectsMap := map[string][]int{}
+	for _, group := range groups {
+		for _, value := range group.Attributes[projectsAttribute] {
+			for field := range strings.SplitSeq(value, ",") {
+				field = strings.TrimSpace(field)
+				if field == "" {
+					continue
+				}
+				pid, err := strconv.Atoi(field)
+				if err != nil {
+					log.Warn("couldn't parse project ID in group attribute",
+						zap.String("group", group.Name),
+						zap.String("attribute", projectsAttribute),
+						zap.String("value", value),
+						zap.Error(err))
+					continue
+				}
+				if !slices.Contains(groupProjectsMap[group.ID], pid) {
+					groupProjectsMap[group.ID] = append(groupProjectsMap[group.ID], pid)
+				}
+			}
+		}
+	}
+	for _, pids := range groupProjectsMap {
+		slices.Sort(pids)
+	}
+	return groupProjectsMap
+}
@@ -0,0 +1,116 @@
+package keycloak_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestGroupProjectsMap(t *testing.T) {
+	ts := newTestGroupsServer(t, "testdata/groups.json", "/auth", "lagoon",
+		pagingConsistent)
+	defer ts.Close()
+	ctx := context.Background()
+	k, err := keycloak.NewClientCredentialsClient(ctx, ts.URL, "lagoon",
+		keycloak.LayoutAuto, "test-client-id",
+		secret.Static("test-client-secret"), 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// override internal client credentials HTTP client for testing
+	k.UseDefaultHTTPClient()
+	groups, err := k.Groups(ctx)
+	assert.NoError(t, err, "Groups")
+	groupProjectsMap := keycloak.GroupProjectsMap(zap.NewNop(), groups)
+	assert.Equal(t, map[string][]int{
+		"f6697da3-016a-43cd-ba9f-3f5b91b45302": {25, 31, 34, 35, 36},
+		"9772ddcc-01ea-470a-9c6a-9729fb755ea2": {11, 25, 33, 34, 36},
+		"3fc60c90-b72d-4704-8a57-80438adac98d": {27},
+		"8fb9508c-a7e6-445b-a8bb-f28bb0b6eb2d": {11},
+		"7d5f5769-6904-42cd-9418-d01a1daae6b5": {31},
+		"372b0aae-40f1-4af2-b9dd-a4af1d21c845": {34},
+		"9e49d864-d78c-4875-ae46-57daa7151ebe": {38},
+		"0a442bdd-e89d-4871-8552-80fcc386e236": {23},
+		"7cd0cca1-ab32-442f-ba85-adc83d6d6d1a": {33},
+	}, groupProjectsMap, "GroupProjectsMap")
+}
+
+func TestGroupProjectsMapAttributes(t *testing.T) {
+	var testCases = map[string]struct {
+		attributes map[string][]string
+		expect     map[string][]int
+	}{
+		"no attribute": {
+			attributes: map[string][]string{"type": {"project-default-group"}},
+			expect:     map[string][]int{},
+		},
+		"empty attribute": {
+			attributes: map[string][]string{"lagoon-projects": {""}},
+			expect:     map[string][]int{},
+		},
+		"multiple values": {
+			attributes: map[string][]string{"lagoon-projects": {"3, 1", "2,1,"}},
+			expect:     map[string][]int{"a": {1, 2, 3}},
+		},
+		"invalid project ID": {
+			attributes: map[string][]string{"lagoon-projects": {"1,foo"}},
+			expect:     map[string][]int{"a": {1}},
+		},
+		"only invalid project IDs": {
+			attributes: map[string][]string{"lagoon-projects": {"foo,bar"}},
+			expect:     map[string][]int{},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			groupProjectsMap := keycloak.GroupProjectsMap(zap.NewNop(),
+				[]keycloak.Group{{
+					ID: "a",
+					GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+						Name:       "group-a",
+						Attributes: tc.attributes,
+					},
+				}})
+			assert.Equal(tt, tc.expect, groupProjectsMap, name)
+		})
+	}
+}
+
+func TestGroupProjectsMapMixedGroups(t *testing.T) {
+	group := func(id, projects string) keycloak.Group {
+		return keycloak.Group{
+			ID: id,
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name:       "group-" + id,
+				Attributes: map[string][]string{"lagoon-projects": {projects}},
+			},
+		}
+	}
+	groups := []keycloak.Group{
+		group("a", "1,2"),
+		group("b", "3,not-a-project"),
+		group("c", "four"),
+		group("d", "5"),
+	}
+	core, logs := observer.New(zap.WarnLevel)
+	groupProjectsMap := keycloak.GroupProjectsMap(zap.New(core), groups)
+	assert.Equal(t, map[string][]int{
+		"a": {1, 2},
+		"b": {3},
+		"d": {5},
+	}, groupProjectsMap, "valid groups and entries")
+	var warned []string
+	for _, entry := range logs.All() {
+		warned = append(warned, entry.ContextMap()["group"].(string)+" "+
+			entry.ContextMap()["value"].(string))
+	}
+	assert.Equal(t, []string{
+		"group-b 3,not-a-project",
+		"group-c four",
+	}, warned, "warnings")
+}
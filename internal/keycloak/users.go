@@ -0,0 +1,76 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// defaultUsersPageSize is the page size used to request users if the client
+// has no page size. Keycloak returns at most this many users if no page size
+// is requested, so users are always requested in pages.
+const defaultUsersPageSize = 100
+
+// User represents a Keycloak User. It holds the fields required when getting
+// a list of users from keycloak.
+type User struct {
+	ID         string              `json:"id"`
+	Username   string              `json:"username"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// usersPage appends the page of at most max users starting at offset first
+// to users, and returns the number of users in the page. The seen map is used
+// to detect users which appear in more than one page.
+func (c *Client) usersPage(ctx context.Context, first, max int, users *[]User,
+	seen map[string]bool) (int, error) {
+	res, err := c.get(ctx, "users", map[string]string{
+		"briefRepresentation": "false",
+		"first":               strconv.Itoa(first),
+		"max":                 strconv.Itoa(max),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get users: %v", err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read users: %v", err)
+	}
+	var page []User
+	if err = json.Unmarshal(data, &page); err != nil {
+		return 0, fmt.Errorf("couldn't decode users: %v", err)
+	}
+	for _, user := range page {
+		if seen[user.ID] {
+			return 0, fmt.Errorf("inconsistent paging: duplicate user ID %s",
+				user.ID)
+		}
+		seen[user.ID] = true
+		*users = append(*users, user)
+	}
+	return len(page), nil
+}
+
+// Users returns all Keycloak Users including their attributes. Users are
+// requested in pages of the client's page size, or of defaultUsersPageSize if
+// the client has no page size.
+func (c *Client) Users(ctx context.Context) ([]User, error) {
+	pageSize := c.pageSize
+	if pageSize < 1 {
+		pageSize = defaultUsersPageSize
+	}
+	var users []User
+	seen := map[string]bool{}
+	for first := 0; ; first += pageSize {
+		n, err := c.usersPage(ctx, first, pageSize, &users, seen)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get users from Keycloak API: %v", err)
+		}
+		if n < pageSize {
+			return users, nil
+		}
+	}
+}
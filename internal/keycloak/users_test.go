@@ -0,0 +1,83 @@
+package keycloak_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"go.uber.org/zap"
+)
+
+func TestOrganizationMembersMap(t *testing.T) {
+	var testCases = map[string]struct {
+		pageSize int
+	}{
+		"default page size": {pageSize: 0},
+		"paged":             {pageSize: 1},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := newTestGroupsServer(tt, "testdata/groups.json", "/auth", "lagoon",
+				pagingConsistent)
+			defer ts.Close()
+			ctx := context.Background()
+			k, err := keycloak.NewClientCredentialsClient(ctx, ts.URL, "lagoon",
+				keycloak.LayoutAuto, "test-client-id",
+				secret.Static("test-client-secret"), tc.pageSize, false)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			// override internal client credentials HTTP client for testing
+			k.UseDefaultHTTPClient()
+			users, err := k.Users(ctx)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, 4, len(users), name)
+			members := keycloak.OrganizationMembersMap(zap.NewNop(), users)
+			assert.Equal(tt, map[int]keycloak.OrganizationMembers{
+				1: {Owners: []string{"admin@example.com", "owner@example.com"}},
+				2: {
+					Owners:  []string{"admin@example.com"},
+					Viewers: []string{"viewer@example.com"},
+				},
+			}, members, name)
+		})
+	}
+}
+
+func TestOrganizationMembersMapAttributes(t *testing.T) {
+	var testCases = map[string]struct {
+		attributes map[string][]string
+		expect     map[int]keycloak.OrganizationMembers
+	}{
+		"no attribute": {
+			attributes: map[string][]string{"lagoon-projects": {"1"}},
+			expect:     map[int]keycloak.OrganizationMembers{},
+		},
+		"multiple values": {
+			attributes: map[string][]string{
+				"lagoon-organizations":        {"3, 1", "1,"},
+				"lagoon-organizations-viewer": {"2"},
+			},
+			expect: map[int]keycloak.OrganizationMembers{
+				1: {Owners: []string{"a"}},
+				2: {Viewers: []string{"a"}},
+				3: {Owners: []string{"a"}},
+			},
+		},
+		"invalid organization ID": {
+			attributes: map[string][]string{"lagoon-organizations": {"1,foo"}},
+			expect: map[int]keycloak.OrganizationMembers{
+				1: {Owners: []string{"a"}},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			members := keycloak.OrganizationMembersMap(zap.NewNop(),
+				[]keycloak.User{{ID: "1", Username: "a", Attributes: tc.attributes}})
+			assert.Equal(tt, tc.expect, members, name)
+		})
+	}
+}
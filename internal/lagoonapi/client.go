@@ -0,0 +1,102 @@
+// Package lagoonapi implements a client for the Lagoon GraphQL API. It is an
+// alternative to the lagoondb package for installations where direct access
+// to the Lagoon API database is not possible.
+package lagoonapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+)
+
+// Client is a Lagoon GraphQL API client.
+type Client struct {
+	apiURL     string
+	token      *secret.Value
+	httpClient *http.Client
+	// projects are the projects read by the most recent call to Projects.
+	projectsMu sync.Mutex
+	projects   []project
+}
+
+// graphQLRequest is the body of a GraphQL request.
+type graphQLRequest struct {
+	Query string `json:"query"`
+}
+
+// graphQLError is an error in a GraphQL response.
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// graphQLResponse is the body of a GraphQL response.
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []graphQLError  `json:"errors"`
+}
+
+// NewClient returns a new Lagoon GraphQL API Client. The token is a Lagoon
+// service token, which is loaded and sent as a bearer token with each
+// request.
+func NewClient(
+	apiURL string,
+	token *secret.Value,
+	timeout time.Duration,
+) (*Client, error) {
+	if _, err := url.Parse(apiURL); err != nil {
+		return nil, fmt.Errorf("couldn't parse API URL %s: %v", apiURL, err)
+	}
+	return &Client{
+		apiURL:     apiURL,
+		token:      token,
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// query executes the given GraphQL query, and unmarshals the data in the
+// response into data.
+func (c *Client) query(ctx context.Context, query string, data any) error {
+	body, err := json.Marshal(graphQLRequest{Query: query})
+	if err != nil {
+		return fmt.Errorf("couldn't marshal query: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL,
+		bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("couldn't construct query request: %v", err)
+	}
+	token, err := c.token.Get()
+	if err != nil {
+		return fmt.Errorf("couldn't load token: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't query Lagoon API: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad query response: %d\n%s", res.StatusCode, resBody)
+	}
+	var gqlRes graphQLResponse
+	if err = json.NewDecoder(res.Body).Decode(&gqlRes); err != nil {
+		return fmt.Errorf("couldn't decode query response: %v", err)
+	}
+	if len(gqlRes.Errors) > 0 {
+		return fmt.Errorf("query error: %s", gqlRes.Errors[0].Message)
+	}
+	if err = json.Unmarshal(gqlRes.Data, data); err != nil {
+		return fmt.Errorf("couldn't unmarshal query response data: %v", err)
+	}
+	return nil
+}
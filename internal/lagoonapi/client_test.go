@@ -0,0 +1,166 @@
+package lagoonapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoonapi"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+)
+
+const testToken = "test-token"
+
+// newTestAPIServer sets up a mock Lagoon API which responds to GraphQL
+// queries with the test data for the top-level field in the query. If
+// errorResponse is true, it responds with a GraphQL error instead.
+func newTestAPIServer(tt *testing.T, errorResponse bool) *httptest.Server {
+	return newCountingTestAPIServer(tt, errorResponse, map[string]int{})
+}
+
+// newCountingTestAPIServer is like newTestAPIServer, but it also counts the
+// queries for each top-level field in queries.
+func newCountingTestAPIServer(
+	tt *testing.T,
+	errorResponse bool,
+	queries map[string]int,
+) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+testToken {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var req struct {
+				Query string `json:"query"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				tt.Fatal(err)
+			}
+			testDataPath := "testdata/error.json"
+			if !errorResponse {
+				for _, field := range []string{
+					"allProjects", "allGroups", "allOrganizations"} {
+					if strings.Contains(req.Query, field) {
+						testDataPath = "testdata/" + field + ".json"
+						mu.Lock()
+						queries[field]++
+						mu.Unlock()
+					}
+				}
+			}
+			buf, err := os.ReadFile(testDataPath)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if _, err = w.Write(buf); err != nil {
+				tt.Fatal(err)
+			}
+		}))
+}
+
+func TestQueries(t *testing.T) {
+	queries := map[string]int{}
+	ts := newCountingTestAPIServer(t, false, queries)
+	defer ts.Close()
+	c, err := lagoonapi.NewClient(ts.URL+"/graphql",
+		secret.Static(testToken), time.Second)
+	assert.NoError(t, err, "NewClient")
+	ctx := context.Background()
+	projects, err := c.Projects(ctx)
+	assert.NoError(t, err, "Projects")
+	assert.Equal(t, []lagoondb.Project{
+		{ID: 33, Name: "foo"},
+		{ID: 34, Name: "bar"},
+	}, projects, "Projects")
+	groupProjectsMap, err := c.GroupProjectsMap(ctx)
+	assert.NoError(t, err, "GroupProjectsMap")
+	assert.Equal(t, map[string][]int{
+		"08fef1a2-9ba5-4a4c-9e1e-0e4b30b0e1a5": {33, 34},
+		"5c0d6a3e-2f7b-4a8e-b1a9-3e6f0c2d9b17": {33},
+	}, groupProjectsMap, "GroupProjectsMap")
+	organizations, err := c.Organizations(ctx)
+	assert.NoError(t, err, "Organizations")
+	assert.Equal(t, []lagoondb.Organization{
+		{ID: 1, Name: "acme"},
+		{ID: 2, Name: "empty"},
+	}, organizations, "Organizations")
+	organizationProjectsMap, err := c.OrganizationProjectsMap(ctx)
+	assert.NoError(t, err, "OrganizationProjectsMap")
+	assert.Equal(t, map[int][]int{1: {33}}, organizationProjectsMap,
+		"OrganizationProjectsMap")
+	environments, err := c.Environments(ctx)
+	assert.NoError(t, err, "Environments")
+	assert.Equal(t, []lagoondb.Environment{
+		{ID: 10, Name: "main", ProjectID: 33,
+			EnvironmentType: lagoondb.EnvironmentTypeProduction},
+		{ID: 11, Name: "pr-1", ProjectID: 33,
+			EnvironmentType: lagoondb.EnvironmentTypeDevelopment},
+		{ID: 12, Name: "main", ProjectID: 34,
+			EnvironmentType: lagoondb.EnvironmentTypeProduction},
+	}, environments, "Environments")
+	projectsMetadata, err := c.ProjectsMetadata(ctx)
+	assert.NoError(t, err, "ProjectsMetadata")
+	assert.Equal(t, map[int]map[string]string{
+		33: {"logs-retention-days": "90", "replicas": "2"},
+	}, projectsMetadata, "ProjectsMetadata")
+	assert.Equal(t, 1, queries["allProjects"], "allProjects queries")
+}
+
+func TestQueryErrors(t *testing.T) {
+	var testCases = map[string]struct {
+		token         string
+		errorResponse bool
+		expectErr     string
+	}{
+		"bad token": {
+			token:     "bad-token",
+			expectErr: "bad query response: 401",
+		},
+		"graphql error": {
+			token:         testToken,
+			errorResponse: true,
+			expectErr:     "query error: Unauthorized",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := newTestAPIServer(tt, tc.errorResponse)
+			defer ts.Close()
+			c, err := lagoonapi.NewClient(ts.URL+"/graphql",
+				secret.Static(tc.token), time.Second)
+			assert.NoError(tt, err, name)
+			_, err = c.Projects(context.Background())
+			assert.Error(tt, err, name)
+			assert.Contains(tt, err.Error(), tc.expectErr, name)
+		})
+	}
+}
+
+func TestTokenReload(t *testing.T) {
+	ts := newTestAPIServer(t, false)
+	defer ts.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("expired\n"), 0600),
+		"write expired token")
+	token, err := secret.File(tokenFile)
+	assert.NoError(t, err, "secret.File")
+	c, err := lagoonapi.NewClient(ts.URL+"/graphql", token, time.Second)
+	assert.NoError(t, err, "NewClient")
+	_, err = c.Projects(context.Background())
+	assert.Error(t, err, "expired token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte(testToken+"\n"), 0600),
+		"write rotated token")
+	_, err = c.Projects(context.Background())
+	assert.NoError(t, err, "rotated token")
+}
@@ -0,0 +1,249 @@
+package lagoonapi
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+)
+
+// project is a Lagoon project as represented in the Lagoon API.
+type project struct {
+	ID           int            `json:"id"`
+	Name         string         `json:"name"`
+	Organization *int           `json:"organization"`
+	Metadata     map[string]any `json:"metadata"`
+	Environments []environment  `json:"environments"`
+}
+
+// environment is a Lagoon environment as represented in the Lagoon API.
+type environment struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	EnvironmentType string `json:"environmentType"`
+}
+
+// group is a Lagoon group as represented in the Lagoon API.
+type group struct {
+	ID       string    `json:"id"`
+	Projects []project `json:"projects"`
+	Groups   []group   `json:"groups"`
+}
+
+// maxGroupDepth is the maximum depth of nested Lagoon groups which are read
+// from the Lagoon API. GraphQL queries can't recurse, so the query nests
+// subgroups explicitly to this depth.
+const maxGroupDepth = 8
+
+// allGroupsQuery returns a query for all the groups in Lagoon, including
+// subgroups up to maxGroupDepth.
+func allGroupsQuery() string {
+	fields := "id\nprojects {\n  id\n}"
+	for range maxGroupDepth {
+		fields = "id\nprojects {\n  id\n}\ngroups {\n" +
+			indent(fields) + "\n}"
+	}
+	return "query {\n  allGroups {\n" + indent(indent(fields)) + "\n  }\n}"
+}
+
+// indent returns s with each line indented by two spaces.
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
+
+// flattenGroups returns the given groups and all of their subgroups.
+func flattenGroups(groups []group) []group {
+	var flat []group
+	for _, g := range groups {
+		flat = append(flat, g)
+		flat = append(flat, flattenGroups(g.Groups)...)
+	}
+	return flat
+}
+
+// organization is a Lagoon organization as represented in the Lagoon API.
+type organization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// allProjects returns all the projects in Lagoon, ordered by ID.
+func (c *Client) allProjects(ctx context.Context) ([]project, error) {
+	var data struct {
+		AllProjects []project `json:"allProjects"`
+	}
+	err := c.query(ctx, `query {
+  allProjects {
+    id
+    name
+    organization
+    metadata
+    environments {
+      id
+      name
+      environmentType
+    }
+  }
+}`, &data)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(data.AllProjects, func(a, b project) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return data.AllProjects, nil
+}
+
+// cachedProjects returns the projects read by the most recent call to
+// Projects. If Projects has not been called, the projects are read from the
+// Lagoon API.
+//
+// A single query for all projects returns their organizations, environments,
+// and metadata, and the projects are read first in each sync. So reusing them
+// avoids querying all the projects again for each of those.
+func (c *Client) cachedProjects(ctx context.Context) ([]project, error) {
+	c.projectsMu.Lock()
+	projects := c.projects
+	c.projectsMu.Unlock()
+	if projects != nil {
+		return projects, nil
+	}
+	return c.allProjects(ctx)
+}
+
+// Projects returns a slice of all Projects in Lagoon, ordered by ID.
+func (c *Client) Projects(ctx context.Context) ([]lagoondb.Project, error) {
+	projects, err := c.allProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.projectsMu.Lock()
+	c.projects = projects
+	c.projectsMu.Unlock()
+	var result []lagoondb.Project
+	for _, p := range projects {
+		result = append(result, lagoondb.Project{ID: p.ID, Name: p.Name})
+	}
+	return result, nil
+}
+
+// GroupProjectsMap returns a map of Group (UU)IDs to Project IDs, ordered by
+// project ID. This denotes Project Group membership in Lagoon. Subgroups are
+// included, to match the lagoondb client.
+func (c *Client) GroupProjectsMap(
+	ctx context.Context,
+) (map[string][]int, error) {
+	var data struct {
+		AllGroups []group `json:"allGroups"`
+	}
+	if err := c.query(ctx, allGroupsQuery(), &data); err != nil {
+		return nil, err
+	}
+	groupProjectsMap := map[string][]int{}
+	for _, g := range flattenGroups(data.AllGroups) {
+		// groups without projects are omitted, to match the lagoondb client
+		for _, p := range g.Projects {
+			groupProjectsMap[g.ID] = append(groupProjectsMap[g.ID], p.ID)
+		}
+	}
+	for _, pids := range groupProjectsMap {
+		slices.Sort(pids)
+	}
+	return groupProjectsMap, nil
+}
+
+// Organizations returns a slice of all Organizations in Lagoon, ordered by
+// ID.
+func (c *Client) Organizations(
+	ctx context.Context,
+) ([]lagoondb.Organization, error) {
+	var data struct {
+		AllOrganizations []organization `json:"allOrganizations"`
+	}
+	err := c.query(ctx, `query {
+  allOrganizations {
+    id
+    name
+  }
+}`, &data)
+	if err != nil {
+		return nil, err
+	}
+	var organizations []lagoondb.Organization
+	for _, o := range data.AllOrganizations {
+		organizations = append(organizations,
+			lagoondb.Organization{ID: o.ID, Name: o.Name})
+	}
+	slices.SortFunc(organizations, func(a, b lagoondb.Organization) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return organizations, nil
+}
+
+// OrganizationProjectsMap returns a map of Organization IDs to Project IDs,
+// ordered by project ID. Projects which don't belong to an organization are
+// omitted.
+func (c *Client) OrganizationProjectsMap(
+	ctx context.Context,
+) (map[int][]int, error) {
+	projects, err := c.cachedProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	organizationProjectsMap := map[int][]int{}
+	for _, p := range projects {
+		if p.Organization == nil {
+			continue
+		}
+		organizationProjectsMap[*p.Organization] =
+			append(organizationProjectsMap[*p.Organization], p.ID)
+	}
+	return organizationProjectsMap, nil
+}
+
+// Environments returns a slice of all the Environments in Lagoon which have
+// not been deleted, ordered by project ID and environment ID.
+func (c *Client) Environments(
+	ctx context.Context,
+) ([]lagoondb.Environment, error) {
+	projects, err := c.cachedProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var environments []lagoondb.Environment
+	for _, p := range projects {
+		envs := slices.Clone(p.Environments)
+		slices.SortFunc(envs, func(a, b environment) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+		for _, e := range envs {
+			environments = append(environments, lagoondb.Environment{
+				ID:              e.ID,
+				Name:            e.Name,
+				ProjectID:       p.ID,
+				EnvironmentType: strings.ToLower(e.EnvironmentType),
+			})
+		}
+	}
+	return environments, nil
+}
+
+// ProjectsMetadata returns a map of Project IDs to the metadata of each
+// project in Lagoon. Projects without metadata are omitted.
+func (c *Client) ProjectsMetadata(
+	ctx context.Context,
+) (map[int]map[string]string, error) {
+	projects, err := c.cachedProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projectsMetadata := map[int]map[string]string{}
+	for _, p := range projects {
+		if len(p.Metadata) > 0 {
+			projectsMetadata[p.ID] = lagoondb.MetadataStrings(p.Metadata)
+		}
+	}
+	return projectsMetadata, nil
+}
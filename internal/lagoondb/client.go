@@ -4,10 +4,14 @@ package lagoondb
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
 )
 
 // Client is a Lagoon API-DB client
@@ -21,6 +25,40 @@ type Project struct {
 	Name string `db:"name"`
 }
 
+// Environment types.
+const (
+	EnvironmentTypeProduction  = "production"
+	EnvironmentTypeDevelopment = "development"
+)
+
+// Environment is a Lagoon environment.
+type Environment struct {
+	ID              int    `db:"id"`
+	Name            string `db:"name"`
+	ProjectID       int    `db:"project"`
+	EnvironmentType string `db:"environment_type"`
+}
+
+// Organization is a Lagoon organization.
+type Organization struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+// organizationProjectMapping maps Lagoon organization ID to project ID.
+// This type is only used for database unmarshalling.
+type organizationProjectMapping struct {
+	OrganizationID int `db:"organization"`
+	ProjectID      int `db:"id"`
+}
+
+// projectMetadata is the JSON metadata of a Lagoon project.
+// This type is only used for database unmarshalling.
+type projectMetadata struct {
+	ProjectID int            `db:"id"`
+	Metadata  sql.NullString `db:"metadata"`
+}
+
 // groupProjectMapping maps Lagoon group ID to project ID.
 // This type is only used for database unmarshalling.
 type groupProjectMapping struct {
@@ -31,10 +69,33 @@ type groupProjectMapping struct {
 // ErrNoResult is returned by client methods if there is no result.
 var ErrNoResult = errors.New("no rows in result set")
 
-// NewClient returns a new Lagoon DB Client.
-func NewClient(ctx context.Context, dsn string) (*Client, error) {
-	db, err := sqlx.ConnectContext(ctx, "mysql", dsn)
+// NewClient returns a new Lagoon DB Client. The password is loaded each time
+// a new database connection is established, so that a rotated password is
+// used without restarting.
+func NewClient(
+	ctx context.Context,
+	cfg *mysql.Config,
+	password *secret.Value,
+) (*Client, error) {
+	err := cfg.Apply(mysql.BeforeConnect(
+		func(_ context.Context, c *mysql.Config) error {
+			passwd, err := password.Get()
+			if err != nil {
+				return fmt.Errorf("couldn't load password: %v", err)
+			}
+			c.Passwd = passwd
+			return nil
+		}))
 	if err != nil {
+		return nil, fmt.Errorf("couldn't configure connector: %v", err)
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't construct connector: %v", err)
+	}
+	db := sqlx.NewDb(sql.OpenDB(connector), "mysql")
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
 	// https://github.com/go-sql-driver/mysql#important-settings
@@ -44,13 +105,15 @@ func NewClient(ctx context.Context, dsn string) (*Client, error) {
 	return &Client{db: db}, nil
 }
 
-// Projects returns a slice of all Projects in the Lagoon API DB.
+// Projects returns a slice of all Projects in the Lagoon API DB, ordered by
+// ID.
 func (c *Client) Projects(ctx context.Context) ([]Project, error) {
 	// run query
 	var projects []Project
 	err := c.db.SelectContext(ctx, &projects, `
 	SELECT id, name
-	FROM project`)
+	FROM project
+	ORDER BY id`)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoResult
@@ -60,15 +123,16 @@ func (c *Client) Projects(ctx context.Context) ([]Project, error) {
 	return projects, nil
 }
 
-// GroupProjectsMap returns a map of Group (UU)IDs to Project IDs.
-// This denotes Project Group membership in Lagoon.
+// GroupProjectsMap returns a map of Group (UU)IDs to Project IDs, ordered by
+// project ID. This denotes Project Group membership in Lagoon.
 func (c *Client) GroupProjectsMap(
 	ctx context.Context,
 ) (map[string][]int, error) {
 	var gpms []groupProjectMapping
 	err := c.db.SelectContext(ctx, &gpms, `
 	SELECT group_id, project_id
-	FROM kc_group_projects`)
+	FROM kc_group_projects
+	ORDER BY group_id, project_id`)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoResult
@@ -84,3 +148,114 @@ func (c *Client) GroupProjectsMap(
 	}
 	return groupProjectsMap, nil
 }
+
+// Organizations returns a slice of all Organizations in the Lagoon API DB,
+// ordered by ID.
+func (c *Client) Organizations(ctx context.Context) ([]Organization, error) {
+	var organizations []Organization
+	err := c.db.SelectContext(ctx, &organizations, `
+	SELECT id, name
+	FROM organization
+	ORDER BY id`)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoResult
+		}
+		return nil, err
+	}
+	return organizations, nil
+}
+
+// OrganizationProjectsMap returns a map of Organization IDs to Project IDs,
+// ordered by project ID. This denotes Project Organization membership in
+// Lagoon. Projects which don't belong to an organization are omitted.
+func (c *Client) OrganizationProjectsMap(
+	ctx context.Context,
+) (map[int][]int, error) {
+	var opms []organizationProjectMapping
+	err := c.db.SelectContext(ctx, &opms, `
+	SELECT organization, id
+	FROM project
+	WHERE organization IS NOT NULL
+	ORDER BY organization, id`)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoResult
+		}
+		return nil, err
+	}
+	organizationProjectsMap := map[int][]int{}
+	for _, opm := range opms {
+		organizationProjectsMap[opm.OrganizationID] =
+			append(organizationProjectsMap[opm.OrganizationID], opm.ProjectID)
+	}
+	return organizationProjectsMap, nil
+}
+
+// Environments returns a slice of all the Environments which have not been
+// deleted in the Lagoon API DB, ordered by project ID and environment ID.
+func (c *Client) Environments(ctx context.Context) ([]Environment, error) {
+	var environments []Environment
+	err := c.db.SelectContext(ctx, &environments, `
+	SELECT id, name, project, environment_type
+	FROM environment
+	WHERE deleted = '0000-00-00 00:00:00'
+	ORDER BY project, id`)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoResult
+		}
+		return nil, err
+	}
+	return environments, nil
+}
+
+// MetadataStrings converts decoded Lagoon project metadata to a map of
+// strings. Lagoon stores metadata values as strings, but any other JSON value
+// is converted to its JSON representation.
+func MetadataStrings(metadata map[string]any) map[string]string {
+	strs := map[string]string{}
+	for k, v := range metadata {
+		if str, ok := v.(string); ok {
+			strs[k] = str
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			continue // unreachable for decoded JSON values
+		}
+		strs[k] = string(data)
+	}
+	return strs
+}
+
+// ProjectsMetadata returns a map of Project IDs to the metadata of each
+// project in the Lagoon API DB. Projects without metadata are omitted.
+func (c *Client) ProjectsMetadata(
+	ctx context.Context,
+) (map[int]map[string]string, error) {
+	var pms []projectMetadata
+	err := c.db.SelectContext(ctx, &pms, `
+	SELECT id, metadata
+	FROM project
+	WHERE metadata IS NOT NULL
+	ORDER BY id`)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoResult
+		}
+		return nil, err
+	}
+	projectsMetadata := map[int]map[string]string{}
+	for _, pm := range pms {
+		var metadata map[string]any
+		if err = json.Unmarshal([]byte(pm.Metadata.String), &metadata); err != nil {
+			return nil, fmt.Errorf("couldn't unmarshal metadata of project %d: %v",
+				pm.ProjectID, err)
+		}
+		if len(metadata) > 0 {
+			projectsMetadata[pm.ProjectID] = MetadataStrings(metadata)
+		}
+	}
+	return projectsMetadata, nil
+}
@@ -2,13 +2,14 @@
 package opensearch
 
 import (
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sigv4"
 	"go.uber.org/zap"
 )
 
@@ -22,36 +23,42 @@ type Client struct {
 	httpClient *http.Client
 	log        *zap.Logger
 	searchSize uint
+
+	flavourMu sync.Mutex
+	flavour   string
 }
 
-// NewClient creates a new Opensearch client.
+// NewClient creates a new Opensearch client. The transport is usually a
+// tlsconfig.Transport. If signer is not nil, requests are signed with AWS
+// Signature Version 4 instead of using basic authentication. If password is
+// nil, basic authentication is not used, and the client certificate of the
+// transport authenticates the client instead. The flavour is one of the
+// Flavour* constants, and determines the path prefix of the security plugin
+// REST API.
 func NewClient(
 	log *zap.Logger,
 	baseURL,
-	username,
-	password,
-	caCertificate string,
+	username string,
+	password *secret.Value,
+	transport http.RoundTripper,
+	signer *sigv4.Signer,
+	flavour string,
 	timeout time.Duration,
 ) (*Client, error) {
+	if _, ok := securityAPIPrefixes[flavour]; !ok && flavour != FlavourAuto {
+		return nil, fmt.Errorf("unknown flavour: %s", flavour)
+	}
 	// parse URL
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse base URL %s: %v", baseURL, err)
 	}
-	// parse certificate
-	block, _ := pem.Decode([]byte(caCertificate))
-	if block == nil || block.Type != "CERTIFICATE" {
-		return nil, fmt.Errorf("couldn't decode CA certificate: %v", err)
-	}
-	ca, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't parse CA certificate: %v", err)
-	}
 	// construct client
 	return &Client{
 		baseURL:    u,
-		httpClient: httpClient(username, password, ca, timeout),
+		httpClient: httpClient(username, password, transport, signer, timeout),
 		log:        log,
 		searchSize: searchSizeMax,
+		flavour:    flavour,
 	}, nil
 }
@@ -0,0 +1,143 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+)
+
+// ComponentTemplate represents an Opensearch component template.
+type ComponentTemplate struct {
+	Name                        string                      `json:"name"`
+	ComponentTemplateDefinition ComponentTemplateDefinition `json:"component_template"`
+}
+
+// ComponentTemplateDefinition contains only the definition of the
+// ComponentTemplate (excluding the name), so that a valid PUT request can be
+// easily made to the Opensearch API.
+type ComponentTemplateDefinition struct {
+	Template Template       `json:"template"`
+	Version  *int           `json:"version,omitempty"`
+	Meta     map[string]any `json:"_meta,omitempty"`
+}
+
+// ComponentTemplatesSlice is used only for unmarshalling the JSON data
+// returned by the Opensearch component templates API.
+type ComponentTemplatesSlice struct {
+	ComponentTemplates []ComponentTemplate `json:"component_templates"`
+}
+
+// componentTemplatesMap unmarshals the data returned from the Opensearch
+// component templates API and returns it as a map of names to
+// ComponentTemplate objects.
+func componentTemplatesMap(
+	cts *ComponentTemplatesSlice) map[string]ComponentTemplate {
+	ctm := map[string]ComponentTemplate{}
+	for _, t := range cts.ComponentTemplates {
+		ctm[t.Name] = t
+	}
+	return ctm
+}
+
+// RawComponentTemplates returns the raw JSON component templates
+// representation from the Opensearch API.
+func (c *Client) RawComponentTemplates(ctx context.Context) ([]byte, error) {
+	url := *c.baseURL
+	url.Path = path.Join(c.baseURL.Path, "/_component_template/")
+	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+	if err != nil {
+		return nil,
+			fmt.Errorf("couldn't construct component template request: %v", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get component template: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("bad component template response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// ComponentTemplates returns all Opensearch ComponentTemplates.
+func (c *Client) ComponentTemplates(
+	ctx context.Context) (map[string]ComponentTemplate, error) {
+	data, err := c.RawComponentTemplates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"couldn't get component templates from Opensearch API: %v", err)
+	}
+	var cts ComponentTemplatesSlice
+	if err := json.Unmarshal(data, &cts); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal component templates: %v", err)
+	}
+	return componentTemplatesMap(&cts), nil
+}
+
+// CreateComponentTemplate creates the given component template in Opensearch,
+// or replaces it if it already exists.
+func (c *Client) CreateComponentTemplate(ctx context.Context, name string,
+	ct *ComponentTemplate) error {
+	// Marshal payload. Payload only consists of the ComponentTemplateDefinition
+	// because the name field is not writable.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(ct.ComponentTemplateDefinition); err != nil {
+		return fmt.Errorf("couldn't marshal component template: %v", err)
+	}
+	// construct request
+	url := *c.baseURL
+	url.Path = path.Join(c.baseURL.Path, "/_component_template/", name)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url.String(), &buf)
+	if err != nil {
+		return fmt.Errorf(
+			"couldn't construct create component template request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// make request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't create component template: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad create component template response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return nil
+}
+
+// DeleteComponentTemplate deletes the named component template from
+// Opensearch. Opensearch refuses to delete a component template which is
+// used by an index template.
+func (c *Client) DeleteComponentTemplate(ctx context.Context,
+	name string) error {
+	// construct request
+	url := *c.baseURL
+	url.Path = path.Join(c.baseURL.Path, "/_component_template/", name)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url.String(), nil)
+	if err != nil {
+		return fmt.Errorf(
+			"couldn't construct delete component template request: %v", err)
+	}
+	// make request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't delete component template: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad delete component template response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package opensearch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func TestComponentTemplatesUnmarshal(t *testing.T) {
+	version := 1
+	var testCases = map[string]struct {
+		input  string
+		expect map[string]opensearch.ComponentTemplate
+	}{
+		"unmarshal component templates": {
+			input: "testdata/componenttemplates.json",
+			expect: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {
+					Name: "lagoon-kubernetes",
+					ComponentTemplateDefinition: opensearch.ComponentTemplateDefinition{
+						Template: opensearch.Template{
+							Mappings: &opensearch.Mappings{
+								Properties: map[string]any{
+									"kubernetes": map[string]any{
+										"properties": map[string]any{
+											"namespace_name": map[string]any{
+												"type": "keyword",
+											},
+										},
+									},
+								},
+							},
+						},
+						Version: &version,
+						Meta: map[string]any{
+							"managed_by": "lagoon-opensearch-sync",
+						},
+					},
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			data, err := os.ReadFile(tc.input)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			// check for missing fields
+			var cts opensearch.ComponentTemplatesSlice
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if err = decoder.Decode(&cts); err != nil {
+				tt.Fatal(err)
+			}
+			ctm := opensearch.ComponentTemplatesMap(&cts)
+			assert.Equal(tt, tc.expect, ctm, name)
+		})
+	}
+}
+
+func TestCreateComponentTemplate(t *testing.T) {
+	var testCases = map[string]struct {
+		status    int
+		expectErr bool
+	}{
+		"success":     {status: http.StatusOK},
+		"bad request": {status: http.StatusBadRequest, expectErr: true},
+	}
+	ct := opensearch.ComponentTemplate{
+		Name: "lagoon-kubernetes",
+		ComponentTemplateDefinition: opensearch.ComponentTemplateDefinition{
+			Template: opensearch.Template{
+				Settings: map[string]any{"number_of_replicas": 1},
+			},
+		},
+	}
+	expectBody := `{"template":{"settings":{"number_of_replicas":1}}}` + "\n"
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(tt, "PUT", r.Method, "method")
+					assert.Equal(tt, "/_component_template/lagoon-kubernetes",
+						r.URL.Path, "path")
+					body, err := io.ReadAll(r.Body)
+					assert.NoError(tt, err, "read body")
+					assert.Equal(tt, expectBody, string(body), "body")
+					w.WriteHeader(tc.status)
+				}))
+			defer ts.Close()
+			c, err := opensearch.NewTestClient(ts.URL, 10)
+			assert.NoError(tt, err, name)
+			err = c.CreateComponentTemplate(context.Background(), ct.Name, &ct)
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
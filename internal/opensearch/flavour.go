@@ -0,0 +1,166 @@
+package opensearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Cluster flavours. The flavour determines the path prefix of the plugin REST
+// APIs.
+const (
+	// FlavourAuto detects the flavour from the root endpoint of the cluster.
+	FlavourAuto = "auto"
+	// FlavourOpensearch is an Opensearch cluster.
+	FlavourOpensearch = "opensearch"
+	// FlavourOpendistro is an Open Distro for Elasticsearch cluster.
+	FlavourOpendistro = "opendistro"
+)
+
+// securityAPIPrefixes maps cluster flavours to security plugin REST API path
+// prefixes.
+var securityAPIPrefixes = map[string]string{
+	FlavourOpensearch: "/_plugins/_security/api",
+	FlavourOpendistro: "/_opendistro/_security/api",
+}
+
+// ismAPIPrefixes maps cluster flavours to Index State Management plugin REST
+// API path prefixes.
+var ismAPIPrefixes = map[string]string{
+	FlavourOpensearch: "/_plugins/_ism",
+	FlavourOpendistro: "/_opendistro/_ism",
+}
+
+// rootResponse is the response from the root endpoint of the cluster.
+type rootResponse struct {
+	Version struct {
+		Distribution string `json:"distribution"`
+		Number       string `json:"number"`
+	} `json:"version"`
+}
+
+// opendistroMajorVersions are the major versions of Elasticsearch on which
+// the supported versions of Open Distro for Elasticsearch were released.
+//
+// Open Distro 0.x on Elasticsearch 6 is not supported, because its security
+// plugin uses the legacy configuration format, in which roles have cluster,
+// indices, and tenants fields and a readonly flag instead of the permissions
+// and the hidden, reserved, and static flags of the Role struct.
+var opendistroMajorVersions = []string{"7"}
+
+// parseFlavour returns the flavour and version number of the cluster, given
+// the response from its root endpoint. Opensearch sets the distribution
+// field. Elasticsearch, and so Open Distro for Elasticsearch, does not.
+//
+// Opensearch forked its security plugin from Open Distro 1.x, and the roles,
+// tenants, and rolesmapping payloads of the two are the same apart from the
+// path prefix. TestOpendistroSecurityRoundTrip decodes Open Distro responses
+// into the same structs as Opensearch, and checks that the encoded request
+// payloads contain only the fields which Open Distro returns. Differences in
+// ISM explain responses are handled by ismExplainPolicyIDKeys.
+//
+// The version number is only used to reject clusters which can't be a
+// supported version of Open Distro for Elasticsearch. An error is returned
+// for any cluster which is not recognised.
+func parseFlavour(data []byte) (string, string, error) {
+	var root rootResponse
+	if err := json.Unmarshal(data, &root); err != nil {
+		return "", "", fmt.Errorf("couldn't unmarshal root response: %v", err)
+	}
+	if root.Version.Number == "" {
+		return "", "", fmt.Errorf("missing version number in root response")
+	}
+	switch root.Version.Distribution {
+	case "opensearch":
+		return FlavourOpensearch, root.Version.Number, nil
+	case "":
+		major, _, _ := strings.Cut(root.Version.Number, ".")
+		if slices.Contains(opendistroMajorVersions, major) {
+			return FlavourOpendistro, root.Version.Number, nil
+		}
+		return "", "", fmt.Errorf(
+			"unsupported Elasticsearch version %s", root.Version.Number)
+	default:
+		return "", "", fmt.Errorf("unsupported distribution %s",
+			root.Version.Distribution)
+	}
+}
+
+// detectFlavour requests the root endpoint of the cluster and returns its
+// flavour.
+func (c *Client) detectFlavour(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("couldn't construct root request: %v", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get root: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read root response: %v", err)
+	}
+	if res.StatusCode > 299 {
+		return "", fmt.Errorf("bad root response: %d\n%s", res.StatusCode, body)
+	}
+	flavour, version, err := parseFlavour(body)
+	if err != nil {
+		return "", err
+	}
+	c.log.Info("detected cluster flavour",
+		zap.String("flavour", flavour), zap.String("version", version))
+	return flavour, nil
+}
+
+// pluginAPIURL returns the URL of the given plugin REST API path elements,
+// where prefixes maps cluster flavours to the path prefix of the plugin REST
+// API. If the flavour of the cluster has not been configured, it is detected
+// on the first call.
+func (c *Client) pluginAPIURL(
+	ctx context.Context,
+	prefixes map[string]string,
+	elem ...string,
+) (*url.URL, error) {
+	c.flavourMu.Lock()
+	defer c.flavourMu.Unlock()
+	if c.flavour == FlavourAuto {
+		flavour, err := c.detectFlavour(ctx)
+		if err != nil {
+			// detection is retried on the next call
+			return nil, fmt.Errorf("couldn't detect cluster flavour: %v", err)
+		}
+		c.flavour = flavour
+	}
+	u := *c.baseURL
+	u.Path = path.Join(append(
+		[]string{c.baseURL.Path, prefixes[c.flavour]}, elem...)...)
+	return &u, nil
+}
+
+// securityAPIURL returns the URL of the given security plugin REST API
+// path elements.
+func (c *Client) securityAPIURL(
+	ctx context.Context,
+	elem ...string,
+) (*url.URL, error) {
+	return c.pluginAPIURL(ctx, securityAPIPrefixes, elem...)
+}
+
+// ismAPIURL returns the URL of the given Index State Management plugin REST
+// API path elements.
+func (c *Client) ismAPIURL(
+	ctx context.Context,
+	elem ...string,
+) (*url.URL, error) {
+	return c.pluginAPIURL(ctx, ismAPIPrefixes, elem...)
+}
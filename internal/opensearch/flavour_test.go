@@ -0,0 +1,214 @@
+package opensearch_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"go.uber.org/zap"
+)
+
+func TestParseFlavour(t *testing.T) {
+	var testCases = map[string]struct {
+		input         string
+		expectFlavour string
+		expectVersion string
+		expectError   bool
+	}{
+		"opensearch": {
+			input:         "testdata/rootOpensearch.json",
+			expectFlavour: opensearch.FlavourOpensearch,
+			expectVersion: "2.19.1",
+		},
+		"opendistro": {
+			input:         "testdata/rootOpendistro.json",
+			expectFlavour: opensearch.FlavourOpendistro,
+			expectVersion: "7.10.2",
+		},
+		"opendistro on elasticsearch 6": {
+			input:       "testdata/rootOpendistro6.json",
+			expectError: true,
+		},
+		"elasticsearch 8": {
+			input:       "testdata/rootElasticsearch8.json",
+			expectError: true,
+		},
+		"unknown distribution": {
+			input:       "testdata/rootUnknown.json",
+			expectError: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			data, err := os.ReadFile(tc.input)
+			assert.NoError(tt, err, name)
+			flavour, version, err := opensearch.ParseFlavour(data)
+			if tc.expectError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectFlavour, flavour, name)
+			assert.Equal(tt, tc.expectVersion, version, name)
+		})
+	}
+}
+
+func TestSecurityAPIPrefix(t *testing.T) {
+	var testCases = map[string]struct {
+		flavour    string
+		root       string
+		expectPath string
+	}{
+		"detect opensearch": {
+			flavour:    opensearch.FlavourAuto,
+			root:       "testdata/rootOpensearch.json",
+			expectPath: "/_plugins/_security/api/tenants",
+		},
+		"detect opendistro": {
+			flavour:    opensearch.FlavourAuto,
+			root:       "testdata/rootOpendistro.json",
+			expectPath: "/_opendistro/_security/api/tenants",
+		},
+		"force opendistro": {
+			flavour:    opensearch.FlavourOpendistro,
+			root:       "testdata/rootOpensearch.json",
+			expectPath: "/_opendistro/_security/api/tenants",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var rootRequests int
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					var data []byte
+					var err error
+					switch r.URL.Path {
+					case "/":
+						rootRequests++
+						data, err = os.ReadFile(tc.root)
+					case tc.expectPath:
+						data, err = os.ReadFile("testdata/tenants.json")
+					default:
+						http.NotFound(w, r)
+						return
+					}
+					if err != nil {
+						tt.Fatal(err)
+					}
+					if _, err = w.Write(data); err != nil {
+						tt.Fatal(err)
+					}
+				}))
+			defer ts.Close()
+			c, err := opensearch.NewClient(zap.NewNop(), ts.URL, "admin", nil,
+				http.DefaultTransport, nil, tc.flavour, time.Second)
+			assert.NoError(tt, err, name)
+			// the flavour is only detected once
+			for range 2 {
+				_, err = c.Tenants(context.Background())
+				assert.NoError(tt, err, name)
+			}
+			if tc.flavour == opensearch.FlavourAuto {
+				assert.Equal(tt, 1, rootRequests, name)
+			} else {
+				assert.Equal(tt, 0, rootRequests, name)
+			}
+		})
+	}
+}
+
+// TestOpendistroSecurityRoundTrip checks that the Lagoon objects in Open
+// Distro security API responses decode into the same structs as Opensearch,
+// and that the payload encoded from each struct for a PUT request contains
+// exactly the fields of the response other than the read-only hidden,
+// reserved, and static flags.
+func TestOpendistroSecurityRoundTrip(t *testing.T) {
+	var testCases = map[string]struct {
+		input string
+		get   func(context.Context, *opensearch.Client) (map[string]any, error)
+	}{
+		"roles": {
+			input: "testdata/rolesOpendistro.json",
+			get: func(ctx context.Context, c *opensearch.Client) (
+				map[string]any, error) {
+				roles, err := c.Roles(ctx)
+				payloads := map[string]any{}
+				for name, role := range roles {
+					payloads[name] = role.RolePermissions
+				}
+				return payloads, err
+			},
+		},
+		"tenants": {
+			input: "testdata/tenantsOpendistro.json",
+			get: func(ctx context.Context, c *opensearch.Client) (
+				map[string]any, error) {
+				tenants, err := c.Tenants(ctx)
+				payloads := map[string]any{}
+				for name, tenant := range tenants {
+					payloads[name] = tenant.TenantDescription
+				}
+				return payloads, err
+			},
+		},
+		"rolesmapping": {
+			input: "testdata/rolesmappingOpendistro.json",
+			get: func(ctx context.Context, c *opensearch.Client) (
+				map[string]any, error) {
+				rolesmapping, err := c.RolesMapping(ctx)
+				payloads := map[string]any{}
+				for name, rm := range rolesmapping {
+					payloads[name] = rm.RoleMappingPermissions
+				}
+				return payloads, err
+			},
+		},
+	}
+	// the sync only writes Lagoon group and project objects
+	lagoonObjects := []string{"drupal-example", "p11"}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			data, err := os.ReadFile(tc.input)
+			assert.NoError(tt, err, name)
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != "/_opendistro/_security/api/"+name {
+						http.NotFound(w, r)
+						return
+					}
+					if _, err := w.Write(data); err != nil {
+						tt.Fatal(err)
+					}
+				}))
+			defer ts.Close()
+			c, err := opensearch.NewClient(zap.NewNop(), ts.URL, "admin", nil,
+				http.DefaultTransport, nil, opensearch.FlavourOpendistro, time.Second)
+			assert.NoError(tt, err, name)
+			payloads, err := tc.get(context.Background(), c)
+			assert.NoError(tt, err, name)
+			var response map[string]map[string]any
+			assert.NoError(tt, json.Unmarshal(data, &response), name)
+			for _, object := range lagoonObjects {
+				expect, ok := response[object]
+				if !ok {
+					continue
+				}
+				delete(expect, "hidden")
+				delete(expect, "reserved")
+				delete(expect, "static")
+				payload, err := json.Marshal(payloads[object])
+				assert.NoError(tt, err, name)
+				var encoded map[string]any
+				assert.NoError(tt, json.Unmarshal(payload, &encoded), name)
+				assert.Equal(tt, expect, encoded, object)
+			}
+		})
+	}
+}
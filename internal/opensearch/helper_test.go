@@ -11,8 +11,11 @@ import (
 // this test helper facilitates unit testing of private functions.
 
 var (
-	IndexTemplatesMap  = indexTemplatesMap
-	ParseIndexPatterns = parseIndexPatterns
+	ComponentTemplatesMap = componentTemplatesMap
+	IndexTemplatesMap     = indexTemplatesMap
+	ParseFlavour          = parseFlavour
+	ParseISMExplain       = parseISMExplain
+	ParseIndexPatterns    = parseIndexPatterns
 )
 
 // NewTestClient creates a new Opensearch client for testing.
@@ -29,5 +32,6 @@ func NewTestClient(
 		httpClient: http.DefaultClient,
 		log:        zap.Must(zap.NewDevelopment()),
 		searchSize: searchSize,
+		flavour:    FlavourOpensearch,
 	}, nil
 }
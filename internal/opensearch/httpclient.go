@@ -1,49 +1,61 @@
 package opensearch
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sigv4"
 )
 
 // AuthenticatedRoundTripper implements the http.RoundTripper interface
 type AuthenticatedRoundTripper struct {
 	roundTripper http.RoundTripper
 	username     string
-	password     string
+	password     *secret.Value
 }
 
 // RoundTrip sets the basic authentication header and then handles the request
 // using a custom transport with which validates the connection using the
-// configured CA.
+// configured CA. The password is loaded on each request, so that a rotated
+// password is used without restarting.
 func (art *AuthenticatedRoundTripper) RoundTrip(
 	req *http.Request,
 ) (*http.Response, error) {
-	req.SetBasicAuth(art.username, art.password)
+	password, err := art.password.Get()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load password: %v", err)
+	}
+	req.SetBasicAuth(art.username, password)
 	return art.roundTripper.RoundTrip(req)
 }
 
-// ca is the PEM encoded CA certificate
+// httpClient constructs an http.Client using the given transport. If a signer
+// is given, requests are signed with AWS Signature Version 4. Otherwise if a
+// password is given, requests use basic authentication. Otherwise
+// authentication relies on the client certificate in the TLS configuration
+// of the transport.
 func httpClient(
-	username,
-	password string,
-	ca *x509.Certificate,
+	username string,
+	password *secret.Value,
+	transport http.RoundTripper,
+	signer *sigv4.Signer,
 	timeout time.Duration,
 ) *http.Client {
-	cp := x509.NewCertPool()
-	cp.AddCert(ca)
-	// construct http.Client with custom CA and automatic basic auth
+	rt := transport
+	if signer != nil {
+		rt = sigv4.NewRoundTripper(rt, signer)
+	} else if password != nil {
+		// automatic basic auth
+		rt = &AuthenticatedRoundTripper{
+			roundTripper: rt,
+			username:     username,
+			password:     password,
+		}
+	}
 	return &http.Client{
-		Timeout: timeout,
-		Transport: &AuthenticatedRoundTripper{
-			roundTripper: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					RootCAs: cp,
-				},
-			},
-			username: username,
-			password: password,
-		},
+		Timeout:   timeout,
+		Transport: rt,
 	}
 }
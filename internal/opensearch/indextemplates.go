@@ -10,28 +10,58 @@ import (
 	"path"
 )
 
-// Mapping represents a field mapping.
-type Mapping struct {
-	Type            string `json:"type"`
-	IgnoreMalformed bool   `json:"ignore_malformed"`
-}
-
-// DynamicTemplate represents a dynamic template.
+// DynamicTemplate represents a dynamic template. The field mapping is not
+// modelled, since any mapping parameter may appear in it.
 type DynamicTemplate struct {
-	MatchMappingType string  `json:"match_mapping_type,omitempty"`
-	MatchPattern     string  `json:"match_pattern,omitempty"`
-	Match            string  `json:"match"`
-	Mapping          Mapping `json:"mapping"`
+	MatchMappingType string         `json:"match_mapping_type,omitempty"`
+	MatchPattern     string         `json:"match_pattern,omitempty"`
+	Match            string         `json:"match,omitempty"`
+	Unmatch          string         `json:"unmatch,omitempty"`
+	PathMatch        string         `json:"path_match,omitempty"`
+	PathUnmatch      string         `json:"path_unmatch,omitempty"`
+	Mapping          map[string]any `json:"mapping"`
 }
 
-// Mappings represents Opensearch index mappings.
+// Mappings represents Opensearch index mappings. Field mappings in Properties
+// are not modelled, since any mapping parameter may appear in them.
 type Mappings struct {
-	DynamicTemplates []map[string]DynamicTemplate `json:"dynamic_templates"`
+	DynamicTemplates   []map[string]DynamicTemplate `json:"dynamic_templates,omitempty"`
+	Properties         map[string]any               `json:"properties,omitempty"`
+	Dynamic            any                          `json:"dynamic,omitempty"`
+	DateDetection      *bool                        `json:"date_detection,omitempty"`
+	NumericDetection   *bool                        `json:"numeric_detection,omitempty"`
+	DynamicDateFormats []string                     `json:"dynamic_date_formats,omitempty"`
+	Source             map[string]any               `json:"_source,omitempty"`
+	Routing            map[string]any               `json:"_routing,omitempty"`
+	Meta               map[string]any               `json:"_meta,omitempty"`
+}
+
+// Alias represents an index alias in a template.
+type Alias struct {
+	Filter        map[string]any `json:"filter,omitempty"`
+	IndexRouting  string         `json:"index_routing,omitempty"`
+	Routing       string         `json:"routing,omitempty"`
+	SearchRouting string         `json:"search_routing,omitempty"`
+	IsHidden      *bool          `json:"is_hidden,omitempty"`
+	IsWriteIndex  *bool          `json:"is_write_index,omitempty"`
 }
 
-// Template represents an Opensearch template.
+// Template represents an Opensearch template. Settings may be given either
+// nested or with dotted keys, and with or without the "index." prefix.
 type Template struct {
-	Mappings *Mappings `json:"mappings"`
+	Settings map[string]any   `json:"settings,omitempty"`
+	Mappings *Mappings        `json:"mappings,omitempty"`
+	Aliases  map[string]Alias `json:"aliases,omitempty"`
+}
+
+// TimestampField represents the timestamp field of a data stream.
+type TimestampField struct {
+	Name string `json:"name"`
+}
+
+// DataStream represents the data stream configuration of an index template.
+type DataStream struct {
+	TimestampField *TimestampField `json:"timestamp_field,omitempty"`
 }
 
 // IndexTemplate represents an Opensearch index template.
@@ -45,9 +75,13 @@ type IndexTemplate struct {
 // so that a valid PUT request can be easily made to the Opensearch API. This
 // requires omitting the Name field.
 type IndexTemplateDefinition struct {
-	ComposedOf    []string `json:"composed_of,omitempty"`
-	IndexPatterns []string `json:"index_patterns"`
-	Template      Template `json:"template"`
+	ComposedOf    []string       `json:"composed_of,omitempty"`
+	IndexPatterns []string       `json:"index_patterns"`
+	Template      Template       `json:"template"`
+	Priority      *int           `json:"priority,omitempty"`
+	Version       *int           `json:"version,omitempty"`
+	Meta          map[string]any `json:"_meta,omitempty"`
+	DataStream    *DataStream    `json:"data_stream,omitempty"`
 }
 
 // IndexTemplatesSlice is used only for unmarshalling the JSON data returned by
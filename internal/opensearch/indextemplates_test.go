@@ -11,6 +11,7 @@ import (
 )
 
 func TestIndexTemplatesUnmarshal(t *testing.T) {
+	falseValue, priority, version := false, 100, 3
 	var testCases = map[string]struct {
 		input  string
 		expect map[string]opensearch.IndexTemplate
@@ -30,9 +31,9 @@ func TestIndexTemplatesUnmarshal(t *testing.T) {
 										"remote_addr": {
 											Match:            "remote_addr",
 											MatchMappingType: "string",
-											Mapping: opensearch.Mapping{
-												Type:            "ip",
-												IgnoreMalformed: true,
+											Mapping: map[string]any{
+												"type":             "ip",
+												"ignore_malformed": true,
 											},
 										},
 									},
@@ -40,9 +41,9 @@ func TestIndexTemplatesUnmarshal(t *testing.T) {
 										"true-client-ip": {
 											Match:            "true-client-ip",
 											MatchMappingType: "string",
-											Mapping: opensearch.Mapping{
-												Type:            "ip",
-												IgnoreMalformed: true,
+											Mapping: map[string]any{
+												"type":             "ip",
+												"ignore_malformed": true,
 											},
 										},
 									},
@@ -53,6 +54,56 @@ func TestIndexTemplatesUnmarshal(t *testing.T) {
 				},
 			},
 		},
+		"unmarshal full index template schema": {
+			input: "testdata/indextemplatesFull.json",
+			expect: map[string]opensearch.IndexTemplate{
+				"application-logs": {
+					Name: "application-logs",
+					IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
+						ComposedOf:    []string{"lagoon-kubernetes"},
+						IndexPatterns: []string{"application-logs-*"},
+						Template: opensearch.Template{
+							Settings: map[string]any{
+								"index": map[string]any{
+									"number_of_shards":   "1",
+									"number_of_replicas": "1",
+									"refresh_interval":   "30s",
+								},
+							},
+							Mappings: &opensearch.Mappings{
+								Source:        map[string]any{"enabled": true},
+								DateDetection: &falseValue,
+								Dynamic:       "true",
+								Properties: map[string]any{
+									"message": map[string]any{
+										"type": "text",
+										"fields": map[string]any{
+											"keyword": map[string]any{
+												"type":         "keyword",
+												"ignore_above": float64(256),
+											},
+										},
+									},
+								},
+							},
+							Aliases: map[string]opensearch.Alias{
+								"application-logs": {IsHidden: &falseValue},
+							},
+						},
+						Priority: &priority,
+						Version:  &version,
+						Meta: map[string]any{
+							"managed_by": "lagoon-opensearch-sync",
+						},
+						DataStream: &opensearch.DataStream{
+							TimestampField: &opensearch.TimestampField{
+								Name: "@timestamp",
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(tt *testing.T) {
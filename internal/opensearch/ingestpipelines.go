@@ -0,0 +1,121 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+)
+
+// IngestPipeline represents an Opensearch ingest pipeline. Processors are not
+// modelled, since each processor type has its own parameters.
+type IngestPipeline struct {
+	Description string           `json:"description,omitempty"`
+	Processors  []map[string]any `json:"processors"`
+	OnFailure   []map[string]any `json:"on_failure,omitempty"`
+	Version     *int             `json:"version,omitempty"`
+	Meta        map[string]any   `json:"_meta,omitempty"`
+}
+
+// RawIngestPipelines returns the raw JSON ingest pipelines representation
+// from the Opensearch API.
+func (c *Client) RawIngestPipelines(ctx context.Context) ([]byte, error) {
+	url := *c.baseURL
+	url.Path = path.Join(c.baseURL.Path, "/_ingest/pipeline/")
+	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+	if err != nil {
+		return nil,
+			fmt.Errorf("couldn't construct ingest pipeline request: %v", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get ingest pipeline: %v", err)
+	}
+	defer res.Body.Close()
+	// Opensearch responds with an empty object and a 404 status if there are
+	// no ingest pipelines.
+	if res.StatusCode == http.StatusNotFound {
+		return []byte("{}"), nil
+	}
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("bad ingest pipeline response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// IngestPipelines returns all Opensearch IngestPipelines, keyed by ID.
+func (c *Client) IngestPipelines(
+	ctx context.Context) (map[string]IngestPipeline, error) {
+	data, err := c.RawIngestPipelines(ctx)
+	if err != nil {
+		return nil,
+			fmt.Errorf("couldn't get ingest pipelines from Opensearch API: %v", err)
+	}
+	pipelines := map[string]IngestPipeline{}
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal ingest pipelines: %v", err)
+	}
+	return pipelines, nil
+}
+
+// CreateIngestPipeline creates the given ingest pipeline in Opensearch, or
+// replaces it if it already exists.
+func (c *Client) CreateIngestPipeline(ctx context.Context, id string,
+	p *IngestPipeline) error {
+	// marshal payload
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(p); err != nil {
+		return fmt.Errorf("couldn't marshal ingest pipeline: %v", err)
+	}
+	// construct request
+	url := *c.baseURL
+	url.Path = path.Join(c.baseURL.Path, "/_ingest/pipeline/", id)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url.String(), &buf)
+	if err != nil {
+		return fmt.Errorf("couldn't construct create ingest pipeline request: %v",
+			err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// make request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't create ingest pipeline: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad create ingest pipeline response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return nil
+}
+
+// DeleteIngestPipeline deletes the given ingest pipeline from Opensearch.
+func (c *Client) DeleteIngestPipeline(ctx context.Context, id string) error {
+	// construct request
+	url := *c.baseURL
+	url.Path = path.Join(c.baseURL.Path, "/_ingest/pipeline/", id)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url.String(), nil)
+	if err != nil {
+		return fmt.Errorf("couldn't construct delete ingest pipeline request: %v",
+			err)
+	}
+	// make request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't delete ingest pipeline: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad delete ingest pipeline response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package opensearch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func TestIngestPipelinesUnmarshal(t *testing.T) {
+	version := 1
+	var testCases = map[string]struct {
+		input  string
+		expect map[string]opensearch.IngestPipeline
+	}{
+		"unmarshal ingest pipelines": {
+			input: "testdata/ingestpipelines.json",
+			expect: map[string]opensearch.IngestPipeline{
+				"lagoon-router-logs": {
+					Description: "Enrich Lagoon router logs.",
+					Processors: []map[string]any{
+						{"geoip": map[string]any{
+							"field":          "remote_addr",
+							"target_field":   "geoip",
+							"ignore_missing": true,
+						}},
+						{"user_agent": map[string]any{
+							"field":          "http_user_agent",
+							"ignore_missing": true,
+						}},
+					},
+					OnFailure: []map[string]any{
+						{"set": map[string]any{
+							"field": "ingest_error",
+							"value": "{{ _ingest.on_failure_message }}",
+						}},
+					},
+					Version: &version,
+					Meta: map[string]any{
+						"managed_by": "lagoon-opensearch-sync",
+					},
+				},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			data, err := os.ReadFile(tc.input)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			// check for missing fields
+			var pipelines map[string]opensearch.IngestPipeline
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if err = decoder.Decode(&pipelines); err != nil {
+				tt.Fatal(err)
+			}
+			assert.Equal(tt, tc.expect, pipelines, name)
+		})
+	}
+}
+
+func TestIngestPipelinesNotFound(t *testing.T) {
+	var testCases = map[string]struct {
+		status    int
+		expectErr bool
+	}{
+		"no pipelines": {status: http.StatusNotFound},
+		"server error": {status: http.StatusInternalServerError, expectErr: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(tt, "/_ingest/pipeline", r.URL.Path, "path")
+					w.WriteHeader(tc.status)
+					_, _ = w.Write([]byte("{}"))
+				}))
+			defer ts.Close()
+			c, err := opensearch.NewTestClient(ts.URL, 10)
+			assert.NoError(tt, err, name)
+			pipelines, err := c.IngestPipelines(context.Background())
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+				assert.Equal(tt, map[string]opensearch.IngestPipeline{}, pipelines,
+					name)
+			}
+		})
+	}
+}
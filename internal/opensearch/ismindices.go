@@ -0,0 +1,172 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ismIndicesBatchSize is the maximum number of indices named in a single ISM
+// change_policy or remove request, so that the request line stays within the
+// default Opensearch limit of 4KB.
+const ismIndicesBatchSize = 50
+
+// ismExplainPolicyIDKeys are the keys of the policy ID in each index of an ISM
+// explain response. Opensearch and Open Distro return the policy ID of an
+// index which is not yet initialised under different setting names.
+var ismExplainPolicyIDKeys = []string{
+	"policy_id",
+	"index.plugins.index_state_management.policy_id",
+	"index.opendistro.index_state_management.policy_id",
+}
+
+// ISMFailedIndex represents an index which could not be changed by an ISM
+// change_policy or remove request.
+type ISMFailedIndex struct {
+	IndexName string `json:"index_name"`
+	Reason    string `json:"reason"`
+}
+
+// ISMIndicesResponse is used only for unmarshalling the JSON data returned by
+// the Opensearch ISM change_policy and remove APIs.
+type ISMIndicesResponse struct {
+	UpdatedIndices int              `json:"updated_indices"`
+	Failures       bool             `json:"failures"`
+	FailedIndices  []ISMFailedIndex `json:"failed_indices"`
+}
+
+// parseISMExplain unmarshals the data returned from the Opensearch ISM
+// explain API and returns the policy ID of each managed index, keyed by index
+// name. Indices which are not managed by ISM are omitted.
+func parseISMExplain(data []byte) (map[string]string, error) {
+	var explain map[string]json.RawMessage
+	if err := json.Unmarshal(data, &explain); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal ISM explain response: %v", err)
+	}
+	managed := map[string]string{}
+	for index, raw := range explain {
+		if index == "total_managed_indices" {
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("couldn't unmarshal ISM explain index %s: %v",
+				index, err)
+		}
+		for _, key := range ismExplainPolicyIDKeys {
+			if id, ok := fields[key].(string); ok && id != "" {
+				managed[index] = id
+				break
+			}
+		}
+	}
+	return managed, nil
+}
+
+// ISMManagedIndices returns the ID of the ISM policy which manages each index
+// matching the given index patterns, keyed by index name. Indices which are
+// not managed by ISM are omitted.
+func (c *Client) ISMManagedIndices(ctx context.Context,
+	indexPatterns []string) (map[string]string, error) {
+	u, err := c.ismAPIURL(ctx, "explain", strings.Join(indexPatterns, ","))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't construct ISM explain request: %v", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't explain ISM managed indices: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("bad ISM explain response: %d\n%s",
+			res.StatusCode, body)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read ISM explain response: %v", err)
+	}
+	return parseISMExplain(data)
+}
+
+// postISMIndices makes an ISM API request for the given action on each batch
+// of the given indices, with the given payload. An error is returned if any
+// index could not be changed.
+func (c *Client) postISMIndices(ctx context.Context, action string,
+	indices []string, payload any) error {
+	for batch := range slices.Chunk(indices, ismIndicesBatchSize) {
+		// marshal payload
+		var buf bytes.Buffer
+		if payload != nil {
+			if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+				return fmt.Errorf("couldn't marshal ISM %s request: %v", action, err)
+			}
+		}
+		// construct request
+		u, err := c.ismAPIURL(ctx, action, strings.Join(batch, ","))
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", u.String(), &buf)
+		if err != nil {
+			return fmt.Errorf("couldn't construct ISM %s request: %v", action, err)
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		// make request
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("couldn't make ISM %s request: %v", action, err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't read ISM %s response: %v", action, err)
+		}
+		if res.StatusCode > 299 {
+			return fmt.Errorf("bad ISM %s response: %d\n%s", action,
+				res.StatusCode, body)
+		}
+		// Opensearch reports failures of individual indices in a successful
+		// response
+		var r ISMIndicesResponse
+		if err = json.Unmarshal(body, &r); err != nil {
+			return fmt.Errorf("couldn't unmarshal ISM %s response: %v", action, err)
+		}
+		if r.Failures {
+			var failed []string
+			for _, f := range r.FailedIndices {
+				failed = append(failed, fmt.Sprintf("%s: %s", f.IndexName, f.Reason))
+			}
+			return fmt.Errorf("ISM %s failed for indices: %s", action,
+				strings.Join(failed, "; "))
+		}
+	}
+	return nil
+}
+
+// ChangeISMPolicy changes the ISM policy which manages the given indices to
+// the policy with the given ID. This is also used to apply a new version of
+// the current policy to the indices. Opensearch makes the change when each
+// index finishes the actions of its current state.
+func (c *Client) ChangeISMPolicy(ctx context.Context, indices []string,
+	policyID string) error {
+	return c.postISMIndices(ctx, "change_policy", indices,
+		map[string]string{"policy_id": policyID})
+}
+
+// RemoveISMPolicy stops ISM from managing the given indices.
+func (c *Client) RemoveISMPolicy(ctx context.Context,
+	indices []string) error {
+	return c.postISMIndices(ctx, "remove", indices, nil)
+}
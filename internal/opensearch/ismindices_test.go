@@ -0,0 +1,94 @@
+package opensearch_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func TestParseISMExplain(t *testing.T) {
+	data, err := os.ReadFile("testdata/ismexplain.json")
+	assert.NoError(t, err, "read testdata")
+	managed, err := opensearch.ParseISMExplain(data)
+	assert.NoError(t, err, "ParseISMExplain")
+	assert.Equal(t, map[string]string{
+		"router-logs-project-a-_-2026.10": "lagoon-router-logs",
+		"router-logs-project-b-_-2026.10": "lagoon-router-logs-project-b",
+	}, managed, "managed indices")
+}
+
+func TestChangeISMPolicy(t *testing.T) {
+	var testCases = map[string]struct {
+		indices       int
+		failedIndex   string
+		expectBatches int
+		expectErr     bool
+	}{
+		"single batch": {
+			indices:       3,
+			expectBatches: 1,
+		},
+		"multiple batches": {
+			indices:       120,
+			expectBatches: 3,
+		},
+		"failed index": {
+			indices:       3,
+			failedIndex:   "index-1",
+			expectBatches: 1,
+			expectErr:     true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var batches int
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					batches++
+					assert.Equal(tt, "POST", r.Method, "method")
+					indices, ok := strings.CutPrefix(r.URL.Path,
+						"/_plugins/_ism/change_policy/")
+					assert.True(tt, ok, "path")
+					body, err := io.ReadAll(r.Body)
+					assert.NoError(tt, err, "read body")
+					assert.Equal(tt, `{"policy_id":"lagoon-router-logs"}`+"\n",
+						string(body), "body")
+					res := opensearch.ISMIndicesResponse{
+						UpdatedIndices: len(strings.Split(indices, ",")),
+					}
+					if tc.failedIndex != "" {
+						res.Failures = true
+						res.FailedIndices = []opensearch.ISMFailedIndex{{
+							IndexName: tc.failedIndex,
+							Reason:    "This index is not being managed",
+						}}
+					}
+					assert.NoError(tt, json.NewEncoder(w).Encode(res), "encode")
+				}))
+			defer ts.Close()
+			c, err := opensearch.NewTestClient(ts.URL, 10)
+			assert.NoError(tt, err, name)
+			var indices []string
+			for i := range tc.indices {
+				indices = append(indices, fmt.Sprintf("index-%d", i))
+			}
+			err = c.ChangeISMPolicy(context.Background(), indices,
+				"lagoon-router-logs")
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+			assert.Equal(tt, tc.expectBatches, batches, name)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ISMTransition represents a transition between the states of an ISM policy.
+type ISMTransition struct {
+	StateName  string         `json:"state_name"`
+	Conditions map[string]any `json:"conditions,omitempty"`
+}
+
+// ISMState represents a state of an ISM policy. Actions are not modelled,
+// since each action type has its own parameters.
+type ISMState struct {
+	Name        string           `json:"name"`
+	Actions     []map[string]any `json:"actions"`
+	Transitions []ISMTransition  `json:"transitions"`
+}
+
+// ISMTemplate represents the index patterns to which an ISM policy is
+// automatically applied when an index is created.
+type ISMTemplate struct {
+	IndexPatterns   []string `json:"index_patterns"`
+	Priority        int      `json:"priority"`
+	LastUpdatedTime *int64   `json:"last_updated_time,omitempty"`
+}
+
+// ISMPolicyDefinition contains only the definition of the ISMPolicy. The
+// PolicyID, LastUpdatedTime, SchemaVersion, and ErrorNotification fields are
+// returned by Opensearch, and are omitted from requests if they are not set.
+type ISMPolicyDefinition struct {
+	PolicyID          string        `json:"policy_id,omitempty"`
+	Description       string        `json:"description"`
+	LastUpdatedTime   *int64        `json:"last_updated_time,omitempty"`
+	SchemaVersion     *int          `json:"schema_version,omitempty"`
+	ErrorNotification any           `json:"error_notification,omitempty"`
+	DefaultState      string        `json:"default_state"`
+	States            []ISMState    `json:"states"`
+	ISMTemplate       []ISMTemplate `json:"ism_template,omitempty"`
+}
+
+// ISMPolicy represents an Opensearch Index State Management policy. SeqNo and
+// PrimaryTerm identify the version of the policy for optimistic concurrency
+// control when it is updated.
+type ISMPolicy struct {
+	ID          string              `json:"_id"`
+	SeqNo       int64               `json:"_seq_no"`
+	PrimaryTerm int64               `json:"_primary_term"`
+	Policy      ISMPolicyDefinition `json:"policy"`
+}
+
+// ISMPoliciesSlice is used only for unmarshalling the JSON data returned by
+// the Opensearch ISM policies API.
+type ISMPoliciesSlice struct {
+	Policies      []ISMPolicy `json:"policies"`
+	TotalPolicies int         `json:"total_policies"`
+}
+
+// RawISMPolicies returns the raw JSON ISM policies representation from the
+// Opensearch API, starting from the given offset in order of policy ID.
+// searchSize controls the number of policies returned.
+func (c *Client) RawISMPolicies(ctx context.Context, searchSize uint,
+	from int) ([]byte, error) {
+	u, err := c.ismAPIURL(ctx, "policies")
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("size", strconv.FormatUint(uint64(searchSize), 10))
+	q.Set("from", strconv.Itoa(from))
+	q.Set("sortField", "policy.policy_id.keyword")
+	q.Set("sortOrder", "asc")
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't construct ISM policies request: %v", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get ISM policies: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("bad ISM policies response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// ISMPolicies returns all Opensearch ISM policies, keyed by policy ID.
+func (c *Client) ISMPolicies(ctx context.Context) (map[string]ISMPolicy, error) {
+	policies := map[string]ISMPolicy{}
+	from := 0
+	for {
+		data, err := c.RawISMPolicies(ctx, c.searchSize, from)
+		if err != nil {
+			return nil,
+				fmt.Errorf("couldn't get ISM policies from Opensearch API: %v", err)
+		}
+		var ps ISMPoliciesSlice
+		if err = json.Unmarshal(data, &ps); err != nil {
+			return nil, fmt.Errorf("couldn't unmarshal ISM policies: %v", err)
+		}
+		for _, p := range ps.Policies {
+			policies[p.ID] = p
+		}
+		from += len(ps.Policies)
+		if len(ps.Policies) < int(c.searchSize) || from >= ps.TotalPolicies {
+			return policies, nil
+		}
+	}
+}
+
+// putISMPolicy creates or updates the given ISM policy. If p.SeqNo and
+// p.PrimaryTerm are not zero, the policy is only updated if its version in
+// Opensearch matches.
+func (c *Client) putISMPolicy(ctx context.Context, operation string,
+	p *ISMPolicy) error {
+	// Marshal payload. Payload only consists of the ISMPolicyDefinition, because
+	// the other fields are not writable.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(struct {
+		Policy ISMPolicyDefinition `json:"policy"`
+	}{Policy: p.Policy}); err != nil {
+		return fmt.Errorf("couldn't marshal ISM policy: %v", err)
+	}
+	// construct request
+	u, err := c.ismAPIURL(ctx, "policies", p.ID)
+	if err != nil {
+		return err
+	}
+	if p.SeqNo != 0 || p.PrimaryTerm != 0 {
+		q := u.Query()
+		q.Set("if_seq_no", strconv.FormatInt(p.SeqNo, 10))
+		q.Set("if_primary_term", strconv.FormatInt(p.PrimaryTerm, 10))
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", u.String(), &buf)
+	if err != nil {
+		return fmt.Errorf("couldn't construct %s ISM policy request: %v",
+			operation, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// make request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't %s ISM policy: %v", operation, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad %s ISM policy response: %d\n%s", operation,
+			res.StatusCode, body)
+	}
+	return nil
+}
+
+// CreateISMPolicy creates the given ISM policy in Opensearch. It fails if a
+// policy with the same ID already exists.
+func (c *Client) CreateISMPolicy(ctx context.Context, p *ISMPolicy) error {
+	create := *p
+	create.SeqNo, create.PrimaryTerm = 0, 0
+	return c.putISMPolicy(ctx, "create", &create)
+}
+
+// UpdateISMPolicy replaces the given ISM policy in Opensearch. It fails if
+// the policy has been modified since it was read, as identified by p.SeqNo
+// and p.PrimaryTerm.
+func (c *Client) UpdateISMPolicy(ctx context.Context, p *ISMPolicy) error {
+	if p.SeqNo == 0 && p.PrimaryTerm == 0 {
+		return fmt.Errorf("missing sequence number and primary term")
+	}
+	return c.putISMPolicy(ctx, "update", p)
+}
+
+// DeleteISMPolicy deletes the given ISM policy from Opensearch.
+func (c *Client) DeleteISMPolicy(ctx context.Context, id string) error {
+	// construct request
+	u, err := c.ismAPIURL(ctx, "policies", id)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "DELETE", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("couldn't construct delete ISM policy request: %v",
+			err)
+	}
+	// make request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't delete ISM policy: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad delete ISM policy response: %d\n%s",
+			res.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package opensearch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func TestISMPoliciesUnmarshal(t *testing.T) {
+	lastUpdated, schemaVersion := int64(1760000000000), 21
+	var testCases = map[string]struct {
+		input  string
+		expect []opensearch.ISMPolicy
+	}{
+		"unmarshal ISM policies": {
+			input: "testdata/ismpolicies.json",
+			expect: []opensearch.ISMPolicy{{
+				ID:          "lagoon-router-logs",
+				SeqNo:       7,
+				PrimaryTerm: 1,
+				Policy: opensearch.ISMPolicyDefinition{
+					PolicyID:        "lagoon-router-logs",
+					Description:     "Delete router-logs indices after 14 days.",
+					LastUpdatedTime: &lastUpdated,
+					SchemaVersion:   &schemaVersion,
+					DefaultState:    "hot",
+					States: []opensearch.ISMState{
+						{
+							Name:    "hot",
+							Actions: []map[string]any{},
+							Transitions: []opensearch.ISMTransition{{
+								StateName:  "delete",
+								Conditions: map[string]any{"min_index_age": "14d"},
+							}},
+						},
+						{
+							Name: "delete",
+							Actions: []map[string]any{{
+								"retry": map[string]any{
+									"count":   float64(3),
+									"backoff": "exponential",
+									"delay":   "1m",
+								},
+								"delete": map[string]any{},
+							}},
+							Transitions: []opensearch.ISMTransition{},
+						},
+					},
+					ISMTemplate: []opensearch.ISMTemplate{{
+						IndexPatterns:   []string{"router-logs-*"},
+						Priority:        10,
+						LastUpdatedTime: &lastUpdated,
+					}},
+				},
+			}},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			data, err := os.ReadFile(tc.input)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			// check for missing fields
+			var ps opensearch.ISMPoliciesSlice
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if err = decoder.Decode(&ps); err != nil {
+				tt.Fatal(err)
+			}
+			assert.Equal(tt, tc.expect, ps.Policies, name)
+		})
+	}
+}
+
+func TestISMPoliciesPagination(t *testing.T) {
+	const total = 5
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/_plugins/_ism/policies", r.URL.Path, "path")
+			size, err := strconv.Atoi(r.URL.Query().Get("size"))
+			assert.NoError(t, err, "size")
+			from, err := strconv.Atoi(r.URL.Query().Get("from"))
+			assert.NoError(t, err, "from")
+			ps := opensearch.ISMPoliciesSlice{TotalPolicies: total}
+			for i := from; i < total && i < from+size; i++ {
+				ps.Policies = append(ps.Policies,
+					opensearch.ISMPolicy{ID: fmt.Sprintf("policy-%d", i)})
+			}
+			assert.NoError(t, json.NewEncoder(w).Encode(ps), "encode")
+		}))
+	defer ts.Close()
+	c, err := opensearch.NewTestClient(ts.URL, 2)
+	assert.NoError(t, err, "NewTestClient")
+	policies, err := c.ISMPolicies(context.Background())
+	assert.NoError(t, err, "ISMPolicies")
+	assert.Equal(t, total, len(policies), "policies")
+}
+
+func TestPutISMPolicy(t *testing.T) {
+	var testCases = map[string]struct {
+		update      bool
+		seqNo       int64
+		primaryTerm int64
+		status      int
+		expectQuery string
+		expectErr   bool
+	}{
+		"create": {
+			status: http.StatusCreated,
+		},
+		"create ignores version": {
+			seqNo:       3,
+			primaryTerm: 1,
+			status:      http.StatusCreated,
+		},
+		"update": {
+			update:      true,
+			seqNo:       0,
+			primaryTerm: 1,
+			status:      http.StatusOK,
+			expectQuery: "if_primary_term=1&if_seq_no=0",
+		},
+		"update conflict": {
+			update:      true,
+			seqNo:       3,
+			primaryTerm: 1,
+			status:      http.StatusConflict,
+			expectQuery: "if_primary_term=1&if_seq_no=3",
+			expectErr:   true,
+		},
+		"update without version": {
+			update:    true,
+			expectErr: true,
+		},
+	}
+	expectBody := `{"policy":{"description":"test","default_state":"hot",` +
+		`"states":[{"name":"hot","actions":[],"transitions":[]}]}}` + "\n"
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(tt, "PUT", r.Method, "method")
+					assert.Equal(tt, "/_plugins/_ism/policies/lagoon-test", r.URL.Path,
+						"path")
+					assert.Equal(tt, tc.expectQuery, r.URL.RawQuery, "query")
+					body, err := io.ReadAll(r.Body)
+					assert.NoError(tt, err, "read body")
+					assert.Equal(tt, expectBody, string(body), "body")
+					w.WriteHeader(tc.status)
+				}))
+			defer ts.Close()
+			c, err := opensearch.NewTestClient(ts.URL, 10)
+			assert.NoError(tt, err, name)
+			p := opensearch.ISMPolicy{
+				ID:          "lagoon-test",
+				SeqNo:       tc.seqNo,
+				PrimaryTerm: tc.primaryTerm,
+				Policy: opensearch.ISMPolicyDefinition{
+					Description:  "test",
+					DefaultState: "hot",
+					States: []opensearch.ISMState{{
+						Name:        "hot",
+						Actions:     []map[string]any{},
+						Transitions: []opensearch.ISMTransition{},
+					}},
+				},
+			}
+			if tc.update {
+				err = c.UpdateISMPolicy(context.Background(), &p)
+			} else {
+				err = c.CreateISMPolicy(context.Background(), &p)
+			}
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
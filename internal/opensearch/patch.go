@@ -0,0 +1,72 @@
+package opensearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
+)
+
+// patchSecurityAPI applies the given JSON Patch operations to the named
+// security plugin resource in a single request. Opensearch reloads the
+// security configuration once per request, rather than once per object.
+func (c *Client) patchSecurityAPI(
+	ctx context.Context,
+	resource string,
+	ops []jsonpatch.Operation,
+) error {
+	// marshal payload
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(ops); err != nil {
+		return fmt.Errorf("couldn't marshal %s patch: %v", resource, err)
+	}
+	// construct request
+	url, err := c.securityAPIURL(ctx, resource)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url.String(), &buf)
+	if err != nil {
+		return fmt.Errorf("couldn't construct patch %s request: %v", resource,
+			err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// make request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't patch %s: %v", resource, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("bad patch %s response: %d\n%s", resource,
+			res.StatusCode, body)
+	}
+	return nil
+}
+
+// PatchRoles applies the given JSON Patch operations to the Opensearch roles
+// in a single request. The path of each operation is the JSON Pointer to a
+// role name, and the value of each add operation is a RolePermissions.
+func (c *Client) PatchRoles(
+	ctx context.Context,
+	ops []jsonpatch.Operation,
+) error {
+	return c.patchSecurityAPI(ctx, "roles", ops)
+}
+
+// PatchRolesMapping applies the given JSON Patch operations to the Opensearch
+// rolesmapping in a single request. The path of each operation is the JSON
+// Pointer to a role name, and the value of each add operation is a
+// RoleMappingPermissions.
+func (c *Client) PatchRolesMapping(
+	ctx context.Context,
+	ops []jsonpatch.Operation,
+) error {
+	return c.patchSecurityAPI(ctx, "rolesmapping", ops)
+}
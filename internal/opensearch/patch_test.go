@@ -0,0 +1,61 @@
+package opensearch_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func TestPatchRoles(t *testing.T) {
+	var testCases = map[string]struct {
+		status    int
+		expectErr bool
+	}{
+		"success":     {status: http.StatusOK},
+		"bad request": {status: http.StatusBadRequest, expectErr: true},
+	}
+	ops := []jsonpatch.Operation{
+		{Op: "remove", Path: jsonpatch.Pointer("p2")},
+		{
+			Op:   "add",
+			Path: jsonpatch.Pointer("p1"),
+			Value: opensearch.RolePermissions{
+				ClusterPermissions: []string{},
+				IndexPermissions:   []opensearch.IndexPermission{},
+				TenantPermissions:  []opensearch.TenantPermission{},
+			},
+		},
+	}
+	expectBody := `[{"op":"remove","path":"/p2"},` +
+		`{"op":"add","path":"/p1","value":{"cluster_permissions":[],` +
+		`"index_permissions":[],"tenant_permissions":[]}}]` + "\n"
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(tt, "PATCH", r.Method, "method")
+					assert.Equal(tt, "/_plugins/_security/api/roles", r.URL.Path,
+						"path")
+					body, err := io.ReadAll(r.Body)
+					assert.NoError(tt, err, "read body")
+					assert.Equal(tt, expectBody, string(body), "body")
+					w.WriteHeader(tc.status)
+				}))
+			defer ts.Close()
+			c, err := opensearch.NewTestClient(ts.URL, 10)
+			assert.NoError(tt, err, name)
+			err = c.PatchRoles(context.Background(), ops)
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
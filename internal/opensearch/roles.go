@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"path"
 )
 
 // TenantPermission represents an Opensearch tenant permission.
@@ -45,8 +44,10 @@ type RolePermissions struct {
 
 // RawRoles returns the raw JSON roles representation from the Opensearch API.
 func (c *Client) RawRoles(ctx context.Context) ([]byte, error) {
-	rolesURL := *c.baseURL
-	rolesURL.Path = path.Join(c.baseURL.Path, "/_plugins/_security/api/roles/")
+	rolesURL, err := c.securityAPIURL(ctx, "roles")
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", rolesURL.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't construct roles request: %v", err)
@@ -84,8 +85,10 @@ func (c *Client) CreateRole(ctx context.Context, name string,
 		return fmt.Errorf("couldn't marshal role: %v", err)
 	}
 	// construct request
-	url := *c.baseURL
-	url.Path = path.Join(c.baseURL.Path, "/_plugins/_security/api/roles/", name)
+	url, err := c.securityAPIURL(ctx, "roles", name)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "PUT", url.String(), &buf)
 	if err != nil {
 		return fmt.Errorf("couldn't construct create role request: %v", err)
@@ -107,8 +110,10 @@ func (c *Client) CreateRole(ctx context.Context, name string,
 // DeleteRole deletes the named role from Opensearch.
 func (c *Client) DeleteRole(ctx context.Context, name string) error {
 	// construct request
-	url := *c.baseURL
-	url.Path = path.Join(c.baseURL.Path, "/_plugins/_security/api/roles/", name)
+	url, err := c.securityAPIURL(ctx, "roles", name)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "DELETE", url.String(), nil)
 	if err != nil {
 		return fmt.Errorf("couldn't construct delete role request: %v", err)
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"path"
 )
 
 // RoleMapping represents an Opensearch RoleMapping.
@@ -31,9 +30,10 @@ type RoleMappingPermissions struct {
 // RawRolesMapping returns the raw JSON rolesmapping representation from the
 // Opensearch API.
 func (c *Client) RawRolesMapping(ctx context.Context) ([]byte, error) {
-	rolesURL := *c.baseURL
-	rolesURL.Path = path.Join(c.baseURL.Path,
-		"/_plugins/_security/api/rolesmapping/")
+	rolesURL, err := c.securityAPIURL(ctx, "rolesmapping")
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", rolesURL.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't construct rolesmapping request: %v", err)
@@ -74,9 +74,10 @@ func (c *Client) CreateRoleMapping(ctx context.Context, name string,
 		return fmt.Errorf("couldn't marshal rolemapping: %v", err)
 	}
 	// construct request
-	url := *c.baseURL
-	url.Path = path.Join(c.baseURL.Path,
-		"/_plugins/_security/api/rolesmapping/", name)
+	url, err := c.securityAPIURL(ctx, "rolesmapping", name)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "PUT", url.String(), &buf)
 	if err != nil {
 		return fmt.Errorf("couldn't construct create rolemapping request: %v", err)
@@ -99,9 +100,10 @@ func (c *Client) CreateRoleMapping(ctx context.Context, name string,
 // DeleteRoleMapping deletes the named rolemapping from Opensearch.
 func (c *Client) DeleteRoleMapping(ctx context.Context, name string) error {
 	// construct request
-	url := *c.baseURL
-	url.Path = path.Join(c.baseURL.Path,
-		"/_plugins/_security/api/rolesmapping/", name)
+	url, err := c.securityAPIURL(ctx, "rolesmapping", name)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "DELETE", url.String(), nil)
 	if err != nil {
 		return fmt.Errorf("couldn't construct delete rolemapping request: %v", err)
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"path"
 )
 
 // Tenant represents an Opensearch Tenant.
@@ -29,9 +28,10 @@ type TenantDescription struct {
 // RawTenants returns the raw JSON tenants representation from the
 // Opensearch API.
 func (c *Client) RawTenants(ctx context.Context) ([]byte, error) {
-	tenantsURL := *c.baseURL
-	tenantsURL.Path = path.Join(c.baseURL.Path,
-		"/_plugins/_security/api/tenants/")
+	tenantsURL, err := c.securityAPIURL(ctx, "tenants")
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", tenantsURL.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't construct tenants request: %v", err)
@@ -70,9 +70,10 @@ func (c *Client) CreateTenant(ctx context.Context, name string,
 		return fmt.Errorf("couldn't marshal tenant: %v", err)
 	}
 	// construct request
-	url := *c.baseURL
-	url.Path = path.Join(c.baseURL.Path,
-		"/_plugins/_security/api/tenants/", name)
+	url, err := c.securityAPIURL(ctx, "tenants", name)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "PUT", url.String(), &buf)
 	if err != nil {
 		return fmt.Errorf("couldn't construct create tenant request: %v", err)
@@ -95,9 +96,10 @@ func (c *Client) CreateTenant(ctx context.Context, name string,
 // DeleteTenant deletes the named tenant from Opensearch.
 func (c *Client) DeleteTenant(ctx context.Context, name string) error {
 	// construct request
-	url := *c.baseURL
-	url.Path = path.Join(c.baseURL.Path,
-		"/_plugins/_security/api/tenants/", name)
+	url, err := c.securityAPIURL(ctx, "tenants", name)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "DELETE", url.String(), nil)
 	if err != nil {
 		return fmt.Errorf("couldn't construct delete tenant request: %v", err)
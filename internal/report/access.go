@@ -0,0 +1,233 @@
+// Package report implements reports on the Opensearch configuration
+// maintained for Lagoon.
+package report
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+// Backend role types.
+const (
+	// BackendRoleProject is a project backend role of the form p<ID>.
+	BackendRoleProject = "project"
+	// BackendRoleProjectGroup is a Lagoon project-default-group.
+	BackendRoleProjectGroup = "project-group"
+	// BackendRoleLagoonGroup is a regular Lagoon group.
+	BackendRoleLagoonGroup = "lagoon-group"
+	// BackendRoleKeycloakGroup is a Keycloak group which is not a Lagoon group.
+	BackendRoleKeycloakGroup = "keycloak-group"
+	// BackendRoleExternal is any other backend role.
+	BackendRoleExternal = "external"
+)
+
+// Role types.
+const (
+	// RoleLagoon is a role maintained by lagoon-opensearch-sync.
+	RoleLagoon = "lagoon"
+	// RoleCustom is a manually created role prefixed with custom_.
+	RoleCustom = "custom"
+	// RoleReserved is a reserved, static, or hidden Opensearch role.
+	RoleReserved = "reserved"
+)
+
+// projectRoleName matches the name of a Lagoon project role.
+var projectRoleName = regexp.MustCompile(`^p([0-9]+)$`)
+
+// KeycloakService defines the Keycloak service interface.
+type KeycloakService interface {
+	Groups(context.Context) ([]keycloak.Group, error)
+}
+
+// LagoonDBService defines the Lagoon database service interface.
+type LagoonDBService interface {
+	Projects(context.Context) ([]lagoondb.Project, error)
+	GroupProjectsMap(context.Context) (map[string][]int, error)
+}
+
+// OpensearchService defines the Opensearch service interface.
+type OpensearchService interface {
+	Roles(context.Context) (map[string]opensearch.Role, error)
+	RolesMapping(context.Context) (map[string]opensearch.RoleMapping, error)
+}
+
+// AccessEntry is a single row in the access report. It describes the Lagoon
+// projects whose logs are readable via a single index pattern, granted to a
+// backend role via an Opensearch role.
+type AccessEntry struct {
+	BackendRole     string   `json:"backendRole"`
+	BackendRoleType string   `json:"backendRoleType"`
+	Role            string   `json:"role"`
+	RoleType        string   `json:"roleType"`
+	IndexPattern    string   `json:"indexPattern"`
+	AllowedActions  []string `json:"allowedActions"`
+	Projects        []string `json:"projects"`
+}
+
+// roleType returns the type of the named Opensearch role.
+func roleType(name string, role opensearch.Role) string {
+	if role.Reserved || role.Static || role.Hidden {
+		return RoleReserved
+	}
+	if strings.HasPrefix(name, "custom_") {
+		return RoleCustom
+	}
+	return RoleLagoon
+}
+
+// backendRoleTypes returns a map of backend role names to backend role types
+// for the backend roles which can be determined from Lagoon and Keycloak.
+// Backend roles which do not appear in the returned map are external.
+func backendRoleTypes(
+	groups []keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+) map[string]string {
+	types := map[string]string{}
+	for _, group := range groups {
+		_, lagoonGroup := groupProjectsMap[group.ID]
+		switch {
+		case slices.Contains(group.Attributes["type"], "project-default-group"):
+			types[group.Name] = BackendRoleProjectGroup
+		case lagoonGroup:
+			types[group.Name] = BackendRoleLagoonGroup
+		default:
+			types[group.Name] = BackendRoleKeycloakGroup
+		}
+	}
+	for pid := range projectNames {
+		types[fmt.Sprintf("p%d", pid)] = BackendRoleProject
+	}
+	return types
+}
+
+// indexPatternProjects returns a sorted slice of the names of the projects
+// whose log indices may be matched by the given index pattern.
+func indexPatternProjects(pattern string, projectNames map[int]string) []string {
+	var projects []string
+	for _, name := range projectNames {
+		for _, family := range sync.LogFamilies {
+			if indexPatternMatchesPrefix(pattern,
+				fmt.Sprintf("%s-%s-_-", family, name)) {
+				projects = append(projects, name)
+				break
+			}
+		}
+	}
+	slices.Sort(projects)
+	return projects
+}
+
+// generateAccessEntries joins the Lagoon, Keycloak, and Opensearch state into
+// a sorted slice of access report entries.
+//
+// Rolesmapping which refer to a role which does not exist are ignored, as are
+// index patterns which do not match any Lagoon project logs.
+func generateAccessEntries(
+	log *zap.Logger,
+	groups []keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+	roles map[string]opensearch.Role,
+	rolesmapping map[string]opensearch.RoleMapping,
+) []AccessEntry {
+	types := backendRoleTypes(groups, projectNames, groupProjectsMap)
+	var entries []AccessEntry
+	for name, rolemapping := range rolesmapping {
+		role, ok := roles[name]
+		if !ok {
+			log.Debug("ignoring rolemapping for unknown role",
+				zap.String("name", name))
+			continue
+		}
+		for _, backendRole := range rolemapping.BackendRoles {
+			backendRoleType, ok := types[backendRole]
+			if !ok {
+				backendRoleType = BackendRoleExternal
+			}
+			for _, indexPermission := range role.IndexPermissions {
+				for _, pattern := range indexPermission.IndexPatterns {
+					projects := indexPatternProjects(pattern, projectNames)
+					if len(projects) == 0 {
+						continue
+					}
+					entries = append(entries, AccessEntry{
+						BackendRole:     backendRole,
+						BackendRoleType: backendRoleType,
+						Role:            name,
+						RoleType:        roleType(name, role),
+						IndexPattern:    pattern,
+						AllowedActions:  indexPermission.AllowedActions,
+						Projects:        projects,
+					})
+				}
+			}
+		}
+	}
+	slices.SortFunc(entries, cmpEntries)
+	return entries
+}
+
+// cmpEntries orders entries by backend role, role, and index pattern. Project
+// backend roles are ordered numerically.
+func cmpEntries(a, b AccessEntry) int {
+	if a.BackendRole != b.BackendRole {
+		am := projectRoleName.FindStringSubmatch(a.BackendRole)
+		bm := projectRoleName.FindStringSubmatch(b.BackendRole)
+		if am != nil && bm != nil {
+			ai, _ := strconv.Atoi(am[1])
+			bi, _ := strconv.Atoi(bm[1])
+			return ai - bi
+		}
+		return strings.Compare(a.BackendRole, b.BackendRole)
+	}
+	if a.Role != b.Role {
+		return strings.Compare(a.Role, b.Role)
+	}
+	return strings.Compare(a.IndexPattern, b.IndexPattern)
+}
+
+// Access returns the effective access report, which describes which backend
+// roles can read which Lagoon project logs.
+func Access(
+	ctx context.Context,
+	log *zap.Logger,
+	l LagoonDBService,
+	k KeycloakService,
+	o OpensearchService,
+) ([]AccessEntry, error) {
+	projects, err := l.Projects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get projects: %v", err)
+	}
+	// groups are read before group project membership, which may be derived
+	// from them.
+	groups, err := k.Groups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get groups: %v", err)
+	}
+	groupProjectsMap, err := l.GroupProjectsMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get group projects map: %v", err)
+	}
+	roles, err := o.Roles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get roles: %v", err)
+	}
+	rolesmapping, err := o.RolesMapping(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get rolesmapping: %v", err)
+	}
+	return generateAccessEntries(log, groups, sync.ProjectNames(projects),
+		groupProjectsMap, roles, rolesmapping), nil
+}
@@ -0,0 +1,239 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/report"
+	"go.uber.org/zap"
+)
+
+func TestGenerateAccessEntries(t *testing.T) {
+	type input struct {
+		groups           []keycloak.Group
+		projectNames     map[int]string
+		groupProjectsMap map[string][]int
+		roles            map[string]opensearch.Role
+		rolesmapping     map[string]opensearch.RoleMapping
+	}
+	var testCases = map[string]struct {
+		input  input
+		expect []report.AccessEntry
+	}{
+		"lagoon and non-lagoon roles": {
+			input: input{
+				groups: []keycloak.Group{
+					{
+						ID: "f6697da3-016a-43cd-ba9f-3f5b91b45302",
+						GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+							Name: "drupal-example",
+						},
+					},
+					{
+						ID: "3fc60c90-b72d-4704-8a57-80438adac98d",
+						GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+							Name: "project-beta-ui",
+							Attributes: map[string][]string{
+								"type": {`project-default-group`},
+							},
+						},
+					},
+				},
+				projectNames: map[int]string{
+					27: "beta-ui",
+					31: "drupal9-base",
+				},
+				groupProjectsMap: map[string][]int{
+					"f6697da3-016a-43cd-ba9f-3f5b91b45302": {31},
+					"3fc60c90-b72d-4704-8a57-80438adac98d": {27},
+				},
+				roles: map[string]opensearch.Role{
+					"all_access": {
+						Reserved: true,
+						RolePermissions: opensearch.RolePermissions{
+							IndexPermissions: []opensearch.IndexPermission{
+								{
+									AllowedActions: []string{"*"},
+									IndexPatterns:  []string{"*"},
+								},
+							},
+						},
+					},
+					"custom_beta": {
+						RolePermissions: opensearch.RolePermissions{
+							IndexPermissions: []opensearch.IndexPermission{
+								{
+									AllowedActions: []string{"read"},
+									IndexPatterns: []string{
+										"router-logs-beta-*",
+										".opendistro-alerting-alert*",
+									},
+								},
+							},
+						},
+					},
+					"drupal-example": {
+						RolePermissions: opensearch.RolePermissions{
+							IndexPermissions: []opensearch.IndexPermission{
+								{
+									AllowedActions: []string{"read"},
+									IndexPatterns: []string{
+										"application-logs-drupal9-base-_-*",
+									},
+								},
+							},
+						},
+					},
+					"p27": {
+						RolePermissions: opensearch.RolePermissions{
+							IndexPermissions: []opensearch.IndexPermission{
+								{
+									AllowedActions: []string{"read"},
+									IndexPatterns: []string{
+										"application-logs-beta-ui-_-*",
+									},
+								},
+							},
+						},
+					},
+				},
+				rolesmapping: map[string]opensearch.RoleMapping{
+					"all_access": {
+						RoleMappingPermissions: opensearch.RoleMappingPermissions{
+							BackendRoles: []string{"admin"},
+						},
+					},
+					"custom_beta": {
+						RoleMappingPermissions: opensearch.RoleMappingPermissions{
+							BackendRoles: []string{"drupal-example"},
+						},
+					},
+					"drupal-example": {
+						RoleMappingPermissions: opensearch.RoleMappingPermissions{
+							BackendRoles: []string{"drupal-example"},
+						},
+					},
+					"p27": {
+						RoleMappingPermissions: opensearch.RoleMappingPermissions{
+							BackendRoles: []string{"p27"},
+						},
+					},
+					"missing": {
+						RoleMappingPermissions: opensearch.RoleMappingPermissions{
+							BackendRoles: []string{"p27"},
+						},
+					},
+				},
+			},
+			expect: []report.AccessEntry{
+				{
+					BackendRole:     "admin",
+					BackendRoleType: report.BackendRoleExternal,
+					Role:            "all_access",
+					RoleType:        report.RoleReserved,
+					IndexPattern:    "*",
+					AllowedActions:  []string{"*"},
+					Projects:        []string{"beta-ui", "drupal9-base"},
+				},
+				{
+					BackendRole:     "drupal-example",
+					BackendRoleType: report.BackendRoleLagoonGroup,
+					Role:            "custom_beta",
+					RoleType:        report.RoleCustom,
+					IndexPattern:    "router-logs-beta-*",
+					AllowedActions:  []string{"read"},
+					Projects:        []string{"beta-ui"},
+				},
+				{
+					BackendRole:     "drupal-example",
+					BackendRoleType: report.BackendRoleLagoonGroup,
+					Role:            "drupal-example",
+					RoleType:        report.RoleLagoon,
+					IndexPattern:    "application-logs-drupal9-base-_-*",
+					AllowedActions:  []string{"read"},
+					Projects:        []string{"drupal9-base"},
+				},
+				{
+					BackendRole:     "p27",
+					BackendRoleType: report.BackendRoleProject,
+					Role:            "p27",
+					RoleType:        report.RoleLagoon,
+					IndexPattern:    "application-logs-beta-ui-_-*",
+					AllowedActions:  []string{"read"},
+					Projects:        []string{"beta-ui"},
+				},
+			},
+		},
+	}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			entries := report.GenerateAccessEntries(log, tc.input.groups,
+				tc.input.projectNames, tc.input.groupProjectsMap, tc.input.roles,
+				tc.input.rolesmapping)
+			assert.Equal(tt, tc.expect, entries, name)
+		})
+	}
+}
+
+func TestWriteAccess(t *testing.T) {
+	entries := []report.AccessEntry{
+		{
+			BackendRole:     "drupal-example",
+			BackendRoleType: report.BackendRoleLagoonGroup,
+			Role:            "drupal-example",
+			RoleType:        report.RoleLagoon,
+			IndexPattern:    "application-logs-drupal9-base-_-*",
+			AllowedActions:  []string{"read", "indices:monitor/settings/get"},
+			Projects:        []string{"drupal9-base", "drupal10-base"},
+		},
+	}
+	var testCases = map[string]struct {
+		write  func(*bytes.Buffer) error
+		expect string
+	}{
+		"csv": {
+			write: func(buf *bytes.Buffer) error {
+				return report.WriteAccessCSV(buf, entries)
+			},
+			expect: "backend role,backend role type,role,role type,index pattern," +
+				"allowed actions,projects\n" +
+				"drupal-example,lagoon-group,drupal-example,lagoon," +
+				"application-logs-drupal9-base-_-*," +
+				"read indices:monitor/settings/get,drupal9-base drupal10-base\n",
+		},
+		"json": {
+			write: func(buf *bytes.Buffer) error {
+				return report.WriteAccessJSON(buf, entries)
+			},
+			expect: `[{"backendRole":"drupal-example",` +
+				`"backendRoleType":"lagoon-group","role":"drupal-example",` +
+				`"roleType":"lagoon",` +
+				`"indexPattern":"application-logs-drupal9-base-_-*",` +
+				`"allowedActions":["read","indices:monitor/settings/get"],` +
+				`"projects":["drupal9-base","drupal10-base"]}]` + "\n",
+		},
+		"markdown": {
+			write: func(buf *bytes.Buffer) error {
+				return report.WriteAccessMarkdown(buf, entries)
+			},
+			expect: "| backend role | backend role type | role | role type |" +
+				" index pattern | allowed actions | projects |\n" +
+				"| --- | --- | --- | --- | --- | --- | --- |\n" +
+				`| drupal-example | lagoon-group | drupal-example | lagoon |` +
+				` application-logs-drupal9-base-\_-\* |` +
+				` read, indices:monitor/settings/get |` +
+				` drupal9-base, drupal10-base |` + "\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(tt, tc.write(&buf), name)
+			assert.Equal(tt, tc.expect, buf.String(), name)
+		})
+	}
+}
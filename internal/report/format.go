@@ -0,0 +1,91 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// accessHeader is the header row of the tabular access report formats.
+var accessHeader = []string{
+	"backend role",
+	"backend role type",
+	"role",
+	"role type",
+	"index pattern",
+	"allowed actions",
+	"projects",
+}
+
+// accessRow returns the given entry as a row in a tabular access report, with
+// the slice fields joined by sep.
+func accessRow(entry AccessEntry, sep string) []string {
+	return []string{
+		entry.BackendRole,
+		entry.BackendRoleType,
+		entry.Role,
+		entry.RoleType,
+		entry.IndexPattern,
+		strings.Join(entry.AllowedActions, sep),
+		strings.Join(entry.Projects, sep),
+	}
+}
+
+// WriteAccessCSV writes the given access report entries to w in CSV format.
+func WriteAccessCSV(w io.Writer, entries []AccessEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(accessHeader); err != nil {
+		return fmt.Errorf("couldn't write CSV header: %v", err)
+	}
+	for _, entry := range entries {
+		if err := cw.Write(accessRow(entry, " ")); err != nil {
+			return fmt.Errorf("couldn't write CSV row: %v", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteAccessJSON writes the given access report entries to w in JSON format.
+func WriteAccessJSON(w io.Writer, entries []AccessEntry) error {
+	if entries == nil {
+		// marshal an empty array rather than null
+		entries = []AccessEntry{}
+	}
+	return json.NewEncoder(w).Encode(entries)
+}
+
+// markdownEscaper escapes characters which have special meaning in a Markdown
+// table cell.
+var markdownEscaper = strings.NewReplacer(`|`, `\|`, `*`, `\*`, `_`, `\_`)
+
+// WriteAccessMarkdown writes the given access report entries to w as a
+// Markdown table.
+func WriteAccessMarkdown(w io.Writer, entries []AccessEntry) error {
+	writeRow := func(cells []string) error {
+		_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		return err
+	}
+	if err := writeRow(accessHeader); err != nil {
+		return err
+	}
+	separator := make([]string, len(accessHeader))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	if err := writeRow(separator); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		row := accessRow(entry, ", ")
+		for i := range row {
+			row[i] = markdownEscaper.Replace(row[i])
+		}
+		if err := writeRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package report
+
+// this test helper facilitates unit testing of private functions.
+
+var (
+	GenerateAccessEntries     = generateAccessEntries
+	IndexPatternMatchesPrefix = indexPatternMatchesPrefix
+)
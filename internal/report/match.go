@@ -0,0 +1,67 @@
+package report
+
+import (
+	"regexp"
+	"strings"
+)
+
+// indexPatternMatchesPrefix returns true if the given Opensearch security
+// plugin index pattern matches any index name with the given prefix.
+//
+// Index patterns may contain the wildcards * and ?, or may be a regular
+// expression enclosed in forward slashes.
+// https://opensearch.org/docs/latest/security/access-control/default-action-groups/
+func indexPatternMatchesPrefix(pattern, prefix string) bool {
+	if len(pattern) > 1 &&
+		strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(`^(?:` + pattern[1:len(pattern)-1] + `)$`)
+		if err != nil {
+			return false
+		}
+		// regular expressions can't be matched against a prefix, so match
+		// against a representative index name instead.
+		return re.MatchString(prefix + "environment-_-2006.01")
+	}
+	return wildcardMatchesPrefix(pattern, prefix)
+}
+
+// wildcardMatchesPrefix returns true if there is any string beginning with
+// prefix which is matched by the given wildcard pattern.
+//
+// This is a simple NFA simulation: the set of reachable positions in the
+// pattern is tracked while consuming the prefix. Any remaining pattern after
+// the prefix has been consumed can always be matched by some suffix, so the
+// pattern matches the prefix if any position remains reachable.
+func wildcardMatchesPrefix(pattern, prefix string) bool {
+	// closure adds the positions reachable without consuming input
+	closure := func(positions map[int]bool) map[int]bool {
+		for i := range len(pattern) {
+			if positions[i] && pattern[i] == '*' {
+				positions[i+1] = true
+			}
+		}
+		return positions
+	}
+	positions := closure(map[int]bool{0: true})
+	for j := range len(prefix) {
+		next := map[int]bool{}
+		for i := range positions {
+			if i == len(pattern) {
+				continue
+			}
+			switch pattern[i] {
+			case '*':
+				next[i] = true
+			case '?':
+				next[i+1] = true
+			case prefix[j]:
+				next[i+1] = true
+			}
+		}
+		positions = closure(next)
+		if len(positions) == 0 {
+			return false
+		}
+	}
+	return len(positions) > 0
+}
@@ -0,0 +1,78 @@
+package report_test
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/report"
+)
+
+func TestIndexPatternMatchesPrefix(t *testing.T) {
+	var testCases = map[string]struct {
+		pattern string
+		prefix  string
+		expect  bool
+	}{
+		"exact project": {
+			pattern: "router-logs-foo-_-*",
+			prefix:  "router-logs-foo-_-",
+			expect:  true,
+		},
+		"different project": {
+			pattern: "router-logs-foo-bar-_-*",
+			prefix:  "router-logs-foo-_-",
+			expect:  false,
+		},
+		"legacy delimiter matches longer project names": {
+			pattern: "router-logs-foo-*",
+			prefix:  "router-logs-foo-bar-_-",
+			expect:  true,
+		},
+		"global pattern": {
+			pattern: "router-logs-*",
+			prefix:  "router-logs-foo-_-",
+			expect:  true,
+		},
+		"match all": {
+			pattern: "*",
+			prefix:  "router-logs-foo-_-",
+			expect:  true,
+		},
+		"different family": {
+			pattern: "container-logs-*",
+			prefix:  "router-logs-foo-_-",
+			expect:  false,
+		},
+		"environment specific pattern": {
+			pattern: "router-logs-foo-_-main-_-*",
+			prefix:  "router-logs-foo-_-",
+			expect:  true,
+		},
+		"single character wildcard": {
+			pattern: "router-logs-fo?-_-*",
+			prefix:  "router-logs-foo-_-",
+			expect:  true,
+		},
+		"system index": {
+			pattern: ".opendistro-alerting-alert*",
+			prefix:  "router-logs-foo-_-",
+			expect:  false,
+		},
+		"regular expression": {
+			pattern: "/router-logs-(foo|bar)-_-.*/",
+			prefix:  "router-logs-foo-_-",
+			expect:  true,
+		},
+		"non-matching regular expression": {
+			pattern: "/router-logs-(baz|bar)-_-.*/",
+			prefix:  "router-logs-foo-_-",
+			expect:  false,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expect,
+				report.IndexPatternMatchesPrefix(tc.pattern, tc.prefix), name)
+		})
+	}
+}
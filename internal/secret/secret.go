@@ -0,0 +1,97 @@
+// Package secret implements secret values, such as passwords and
+// certificates, which may be read from files. Values read from files are
+// reloaded when the file changes, so that rotated credentials are used
+// without restarting.
+package secret
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Value is a secret value. It is either static, or read from a file. A nil
+// *Value is valid, and has an empty value.
+type Value struct {
+	path string
+
+	mu         sync.Mutex
+	value      string
+	modTime    time.Time
+	size       int64
+	generation uint64
+}
+
+// Static returns a Value which never changes.
+func Static(value string) *Value {
+	return &Value{value: value}
+}
+
+// File returns a Value which is read from the file at the given path, and
+// reloaded when the modification time or size of the file changes. The file
+// is read immediately so that a missing file is reported early.
+func File(path string) (*Value, error) {
+	v := &Value{path: path}
+	if _, _, err := v.Load(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// New returns a Value read from the file at the given path if it is not
+// empty, or otherwise a static Value containing the given value. If both are
+// empty, it returns nil.
+func New(value, path string) (*Value, error) {
+	switch {
+	case path != "":
+		return File(path)
+	case value != "":
+		return Static(value), nil
+	default:
+		return nil, nil
+	}
+}
+
+// Load returns the current value, and its generation. The generation is
+// incremented each time the value is reloaded from the file, so callers can
+// cheaply detect changes. If the file cannot be reloaded, the error is
+// returned along with the last value which was read successfully.
+func (v *Value) Load() (string, uint64, error) {
+	if v == nil {
+		return "", 0, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.path == "" {
+		return v.value, v.generation, nil
+	}
+	info, err := os.Stat(v.path)
+	if err != nil {
+		return v.value, v.generation, fmt.Errorf("couldn't stat %s: %v", v.path,
+			err)
+	}
+	if v.generation > 0 && info.ModTime().Equal(v.modTime) &&
+		info.Size() == v.size {
+		return v.value, v.generation, nil
+	}
+	buf, err := os.ReadFile(v.path)
+	if err != nil {
+		return v.value, v.generation, fmt.Errorf("couldn't read %s: %v", v.path,
+			err)
+	}
+	// files written by hand or by echo usually have a trailing newline, which
+	// is not part of the secret
+	v.value = strings.TrimRight(string(buf), "\r\n")
+	v.modTime = info.ModTime()
+	v.size = info.Size()
+	v.generation++
+	return v.value, v.generation, nil
+}
+
+// Get returns the current value.
+func (v *Value) Get() (string, error) {
+	value, _, err := v.Load()
+	return value, err
+}
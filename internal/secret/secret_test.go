@@ -0,0 +1,70 @@
+package secret_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+)
+
+func TestStatic(t *testing.T) {
+	v := secret.Static("foo")
+	value, generation, err := v.Load()
+	assert.NoError(t, err, "Load")
+	assert.Equal(t, "foo", value, "value")
+	assert.Equal(t, 0, generation, "generation")
+}
+
+func TestNil(t *testing.T) {
+	v, err := secret.New("", "")
+	assert.NoError(t, err, "New")
+	assert.Zero(t, v, "nil value")
+	value, err := v.Get()
+	assert.NoError(t, err, "Get")
+	assert.Equal(t, "", value, "value")
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := secret.New("ignored", path)
+	assert.NoError(t, err, "New")
+	value, generation, err := v.Load()
+	assert.NoError(t, err, "Load")
+	assert.Equal(t, "foo", value, "initial value")
+	assert.Equal(t, 1, generation, "initial generation")
+	// unchanged file is not reloaded
+	_, generation, err = v.Load()
+	assert.NoError(t, err, "Load")
+	assert.Equal(t, 1, generation, "unchanged generation")
+	// changed file is reloaded
+	if err = os.WriteFile(path, []byte("barbaz"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	value, generation, err = v.Load()
+	assert.NoError(t, err, "Load")
+	assert.Equal(t, "barbaz", value, "reloaded value")
+	assert.Equal(t, 2, generation, "reloaded generation")
+	// the last value is returned if the file is removed
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	value, generation, err = v.Load()
+	assert.Error(t, err, "Load")
+	assert.Equal(t, "barbaz", value, "last value")
+	assert.Equal(t, 2, generation, "last generation")
+}
+
+func TestMissingFile(t *testing.T) {
+	_, err := secret.File(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err, "File")
+}
@@ -0,0 +1,169 @@
+package sigv4
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryWindow is the period before the expiry of temporary credentials
+// during which they are refreshed.
+const expiryWindow = 5 * time.Minute
+
+// Credentials are AWS credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is the time the credentials expire, or the zero time if they do
+	// not expire.
+	Expires time.Time
+}
+
+// CredentialsProvider provides AWS credentials.
+type CredentialsProvider interface {
+	Retrieve(context.Context) (Credentials, error)
+}
+
+// EnvCredentials provides AWS credentials from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN environment variables. The
+// environment is read on each request so that updated credentials are used.
+type EnvCredentials struct{}
+
+// Retrieve implements CredentialsProvider.
+func (EnvCredentials) Retrieve(context.Context) (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf(
+			"missing AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY")
+	}
+	return creds, nil
+}
+
+// WebIdentityCredentials provides temporary AWS credentials by exchanging a
+// web identity token, such as a Kubernetes service account token provided by
+// EKS IAM roles for service accounts, using STS AssumeRoleWithWebIdentity.
+// The credentials are cached until shortly before they expire.
+type WebIdentityCredentials struct {
+	roleARN     string
+	tokenFile   string
+	sessionName string
+	stsURL      string
+	httpClient  *http.Client
+
+	mu     sync.Mutex
+	cached Credentials
+}
+
+// NewWebIdentityCredentials returns a WebIdentityCredentials which assumes
+// the given role using the token in the given file, via the STS endpoint of
+// the given region.
+func NewWebIdentityCredentials(
+	roleARN,
+	tokenFile,
+	sessionName,
+	region string,
+) *WebIdentityCredentials {
+	return &WebIdentityCredentials{
+		roleARN:     roleARN,
+		tokenFile:   tokenFile,
+		sessionName: sessionName,
+		stsURL:      fmt.Sprintf("https://sts.%s.amazonaws.com/", region),
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// assumeRoleWithWebIdentityResponse is the XML response of the STS
+// AssumeRoleWithWebIdentity action.
+type assumeRoleWithWebIdentityResponse struct {
+	Result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"Credentials"`
+	} `xml:"AssumeRoleWithWebIdentityResult"`
+}
+
+// Retrieve implements CredentialsProvider.
+func (w *WebIdentityCredentials) Retrieve(
+	ctx context.Context,
+) (Credentials, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cached.AccessKeyID != "" &&
+		time.Now().Add(expiryWindow).Before(w.cached.Expires) {
+		return w.cached, nil
+	}
+	// the token file is read on each refresh, because it is rotated
+	token, err := os.ReadFile(w.tokenFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("couldn't read web identity token: %v",
+			err)
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {w.roleARN},
+		"RoleSessionName":  {w.sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.stsURL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("couldn't construct STS request: %v",
+			err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := w.httpClient.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("couldn't assume role: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		resBody, _ := io.ReadAll(res.Body)
+		return Credentials{}, fmt.Errorf("bad STS response: %d\n%s",
+			res.StatusCode, resBody)
+	}
+	var arRes assumeRoleWithWebIdentityResponse
+	if err = xml.NewDecoder(res.Body).Decode(&arRes); err != nil {
+		return Credentials{}, fmt.Errorf("couldn't decode STS response: %v", err)
+	}
+	c := arRes.Result.Credentials
+	w.cached = Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expires:         c.Expiration,
+	}
+	return w.cached, nil
+}
+
+// DefaultCredentials returns a CredentialsProvider configured from the
+// environment. If AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN are set, web
+// identity credentials are used. Otherwise static credentials are read from
+// the environment.
+func DefaultCredentials(region string) CredentialsProvider {
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	if tokenFile == "" || roleARN == "" {
+		return EnvCredentials{}
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = "lagoon-opensearch-sync"
+	}
+	return NewWebIdentityCredentials(roleARN, tokenFile, sessionName, region)
+}
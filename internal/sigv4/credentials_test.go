@@ -0,0 +1,52 @@
+package sigv4_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sigv4"
+)
+
+func TestWebIdentityCredentials(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("test-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			if r.PostForm.Get("Action") != "AssumeRoleWithWebIdentity" ||
+				r.PostForm.Get("RoleArn") != "arn:aws:iam::123456789012:role/sync" ||
+				r.PostForm.Get("WebIdentityToken") != "test-token" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			buf, err := os.ReadFile("testdata/assumerolewithwebidentity.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = w.Write(buf)
+		}))
+	defer ts.Close()
+	w := sigv4.NewWebIdentityCredentials("arn:aws:iam::123456789012:role/sync",
+		tokenFile, "test", "us-east-1")
+	w.SetSTSURL(ts.URL, ts.Client())
+	for range 2 {
+		creds, err := w.Retrieve(context.Background())
+		assert.NoError(t, err, "Retrieve")
+		assert.Equal(t, "ASIAEXAMPLE", creds.AccessKeyID, "access key ID")
+		assert.Equal(t, "secret", creds.SecretAccessKey, "secret access key")
+		assert.Equal(t, "session", creds.SessionToken, "session token")
+	}
+	// the credentials are cached until they expire
+	assert.Equal(t, 1, requests, "STS requests")
+}
@@ -0,0 +1,19 @@
+package sigv4
+
+import (
+	"net/http"
+	"time"
+)
+
+// this test helper facilitates unit testing of private fields.
+
+// SetNow overrides the clock used by the Signer.
+func (s *Signer) SetNow(now func() time.Time) {
+	s.now = now
+}
+
+// SetSTSURL overrides the STS endpoint used by the WebIdentityCredentials.
+func (w *WebIdentityCredentials) SetSTSURL(stsURL string, c *http.Client) {
+	w.stsURL = stsURL
+	w.httpClient = c
+}
@@ -0,0 +1,231 @@
+// Package sigv4 implements AWS Signature Version 4 request signing, as
+// required by Amazon OpenSearch Service domains with fine-grained access
+// control.
+package sigv4
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm = "AWS4-HMAC-SHA256"
+	// timeFormat is the format of the X-Amz-Date header.
+	timeFormat = "20060102T150405Z"
+	// dateFormat is the format of the date in the credential scope.
+	dateFormat = "20060102"
+)
+
+// Services which may be signed for.
+const (
+	// ServiceOpensearch is Amazon OpenSearch Service.
+	ServiceOpensearch = "es"
+	// ServiceOpensearchServerless is Amazon OpenSearch Serverless.
+	ServiceOpensearchServerless = "aoss"
+)
+
+// Signer signs HTTP requests with AWS Signature Version 4.
+type Signer struct {
+	credentials CredentialsProvider
+	region      string
+	service     string
+	now         func() time.Time
+}
+
+// NewSigner returns a Signer which signs requests to the given AWS service
+// in the given region, using credentials from the given provider.
+func NewSigner(
+	credentials CredentialsProvider,
+	region,
+	service string,
+) *Signer {
+	return &Signer{
+		credentials: credentials,
+		region:      region,
+		service:     service,
+		now:         time.Now,
+	}
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data using the given key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// hashSHA256 returns the hex encoded SHA256 hash of data.
+func hashSHA256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// escape URI-encodes s as described in the AWS Signature Version 4
+// documentation. All characters except the unreserved characters are encoded.
+// If encodeSlash is false, '/' is not encoded.
+func escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalURI returns the canonical URI of the given URL. Services other
+// than S3 expect the already escaped path to be escaped again.
+func canonicalURI(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+	return escape(p, false)
+}
+
+// canonicalQuery returns the canonical query string of the given URL.
+func canonicalQuery(u *url.URL) string {
+	var params []string
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			params = append(params, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+// payloadHash returns the hex encoded SHA256 hash of the request body, and
+// restores the body so that it can be sent.
+func payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hashSHA256(nil), nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read request body: %v", err)
+	}
+	if err = req.Body.Close(); err != nil {
+		return "", fmt.Errorf("couldn't close request body: %v", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return hashSHA256(body), nil
+}
+
+// Sign adds the AWS Signature Version 4 Authorization header, and the
+// headers it depends on, to the given request. The request body is read and
+// replaced.
+func (s *Signer) Sign(req *http.Request) error {
+	creds, err := s.credentials.Retrieve(req.Context())
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve credentials: %v", err)
+	}
+	hash, err := payloadHash(req)
+	if err != nil {
+		return err
+	}
+	now := s.now().UTC()
+	// set the headers which will be signed
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{
+		"host":       host,
+		"x-amz-date": now.Format(timeFormat),
+	}
+	if creds.SessionToken != "" {
+		headers["x-amz-security-token"] = creds.SessionToken
+	}
+	if s.service == ServiceOpensearchServerless {
+		// OpenSearch Serverless requires the payload hash header
+		headers["x-amz-content-sha256"] = hash
+	}
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	// construct the canonical request
+	signedHeaders := slices.Sorted(maps.Keys(headers))
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		canonicalHeaders.WriteString(
+			name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		hash,
+	}, "\n")
+	// construct the string to sign
+	scope := strings.Join([]string{
+		now.Format(dateFormat),
+		s.region,
+		s.service,
+		"aws4_request",
+	}, "/")
+	stringToSign := strings.Join([]string{
+		algorithm,
+		now.Format(timeFormat),
+		scope,
+		hashSHA256([]byte(canonicalRequest)),
+	}, "\n")
+	// derive the signing key and sign
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(dateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.AccessKeyID, scope, strings.Join(signedHeaders, ";"),
+		signature))
+	return nil
+}
+
+// RoundTripper implements the http.RoundTripper interface. It signs each
+// request before handling it using the wrapped http.RoundTripper.
+type RoundTripper struct {
+	roundTripper http.RoundTripper
+	signer       *Signer
+}
+
+// NewRoundTripper returns a RoundTripper which signs requests using the given
+// Signer and then handles them using the given http.RoundTripper.
+func NewRoundTripper(
+	roundTripper http.RoundTripper,
+	signer *Signer,
+) *RoundTripper {
+	return &RoundTripper{roundTripper: roundTripper, signer: signer}
+}
+
+// RoundTrip signs a clone of the request and then handles it using the
+// wrapped http.RoundTripper.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed := req.Clone(req.Context())
+	if err := rt.signer.Sign(signed); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return rt.roundTripper.RoundTrip(signed)
+}
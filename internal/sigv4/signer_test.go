@@ -0,0 +1,147 @@
+package sigv4_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sigv4"
+)
+
+// staticCredentials is a static sigv4.CredentialsProvider.
+type staticCredentials sigv4.Credentials
+
+func (s staticCredentials) Retrieve(
+	context.Context) (sigv4.Credentials, error) {
+	return sigv4.Credentials(s), nil
+}
+
+// The test cases below are from the AWS Signature Version 4 test suite.
+var testSuiteCredentials = staticCredentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+func TestRoundTripper(t *testing.T) {
+	var testCases = map[string]struct {
+		method      string
+		path        string
+		credentials staticCredentials
+		expect      string
+	}{
+		"get-vanilla": {
+			method:      "GET",
+			path:        "/",
+			credentials: testSuiteCredentials,
+			expect: "AWS4-HMAC-SHA256 " +
+				"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"post-vanilla": {
+			method:      "POST",
+			path:        "/",
+			credentials: testSuiteCredentials,
+			expect: "AWS4-HMAC-SHA256 " +
+				"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		"get-vanilla-query-order-key-case": {
+			method:      "GET",
+			path:        "/?Param2=value2&Param1=value1",
+			credentials: testSuiteCredentials,
+			expect: "AWS4-HMAC-SHA256 " +
+				"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var authorization, date string
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					authorization = r.Header.Get("Authorization")
+					date = r.Header.Get("X-Amz-Date")
+				}))
+			defer ts.Close()
+			signer := sigv4.NewSigner(tc.credentials, "us-east-1", "service")
+			signer.SetNow(func() time.Time {
+				return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+			})
+			c := &http.Client{
+				Transport: sigv4.NewRoundTripper(http.DefaultTransport, signer),
+			}
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			// the test suite requests are made to this host
+			req.Host = "example.amazonaws.com"
+			res, err := c.Do(req)
+			assert.NoError(tt, err, name)
+			res.Body.Close()
+			assert.Equal(tt, "20150830T123600Z", date, name)
+			assert.Equal(tt, tc.expect, authorization, name)
+		})
+	}
+}
+
+func TestSignBody(t *testing.T) {
+	var testCases = map[string]struct {
+		service       string
+		sessionToken  string
+		expectHeaders []string
+	}{
+		"opensearch": {
+			service:       sigv4.ServiceOpensearch,
+			expectHeaders: []string{"host", "x-amz-date"},
+		},
+		"opensearch serverless": {
+			service: sigv4.ServiceOpensearchServerless,
+			expectHeaders: []string{"host", "x-amz-content-sha256",
+				"x-amz-date"},
+		},
+		"session token": {
+			service:      sigv4.ServiceOpensearch,
+			sessionToken: "token",
+			expectHeaders: []string{"host", "x-amz-date",
+				"x-amz-security-token"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var body string
+			var signedHeaders string
+			ts := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					buf, _ := io.ReadAll(r.Body)
+					body = string(buf)
+					_, after, _ := strings.Cut(r.Header.Get("Authorization"),
+						"SignedHeaders=")
+					signedHeaders, _, _ = strings.Cut(after, ",")
+				}))
+			defer ts.Close()
+			creds := testSuiteCredentials
+			creds.SessionToken = tc.sessionToken
+			signer := sigv4.NewSigner(creds, "us-east-1", tc.service)
+			c := &http.Client{
+				Transport: sigv4.NewRoundTripper(http.DefaultTransport, signer),
+			}
+			res, err := c.Post(ts.URL+"/_plugins/_security/api/roles/foo",
+				"application/json", strings.NewReader(`{"foo":"bar"}`))
+			assert.NoError(tt, err, name)
+			res.Body.Close()
+			// the body must be sent intact after it is hashed
+			assert.Equal(tt, `{"foo":"bar"}`, body, name)
+			assert.Equal(tt, strings.Join(tc.expectHeaders, ";"), signedHeaders,
+				name)
+		})
+	}
+}
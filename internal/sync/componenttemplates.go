@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"go.uber.org/zap"
+)
+
+// kubernetesComponentTemplate is the name of the built-in component template
+// which maps the Kubernetes metadata fields common to all Lagoon logs.
+const kubernetesComponentTemplate = "lagoon-kubernetes"
+
+// calculateComponentTemplateDiff returns a map of opensearch component
+// templates which should be created or replaced, and a sorted slice of
+// component template names which should be deleted, in order to reconcile
+// existing with required.
+//
+// Unlike index templates, component templates are not deleted and recreated
+// when they differ: Opensearch refuses to delete a component template which
+// is used by an index template, so "lagoon-owned" component templates which
+// are not equal to the required component template are replaced in place.
+// Existing component templates with the ownership marker in their _meta field
+// which are no longer required are deleted. Other component templates which
+// are not required are not touched.
+func calculateComponentTemplateDiff(existing,
+	required map[string]opensearch.ComponentTemplate,
+) (map[string]opensearch.ComponentTemplate, []string) {
+	toCreate := map[string]opensearch.ComponentTemplate{}
+	for name, rComponentTemplate := range required {
+		eComponentTemplate, ok := existing[name]
+		if !ok ||
+			!componentTemplatesEqual(eComponentTemplate, rComponentTemplate) {
+			toCreate[name] = rComponentTemplate
+		}
+	}
+	var toDelete []string
+	for name, eComponentTemplate := range existing {
+		if _, ok := required[name]; ok {
+			continue
+		}
+		if isOwned(eComponentTemplate.ComponentTemplateDefinition.Meta) {
+			toDelete = append(toDelete, name)
+		}
+	}
+	slices.Sort(toDelete)
+	return toCreate, toDelete
+}
+
+// generateComponentTemplates returns a map of component templates required by
+// Lagoon logging.
+func generateComponentTemplates() map[string]opensearch.ComponentTemplate {
+	return map[string]opensearch.ComponentTemplate{
+		kubernetesComponentTemplate: {
+			Name: kubernetesComponentTemplate,
+			ComponentTemplateDefinition: opensearch.ComponentTemplateDefinition{
+				Template: opensearch.Template{
+					Mappings: &opensearch.Mappings{
+						Properties: map[string]any{
+							"kubernetes": map[string]any{
+								"properties": map[string]any{
+									"container_image": stringField(),
+									"container_name":  stringField(),
+									"host":            stringField(),
+									"namespace_name":  stringField(),
+									"pod_id":          stringField(),
+									"pod_name":        stringField(),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// syncComponentTemplates reconciles Opensearch component templates with
+// Lagoon logging requirements. All required component templates are marked as
+// owned by the sync.
+//
+// Owned component templates which are no longer required are deleted after
+// the required component templates are created. Opensearch refuses the
+// deletion while an index template still uses the component template, so in
+// that case it is retried on the next sync, after the index templates have
+// been replaced.
+func syncComponentTemplates(ctx context.Context, log *zap.Logger,
+	o OpensearchService, dryRun bool, diff *DiffWriter) {
+	// get component templates from Opensearch
+	existing, err := o.ComponentTemplates(ctx)
+	if err != nil {
+		log.Error("couldn't get component templates from Opensearch",
+			zap.Error(err))
+		return
+	}
+	// generate the component templates required by Lagoon
+	required := generateComponentTemplates()
+	for name, ct := range required {
+		ct.ComponentTemplateDefinition.Meta =
+			withOwnerMeta(ct.ComponentTemplateDefinition.Meta)
+		required[name] = ct
+	}
+	// calculate component templates to create, replace, or delete
+	toCreate, toDelete := calculateComponentTemplateDiff(existing, required)
+	for _, name := range slices.Sorted(maps.Keys(toCreate)) {
+		ct := toCreate[name]
+		if dryRun {
+			log.Info("dry run mode: not creating component template",
+				zap.String("name", name))
+			var eComponentTemplate any
+			if e, ok := existing[name]; ok {
+				eComponentTemplate = e.ComponentTemplateDefinition
+			}
+			diff.write(log, "componenttemplate", "", name, eComponentTemplate,
+				ct.ComponentTemplateDefinition)
+			continue
+		}
+		err = o.CreateComponentTemplate(ctx, name, &ct)
+		if err != nil {
+			log.Warn("couldn't create component template", zap.Error(err))
+			continue
+		}
+		log.Info("created component template", zap.String("name", name))
+	}
+	for _, name := range toDelete {
+		if dryRun {
+			log.Info("dry run mode: not deleting component template",
+				zap.String("name", name))
+			diff.write(log, "componenttemplate", "", name,
+				existing[name].ComponentTemplateDefinition, nil)
+			continue
+		}
+		err = o.DeleteComponentTemplate(ctx, name)
+		if err != nil {
+			log.Warn("couldn't delete component template", zap.Error(err))
+			continue
+		}
+		log.Info("deleted component template", zap.String("name", name))
+	}
+}
@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func TestCalculateComponentTemplateDiff(t *testing.T) {
+	version := 2
+	var testCases = map[string]struct {
+		existing map[string]opensearch.ComponentTemplate
+		required map[string]opensearch.ComponentTemplate
+		expect   map[string]opensearch.ComponentTemplate
+		toDelete []string
+	}{
+		"no diff": {
+			existing: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+			required: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+			expect: map[string]opensearch.ComponentTemplate{},
+		},
+		"create component template": {
+			existing: map[string]opensearch.ComponentTemplate{},
+			required: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+			expect: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+		},
+		"keep unknown component template": {
+			existing: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+				"manually-created":  {Name: "manually-created"},
+			},
+			required: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+			expect: map[string]opensearch.ComponentTemplate{},
+		},
+		"replace unequal component template": {
+			existing: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+			required: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {
+					Name: "lagoon-kubernetes",
+					ComponentTemplateDefinition: opensearch.ComponentTemplateDefinition{
+						Version: &version,
+					},
+				},
+			},
+			expect: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {
+					Name: "lagoon-kubernetes",
+					ComponentTemplateDefinition: opensearch.ComponentTemplateDefinition{
+						Version: &version,
+					},
+				},
+			},
+		},
+		"delete owned component template": {
+			existing: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+				"lagoon-old": {
+					Name: "lagoon-old",
+					ComponentTemplateDefinition: opensearch.ComponentTemplateDefinition{
+						Meta: withOwnerMeta(nil),
+					},
+				},
+			},
+			required: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+			expect:   map[string]opensearch.ComponentTemplate{},
+			toDelete: []string{"lagoon-old"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			toCreate, toDelete :=
+				calculateComponentTemplateDiff(tc.existing, tc.required)
+			if !reflect.DeepEqual(toCreate, tc.expect) {
+				tt.Fatalf("got:\n%v\nexpected:\n%v\n", toCreate, tc.expect)
+			}
+			if !reflect.DeepEqual(toDelete, tc.toDelete) {
+				tt.Fatalf("got:\n%v\nexpected:\n%v\n", toDelete, tc.toDelete)
+			}
+		})
+	}
+}
+
+func TestGenerateIndexTemplatesComposedOf(t *testing.T) {
+	var testCases = map[string]struct {
+		componentTemplates bool
+		expect             []string
+	}{
+		"component templates enabled": {
+			componentTemplates: true,
+			expect:             []string{"lagoon-kubernetes"},
+		},
+		"component templates disabled": {},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			required := generateComponentTemplates()
+			for itName, it := range allIndexTemplates(50, tc.componentTemplates, nil) {
+				composedOf := it.IndexTemplateDefinition.ComposedOf
+				if !reflect.DeepEqual(composedOf, tc.expect) {
+					tt.Fatalf("%s: got %v, expected %v", itName, composedOf, tc.expect)
+				}
+				for _, ctName := range composedOf {
+					if _, ok := required[ctName]; !ok {
+						tt.Fatalf("%s: unknown component template %s", itName, ctName)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
+	"go.uber.org/zap"
+)
+
+// Dry run diff formats.
+const (
+	// DiffFormatJSONPatch writes a JSON object per line, containing an RFC 6902
+	// JSON Patch for each changed Opensearch object.
+	DiffFormatJSONPatch = "jsonpatch"
+	// DiffFormatUnified writes a unified diff of the indented JSON
+	// representation of each changed Opensearch object.
+	DiffFormatUnified = "unified"
+)
+
+// patchRecord is written for each object in DiffFormatJSONPatch format.
+type patchRecord struct {
+	Cluster string                `json:"cluster,omitempty"`
+	Object  string                `json:"object"`
+	Tenant  string                `json:"tenant,omitempty"`
+	Name    string                `json:"name"`
+	Patch   []jsonpatch.Operation `json:"patch"`
+}
+
+// DiffWriter writes the differences between the existing and required
+// representations of Opensearch objects in dry run mode, so that reviewers
+// can see exactly which permissions would change.
+//
+// A nil *DiffWriter is valid, and writes nothing.
+type DiffWriter struct {
+	format  string
+	w       io.Writer
+	cluster string
+}
+
+// NewDiffWriter returns a new DiffWriter which writes differences to w in the
+// given format.
+func NewDiffWriter(w io.Writer, format string) (*DiffWriter, error) {
+	switch format {
+	case DiffFormatJSONPatch, DiffFormatUnified:
+		return &DiffWriter{format: format, w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown diff format: %s", format)
+	}
+}
+
+// withCluster returns a copy of the DiffWriter which identifies the objects
+// it writes as belonging to the named cluster. This is used to distinguish
+// the changes to each target when synchronising multiple clusters.
+func (dw *DiffWriter) withCluster(cluster string) *DiffWriter {
+	if dw == nil {
+		return nil
+	}
+	return &DiffWriter{format: dw.format, w: dw.w, cluster: cluster}
+}
+
+// write the difference between the existing and required representations of
+// the given object. A nil existing value means that the object will be
+// created, and a nil required value means that the object will be deleted.
+// The tenant is only set for objects which exist within a tenant.
+//
+// Errors are logged rather than returned, since a failure to write the diff
+// shouldn't interrupt the sync.
+func (dw *DiffWriter) write(log *zap.Logger, object, tenant, name string,
+	existing, required any) {
+	if dw == nil {
+		return
+	}
+	var err error
+	switch dw.format {
+	case DiffFormatJSONPatch:
+		err = dw.writeJSONPatch(object, tenant, name, existing, required)
+	case DiffFormatUnified:
+		err = dw.writeUnified(object, tenant, name, existing, required)
+	}
+	if err != nil {
+		log.Warn("couldn't write dry run diff", zap.String("object", object),
+			zap.String("tenant", tenant), zap.String("name", name), zap.Error(err))
+	}
+}
+
+// writeJSONPatch writes a single patchRecord as a line of JSON.
+func (dw *DiffWriter) writeJSONPatch(object, tenant, name string,
+	existing, required any) error {
+	patch, err := jsonpatch.Diff(existing, required)
+	if err != nil {
+		return fmt.Errorf("couldn't calculate JSON patch: %v", err)
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+	return json.NewEncoder(dw.w).Encode(patchRecord{
+		Cluster: dw.cluster,
+		Object:  object,
+		Tenant:  tenant,
+		Name:    name,
+		Patch:   patch,
+	})
+}
+
+// indentedJSON returns the indented JSON representation of v, with a trailing
+// newline. A nil v is represented by an empty string.
+func indentedJSON(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// writeUnified writes a unified diff between the indented JSON
+// representations of existing and required.
+func (dw *DiffWriter) writeUnified(object, tenant, name string,
+	existing, required any) error {
+	before, err := indentedJSON(existing)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal existing object: %v", err)
+	}
+	after, err := indentedJSON(required)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal required object: %v", err)
+	}
+	if before == after {
+		return nil
+	}
+	objectPath := path.Join(dw.cluster, object, tenant, name)
+	edits := myers.ComputeEdits(span.URIFromPath(objectPath), before, after)
+	_, err = fmt.Fprint(dw.w, gotextdiff.ToUnified(
+		"existing/"+objectPath, "required/"+objectPath, before, edits))
+	return err
+}
@@ -0,0 +1,93 @@
+package sync_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+func TestDiffWriter(t *testing.T) {
+	existing := opensearch.RolePermissions{
+		ClusterPermissions: []string{},
+		IndexPermissions: []opensearch.IndexPermission{
+			{
+				AllowedActions: []string{"read"},
+				IndexPatterns:  []string{"router-logs-foo-_-*"},
+			},
+		},
+		TenantPermissions: []opensearch.TenantPermission{},
+	}
+	required := opensearch.RolePermissions{
+		ClusterPermissions: []string{},
+		IndexPermissions: []opensearch.IndexPermission{
+			{
+				AllowedActions: []string{"read"},
+				IndexPatterns: []string{
+					"router-logs-foo-_-*",
+					"router-logs-bar-_-*",
+				},
+			},
+		},
+		TenantPermissions: []opensearch.TenantPermission{},
+	}
+	type input struct {
+		existing any
+		required any
+	}
+	var testCases = map[string]struct {
+		format string
+		input  input
+		expect string
+	}{
+		"jsonpatch replace": {
+			format: sync.DiffFormatJSONPatch,
+			input:  input{existing: existing, required: required},
+			expect: `{"object":"role","name":"drupal-example","patch":[` +
+				`{"op":"add","path":"/index_permissions/0/index_patterns/1",` +
+				`"value":"router-logs-bar-_-*"}]}` + "\n",
+		},
+		"jsonpatch delete": {
+			format: sync.DiffFormatJSONPatch,
+			input:  input{existing: existing},
+			expect: `{"object":"role","name":"drupal-example","patch":[` +
+				`{"op":"remove","path":""}]}` + "\n",
+		},
+		"jsonpatch no change": {
+			format: sync.DiffFormatJSONPatch,
+			input:  input{existing: existing, required: existing},
+			expect: "",
+		},
+		"unified replace": {
+			format: sync.DiffFormatUnified,
+			input:  input{existing: existing, required: required},
+			expect: `--- existing/role/drupal-example
++++ required/role/drupal-example
+@@ -7,7 +7,8 @@
+       ],
+       "fls": null,
+       "index_patterns": [
+-        "router-logs-foo-_-*"
++        "router-logs-foo-_-*",
++        "router-logs-bar-_-*"
+       ],
+       "masked_fields": null
+     }
+`,
+		},
+	}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var buf bytes.Buffer
+			dw, err := sync.NewDiffWriter(&buf, tc.format)
+			assert.NoError(tt, err, name)
+			sync.DiffWriterWrite(dw, log, "role", "", "drupal-example",
+				tc.input.existing, tc.input.required)
+			assert.Equal(tt, tc.expect, buf.String(), name)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"go.uber.org/zap"
+)
+
+// developmentEnvironmentNames returns a map of project ID to a sorted slice of
+// the names of the development environments of the project, where the names
+// are munged in a Lagoon-compatible manner for use in index patterns.
+func developmentEnvironmentNames(
+	environments []lagoondb.Environment,
+) map[int][]string {
+	devEnvs := map[int][]string{}
+	for _, env := range environments {
+		if env.EnvironmentType != lagoondb.EnvironmentTypeDevelopment {
+			continue
+		}
+		devEnvs[env.ProjectID] = append(devEnvs[env.ProjectID],
+			lagoonName.ReplaceAllLiteralString(strings.ToLower(env.Name), `-`))
+	}
+	for _, names := range devEnvs {
+		slices.Sort(names)
+	}
+	return devEnvs
+}
+
+// generateDevelopmentIndexPermissionPatterns returns a slice of index pattern
+// strings which match only the logs of the development environments of the
+// given projects.
+func generateDevelopmentIndexPermissionPatterns(
+	log *zap.Logger,
+	pids []int,
+	projectNames map[int]string,
+	developmentEnvironments map[int][]string,
+) []string {
+	return generateFamilyIndexPermissionPatterns(log, pids, projectNames,
+		LogFamilies, false, developmentEnvironments)
+}
+
+// developmentOnlyProjects returns the set of IDs of the projects of the
+// given development-only Lagoon groups.
+func developmentOnlyProjects(
+	log *zap.Logger,
+	groups []keycloak.Group,
+	groupProjectsMap map[string][]int,
+	developmentOnlyGroups []string,
+) map[int]bool {
+	pids := map[int]bool{}
+	for _, group := range regularGroups(log, groups, groupProjectsMap) {
+		if !slices.Contains(developmentOnlyGroups, group.Name) {
+			continue
+		}
+		for _, pid := range groupProjectsMap[group.ID] {
+			pids[pid] = true
+		}
+	}
+	return pids
+}
+
+// restrictedProjectGroups returns the Lagoon project-default-groups which
+// belong to any of the given restricted projects.
+func restrictedProjectGroups(
+	log *zap.Logger,
+	groups []keycloak.Group,
+	groupProjectsMap map[string][]int,
+	restricted map[int]bool,
+) []keycloak.Group {
+	var projectGroups []keycloak.Group
+	for _, group := range groups {
+		if !isLagoonGroup(group, groupProjectsMap) || !isProjectGroup(log, group) {
+			continue
+		}
+		if slices.ContainsFunc(groupProjectsMap[group.ID],
+			func(pid int) bool { return restricted[pid] }) {
+			projectGroups = append(projectGroups, group)
+		}
+	}
+	return projectGroups
+}
+
+// generateProjectGroupRole constructs an opensearch.Role from the given
+// keycloak group corresponding to a Lagoon project-default-group. It grants
+// the same access as the project role of each project of the group.
+func generateProjectGroupRole(
+	log *zap.Logger,
+	group keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+) *opensearch.Role {
+	return &opensearch.Role{
+		RolePermissions: opensearch.RolePermissions{
+			// use an empty slice instead of omitting this entirely because the
+			// Opensearch API errors if this field is omitted.
+			ClusterPermissions: []string{},
+			IndexPermissions: generateIndexPermissions(
+				generateIndexPermissionPatterns(log, groupProjectsMap[group.ID],
+					projectNames)),
+			TenantPermissions: []opensearch.TenantPermission{
+				{
+					AllowedActions: []string{"kibana_all_read"},
+					TenantPatterns: []string{"global_tenant"},
+				},
+			},
+		},
+	}
+}
+
+// restrictRolesToDevelopment replaces the index permissions of the roles of
+// the given development-only groups in roles, so that members of those groups
+// can only read the logs of development environments.
+//
+// Members of a Lagoon group are also mapped to the p<id> project role of each
+// project of the group, so the project roles of the projects of
+// development-only groups are restricted in the same way. Members of the
+// project-default-groups of those projects keep access to all environments
+// via a role named after the project-default-group.
+func restrictRolesToDevelopment(
+	log *zap.Logger,
+	roles map[string]opensearch.Role,
+	groups []keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+	developmentOnlyGroups []string,
+	developmentEnvironments map[int][]string,
+) {
+	for _, group := range regularGroups(log, groups, groupProjectsMap) {
+		if !slices.Contains(developmentOnlyGroups, group.Name) {
+			continue
+		}
+		role, ok := roles[group.Name]
+		if !ok {
+			continue
+		}
+		role.IndexPermissions = generateIndexPermissions(
+			generateDevelopmentIndexPermissionPatterns(log,
+				groupProjectsMap[group.ID], projectNames, developmentEnvironments))
+		roles[group.Name] = role
+	}
+	restricted := developmentOnlyProjects(log, groups, groupProjectsMap,
+		developmentOnlyGroups)
+	for pid := range restricted {
+		name := fmt.Sprintf("p%d", pid)
+		role, ok := roles[name]
+		if !ok {
+			continue
+		}
+		role.IndexPermissions = generateIndexPermissions(
+			generateDevelopmentIndexPermissionPatterns(log, []int{pid},
+				projectNames, developmentEnvironments))
+		roles[name] = role
+	}
+	for _, group := range restrictedProjectGroups(log, groups, groupProjectsMap,
+		restricted) {
+		if _, ok := roles[group.Name]; ok {
+			log.Warn("ignoring project group role with conflicting name",
+				zap.String("name", group.Name))
+			continue
+		}
+		roles[group.Name] = *generateProjectGroupRole(log, group, projectNames,
+			groupProjectsMap)
+	}
+}
+
+// restrictRolesMappingToDevelopment adds a rolemapping to rolesmapping for
+// each role added by restrictRolesToDevelopment for a project-default-group.
+// Each rolemapping maps the role from the backend role of the same name.
+func restrictRolesMappingToDevelopment(
+	log *zap.Logger,
+	rolesmapping map[string]opensearch.RoleMapping,
+	groups []keycloak.Group,
+	groupProjectsMap map[string][]int,
+	developmentOnlyGroups []string,
+) {
+	restricted := developmentOnlyProjects(log, groups, groupProjectsMap,
+		developmentOnlyGroups)
+	for _, group := range restrictedProjectGroups(log, groups, groupProjectsMap,
+		restricted) {
+		if _, ok := rolesmapping[group.Name]; ok {
+			log.Warn("ignoring project group rolemapping with conflicting name",
+				zap.String("name", group.Name))
+			continue
+		}
+		rolesmapping[group.Name] = opensearch.RoleMapping{
+			RoleMappingPermissions: opensearch.RoleMappingPermissions{
+				BackendRoles:    []string{group.Name},
+				AndBackendRoles: []string{},
+				Hosts:           []string{},
+				Users:           []string{},
+			},
+		}
+	}
+}
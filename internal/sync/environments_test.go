@@ -0,0 +1,163 @@
+package sync_test
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+func TestDevelopmentEnvironmentNames(t *testing.T) {
+	environments := []lagoondb.Environment{
+		{ID: 1, Name: "main", ProjectID: 33, EnvironmentType: "production"},
+		{ID: 2, Name: "feature/Foo", ProjectID: 33, EnvironmentType: "development"},
+		{ID: 3, Name: "develop", ProjectID: 33, EnvironmentType: "development"},
+		{ID: 4, Name: "master", ProjectID: 34, EnvironmentType: "production"},
+		{ID: 5, Name: "pr-12", ProjectID: 35, EnvironmentType: "development"},
+	}
+	expect := map[int][]string{
+		33: {"develop", "feature-foo"},
+		35: {"pr-12"},
+	}
+	assert.Equal(t, expect, sync.DevelopmentEnvironmentNames(environments),
+		"development environment names")
+}
+
+func TestRestrictRolesToDevelopment(t *testing.T) {
+	groups := []keycloak.Group{
+		{
+			ID: "id-dev-group",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "dev-group",
+			},
+		},
+		{
+			ID: "id-prod-group",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "prod-group",
+			},
+		},
+		{
+			ID: "id-no-dev-envs",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "no-dev-envs",
+			},
+		},
+		{
+			ID: "id-project-foo",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "project-foo",
+				Attributes: map[string][]string{
+					"type": {"project-default-group"},
+				},
+			},
+		},
+		{
+			ID: "id-project-baz",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "project-baz",
+				Attributes: map[string][]string{
+					"type": {"project-default-group"},
+				},
+			},
+		},
+	}
+	projectNames := map[int]string{33: "foo", 34: "bar", 35: "baz"}
+	groupProjectsMap := map[string][]int{
+		"id-dev-group":   {33, 34},
+		"id-prod-group":  {33, 34, 35},
+		"id-no-dev-envs": {34},
+		"id-project-foo": {33},
+		"id-project-baz": {35},
+	}
+	developmentEnvironments := map[int][]string{
+		33: {"develop", "feature-foo"},
+	}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	roles := sync.GenerateRoles(log, groups, projectNames, groupProjectsMap)
+	prodRole := roles["prod-group"]
+	unrestrictedProjectRole := roles["p35"]
+	sync.RestrictRolesToDevelopment(log, roles, groups, projectNames,
+		groupProjectsMap, []string{"dev-group", "no-dev-envs", "missing-group"},
+		developmentEnvironments)
+	assert.Equal(t, prodRole, roles["prod-group"], "unrestricted role")
+	assert.Equal(t, []opensearch.IndexPermission{
+		{
+			AllowedActions: []string{
+				"read",
+				"indices:monitor/settings/get",
+			},
+			IndexPatterns: []string{
+				"application-logs-foo-_-develop-_-*",
+				"application-logs-foo-_-feature-foo-_-*",
+				"container-logs-foo-_-develop-_-*",
+				"container-logs-foo-_-feature-foo-_-*",
+				"lagoon-logs-foo-_-develop-_-*",
+				"lagoon-logs-foo-_-feature-foo-_-*",
+				"router-logs-foo-_-develop-_-*",
+				"router-logs-foo-_-feature-foo-_-*",
+			},
+			MaskedFields: []string{},
+		},
+	}, roles["dev-group"].IndexPermissions, "restricted role")
+	assert.Equal(t, prodRole.TenantPermissions[0].AllowedActions,
+		roles["dev-group"].TenantPermissions[0].AllowedActions,
+		"restricted role tenant permissions")
+	assert.Equal(t, []opensearch.IndexPermission{},
+		roles["no-dev-envs"].IndexPermissions, "restricted role without envs")
+	_, ok := roles["missing-group"]
+	assert.False(t, ok, "missing group")
+	assert.Equal(t, []opensearch.IndexPermission{
+		{
+			AllowedActions: []string{
+				"read",
+				"indices:monitor/settings/get",
+			},
+			IndexPatterns: []string{
+				"application-logs-foo-_-develop-_-*",
+				"application-logs-foo-_-feature-foo-_-*",
+				"container-logs-foo-_-develop-_-*",
+				"container-logs-foo-_-feature-foo-_-*",
+				"lagoon-logs-foo-_-develop-_-*",
+				"lagoon-logs-foo-_-feature-foo-_-*",
+				"router-logs-foo-_-develop-_-*",
+				"router-logs-foo-_-feature-foo-_-*",
+			},
+			MaskedFields: []string{},
+		},
+	}, roles["p33"].IndexPermissions, "restricted project role")
+	assert.Equal(t, []opensearch.IndexPermission{},
+		roles["p34"].IndexPermissions, "restricted project role without envs")
+	assert.Equal(t, unrestrictedProjectRole, roles["p35"],
+		"unrestricted project role")
+	assert.Equal(t, []opensearch.IndexPermission{
+		{
+			AllowedActions: []string{
+				"read",
+				"indices:monitor/settings/get",
+			},
+			IndexPatterns: []string{
+				"application-logs-foo-_-*",
+				"container-logs-foo-_-*",
+				"lagoon-logs-foo-_-*",
+				"router-logs-foo-_-*",
+			},
+			MaskedFields: []string{},
+		},
+	}, roles["project-foo"].IndexPermissions, "restricted project group role")
+	_, ok = roles["project-baz"]
+	assert.False(t, ok, "unrestricted project group")
+	rolesmapping := sync.GenerateRolesMapping(log, groups, projectNames,
+		groupProjectsMap)
+	sync.RestrictRolesMappingToDevelopment(log, rolesmapping, groups,
+		groupProjectsMap, []string{"dev-group", "no-dev-envs", "missing-group"})
+	assert.Equal(t, []string{"project-foo"},
+		rolesmapping["project-foo"].BackendRoles,
+		"restricted project group rolemapping")
+	_, ok = rolesmapping["project-baz"]
+	assert.False(t, ok, "unrestricted project group rolemapping")
+}
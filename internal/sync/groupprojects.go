@@ -0,0 +1,178 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"go.uber.org/zap"
+)
+
+// Sources of Lagoon group project membership.
+const (
+	// GroupProjectsSourceLagoon reads group project membership from the
+	// Lagoon data source.
+	GroupProjectsSourceLagoon = "lagoon"
+	// GroupProjectsSourceKeycloak reads group project membership from the
+	// lagoon-projects attribute of the Keycloak groups.
+	GroupProjectsSourceKeycloak = "keycloak"
+	// GroupProjectsSourceCompare reads group project membership from the
+	// Lagoon data source, and logs any disagreements with Keycloak.
+	GroupProjectsSourceCompare = "compare"
+)
+
+// cachedGroups is a KeycloakService which retains the groups read by the
+// most recent call to Groups, so that group project membership can be
+// derived from them without reading the groups from Keycloak again.
+type cachedGroups struct {
+	KeycloakService
+	log    *zap.Logger
+	mu     sync.Mutex
+	groups []keycloak.Group
+}
+
+// Groups implements KeycloakService.
+func (c *cachedGroups) Groups(ctx context.Context) ([]keycloak.Group, error) {
+	groups, err := c.KeycloakService.Groups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.groups = groups
+	c.mu.Unlock()
+	return groups, nil
+}
+
+// groupProjectsMap returns the group project membership derived from the
+// lagoon-projects attribute of the groups read by the most recent call to
+// Groups. If Groups has not been called, the groups are read from Keycloak.
+func (c *cachedGroups) groupProjectsMap(
+	ctx context.Context,
+) (map[string][]int, error) {
+	c.mu.Lock()
+	groups := c.groups
+	c.mu.Unlock()
+	if groups == nil {
+		var err error
+		if groups, err = c.Groups(ctx); err != nil {
+			return nil, fmt.Errorf("couldn't get groups: %v", err)
+		}
+	}
+	return keycloak.GroupProjectsMap(c.log, groups), nil
+}
+
+// keycloakGroupProjects is a LagoonDBService which reads group project
+// membership from Keycloak.
+type keycloakGroupProjects struct {
+	LagoonDBService
+	k *cachedGroups
+}
+
+// GroupProjectsMap implements LagoonDBService.
+func (s *keycloakGroupProjects) GroupProjectsMap(
+	ctx context.Context,
+) (map[string][]int, error) {
+	return s.k.groupProjectsMap(ctx)
+}
+
+// comparedGroupProjects is a LagoonDBService which logs any disagreements in
+// group project membership between Lagoon and Keycloak.
+type comparedGroupProjects struct {
+	LagoonDBService
+	log *zap.Logger
+	k   *cachedGroups
+}
+
+// GroupProjectsMap implements LagoonDBService. It returns the group project
+// membership from Lagoon. Failure to read group project membership from
+// Keycloak is logged, but is not an error.
+func (s *comparedGroupProjects) GroupProjectsMap(
+	ctx context.Context,
+) (map[string][]int, error) {
+	lagoonMap, err := s.LagoonDBService.GroupProjectsMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keycloakMap, err := s.k.groupProjectsMap(ctx)
+	if err != nil {
+		s.log.Warn("couldn't compare group project membership with keycloak",
+			zap.Error(err))
+		return lagoonMap, nil
+	}
+	compareGroupProjectsMaps(s.log, lagoonMap, keycloakMap)
+	return lagoonMap, nil
+}
+
+// compareGroupProjectsMaps logs a warning for each group whose projects
+// differ between the given Lagoon and Keycloak group projects maps, and
+// returns the number of groups which differ.
+func compareGroupProjectsMaps(
+	log *zap.Logger,
+	lagoonMap,
+	keycloakMap map[string][]int,
+) int {
+	var disagreements int
+	groupIDs := slices.Sorted(maps.Keys(lagoonMap))
+	for gid := range keycloakMap {
+		if _, ok := lagoonMap[gid]; !ok {
+			groupIDs = append(groupIDs, gid)
+		}
+	}
+	slices.Sort(groupIDs)
+	for _, gid := range groupIDs {
+		var onlyLagoon, onlyKeycloak []int
+		for _, pid := range lagoonMap[gid] {
+			if !slices.Contains(keycloakMap[gid], pid) {
+				onlyLagoon = append(onlyLagoon, pid)
+			}
+		}
+		for _, pid := range keycloakMap[gid] {
+			if !slices.Contains(lagoonMap[gid], pid) {
+				onlyKeycloak = append(onlyKeycloak, pid)
+			}
+		}
+		if len(onlyLagoon) == 0 && len(onlyKeycloak) == 0 {
+			continue
+		}
+		disagreements++
+		log.Warn("group project membership differs between lagoon and keycloak",
+			zap.String("groupID", gid),
+			zap.Ints("onlyLagoon", onlyLagoon),
+			zap.Ints("onlyKeycloak", onlyKeycloak))
+	}
+	if disagreements == 0 {
+		log.Debug("group project membership matches between lagoon and keycloak")
+	}
+	return disagreements
+}
+
+// WithGroupProjectsSource returns a LagoonDBService which reads group project
+// membership from the given source, and all other Lagoon data from l. It also
+// returns a KeycloakService which should be used in place of k.
+//
+// Group project membership read from Keycloak is derived from the groups read
+// by the most recent call to Groups on the returned KeycloakService, so the
+// groups should be read before group project membership.
+func WithGroupProjectsSource(
+	log *zap.Logger,
+	l LagoonDBService,
+	k KeycloakService,
+	source string,
+) (LagoonDBService, KeycloakService, error) {
+	switch source {
+	case GroupProjectsSourceLagoon:
+		return l, k, nil
+	case GroupProjectsSourceKeycloak:
+		cached := &cachedGroups{KeycloakService: k, log: log}
+		return &keycloakGroupProjects{LagoonDBService: l, k: cached}, cached, nil
+	case GroupProjectsSourceCompare:
+		cached := &cachedGroups{KeycloakService: k, log: log}
+		return &comparedGroupProjects{LagoonDBService: l, log: log, k: cached},
+			cached, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown group projects source: %s", source)
+	}
+}
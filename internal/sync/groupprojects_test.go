@@ -0,0 +1,99 @@
+package sync_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+func TestCompareGroupProjectsMaps(t *testing.T) {
+	var testCases = map[string]struct {
+		lagoonMap   map[string][]int
+		keycloakMap map[string][]int
+		expect      int
+	}{
+		"equal": {
+			lagoonMap:   map[string][]int{"a": {1, 2}, "b": {3}},
+			keycloakMap: map[string][]int{"a": {1, 2}, "b": {3}},
+			expect:      0,
+		},
+		"different projects": {
+			lagoonMap:   map[string][]int{"a": {1, 2}, "b": {3}},
+			keycloakMap: map[string][]int{"a": {1}, "b": {3, 4}},
+			expect:      2,
+		},
+		"missing groups": {
+			lagoonMap:   map[string][]int{"a": {1}},
+			keycloakMap: map[string][]int{"b": {1}},
+			expect:      2,
+		},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expect,
+				sync.CompareGroupProjectsMaps(log, tc.lagoonMap, tc.keycloakMap), name)
+		})
+	}
+}
+
+func TestWithGroupProjectsSource(t *testing.T) {
+	lagoonMap := map[string][]int{"a": {1}}
+	keycloakMap := map[string][]int{"a": {1, 2}, "b": {3}}
+	// group-b has a malformed attribute, which must not prevent either the
+	// keycloak or compare source from reading group project membership
+	groups := []keycloak.Group{
+		{
+			ID: "a",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "group-a",
+				Attributes: map[string][]string{
+					"lagoon-projects": {"1,2"},
+				},
+			},
+		},
+		{
+			ID: "b",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "group-b",
+				Attributes: map[string][]string{
+					"lagoon-projects": {"3,foo"},
+				},
+			},
+		},
+	}
+	var testCases = map[string]struct {
+		source      string
+		expect      map[string][]int
+		expectError bool
+	}{
+		"lagoon":   {source: sync.GroupProjectsSourceLagoon, expect: lagoonMap},
+		"keycloak": {source: sync.GroupProjectsSourceKeycloak, expect: keycloakMap},
+		"compare":  {source: sync.GroupProjectsSourceCompare, expect: lagoonMap},
+		"unknown":  {source: "foo", expectError: true},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			fk := &fakeKeycloak{groups: groups}
+			l, k, err := sync.WithGroupProjectsSource(log,
+				&fakeLagoonDB{groupProjectsMap: lagoonMap}, fk, tc.source)
+			if tc.expectError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			ctx := context.Background()
+			_, err = k.Groups(ctx)
+			assert.NoError(tt, err, name)
+			groupProjectsMap, err := l.GroupProjectsMap(ctx)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expect, groupProjectsMap, name)
+			assert.Equal(tt, 1, fk.calls, "keycloak groups calls")
+		})
+	}
+}
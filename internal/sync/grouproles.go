@@ -0,0 +1,304 @@
+package sync
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"go.uber.org/zap"
+)
+
+// LogFamilies are the prefixes of the Lagoon log indices.
+var LogFamilies = []string{
+	"application-logs",
+	"container-logs",
+	"lagoon-logs",
+	"router-logs",
+}
+
+// GroupRolePermissions is the set of permissions granted to the members of a
+// Lagoon group who have a given Lagoon group role.
+type GroupRolePermissions struct {
+	// Families is the list of log index families which can be read, e.g.
+	// router-logs.
+	Families []string `json:"families"`
+	// Production allows reading the logs of production environments, as well
+	// as development environments.
+	Production bool `json:"production"`
+	// Reports allows reading and downloading Reports.
+	Reports bool `json:"reports"`
+	// TenantWrite allows writing to the group tenant, rather than only
+	// reading.
+	TenantWrite bool `json:"tenantWrite"`
+}
+
+// lagoonGroupRoles are the roles of the members of a Lagoon group.
+var lagoonGroupRoles = []string{
+	"guest",
+	"reporter",
+	"developer",
+	"maintainer",
+	"owner",
+}
+
+// defaultGroupRoles returns a map of each Lagoon group role to the
+// permissions granted to all members of a Lagoon group by the role named
+// after the group. It is used when some group roles are development-only,
+// but no group role permission sets are configured.
+func defaultGroupRoles() map[string]GroupRolePermissions {
+	groupRoles := map[string]GroupRolePermissions{}
+	for _, groupRole := range lagoonGroupRoles {
+		groupRoles[groupRole] = GroupRolePermissions{
+			Families:    LogFamilies,
+			Production:  true,
+			Reports:     true,
+			TenantWrite: true,
+		}
+	}
+	return groupRoles
+}
+
+// ValidateDevelopmentOnlyGroupRoles checks that each of the given
+// development-only group roles is one of the given group roles, or one of the
+// Lagoon group roles if groupRoles is empty.
+func ValidateDevelopmentOnlyGroupRoles(
+	groupRoles map[string]GroupRolePermissions,
+	developmentOnlyGroupRoles []string,
+) error {
+	if len(groupRoles) == 0 {
+		groupRoles = defaultGroupRoles()
+	}
+	for _, groupRole := range developmentOnlyGroupRoles {
+		if _, ok := groupRoles[groupRole]; !ok {
+			return fmt.Errorf("unknown group role %s", groupRole)
+		}
+	}
+	return nil
+}
+
+// Validate the GroupRolePermissions.
+func (p *GroupRolePermissions) Validate() error {
+	for _, family := range p.Families {
+		if !slices.Contains(LogFamilies, family) {
+			return fmt.Errorf("unknown log family %s", family)
+		}
+	}
+	return nil
+}
+
+// generateFamilyIndexPermissionPatterns returns a slice of index pattern
+// strings which match the logs of the given families of the given projects.
+// If production is false, only the logs of development environments are
+// matched.
+func generateFamilyIndexPermissionPatterns(
+	log *zap.Logger,
+	pids []int,
+	projectNames map[int]string,
+	families []string,
+	production bool,
+	developmentEnvironments map[int][]string,
+) []string {
+	var patterns []string
+	for _, pid := range pids {
+		name, ok := projectNames[pid]
+		if !ok {
+			// See the comment in generateIndexPermissionPatterns.
+			log.Warn("invalid project ID when generating index permission patterns",
+				zap.Int("projectID", pid))
+			continue
+		}
+		for _, family := range families {
+			if production {
+				patterns = append(patterns, fmt.Sprintf(`%s-%s-_-*`, family, name))
+				continue
+			}
+			for _, env := range developmentEnvironments[pid] {
+				patterns = append(patterns,
+					fmt.Sprintf(`%s-%s-_-%s-_-*`, family, name, env))
+			}
+		}
+	}
+	return patterns
+}
+
+// generateGroupRoleRole constructs an opensearch.Role for the members of the
+// given keycloak group corresponding to a Lagoon group, who have a Lagoon
+// group role with the given permissions.
+//
+// Project-default-groups don't have a tenant, so the role of a
+// project-default-group grants read access to the global tenant, as the
+// project role does.
+func generateGroupRoleRole(
+	log *zap.Logger,
+	group keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+	permissions GroupRolePermissions,
+	developmentOnly bool,
+	developmentEnvironments map[int][]string,
+) *opensearch.Role {
+	indexPatterns := generateFamilyIndexPermissionPatterns(log,
+		groupProjectsMap[group.ID], projectNames, permissions.Families,
+		permissions.Production && !developmentOnly, developmentEnvironments)
+	// use an empty slice instead of omitting this entirely because the
+	// Opensearch API errors if this field is omitted.
+	clusterPermissions := []string{}
+	if permissions.Reports {
+		// Allow users to read and download Reports
+		// https://github.com/opensearch-project/security/blob/2.7.0.0/config/
+		// 		roles.yml#L126-L132
+		clusterPermissions = []string{
+			"cluster:admin/opendistro/reports/instance/list",
+			"cluster:admin/opendistro/reports/instance/get",
+			"cluster:admin/opendistro/reports/menu/download",
+		}
+	}
+	tenantAction, tenant := "kibana_all_read", group.Name
+	if isProjectGroup(log, group) {
+		tenant = "global_tenant"
+	} else if permissions.TenantWrite {
+		tenantAction = "kibana_all_write"
+	}
+	return &opensearch.Role{
+		RolePermissions: opensearch.RolePermissions{
+			ClusterPermissions: clusterPermissions,
+			IndexPermissions:   generateIndexPermissions(indexPatterns),
+			TenantPermissions: []opensearch.TenantPermission{
+				{
+					AllowedActions: []string{tenantAction},
+					TenantPatterns: []string{tenant},
+				},
+			},
+		},
+	}
+}
+
+// regularGroups returns the regular Lagoon groups in the given slice of
+// keycloak groups.
+func regularGroups(
+	log *zap.Logger,
+	groups []keycloak.Group,
+	groupProjectsMap map[string][]int,
+) []keycloak.Group {
+	var regular []keycloak.Group
+	for _, group := range groups {
+		if isLagoonGroup(group, groupProjectsMap) && !isProjectGroup(log, group) {
+			regular = append(regular, group)
+		}
+	}
+	return regular
+}
+
+// lagoonGroups returns the Lagoon groups in the given slice of keycloak
+// groups, including project-default-groups.
+func lagoonGroups(
+	groups []keycloak.Group,
+	groupProjectsMap map[string][]int,
+) []keycloak.Group {
+	var lagoon []keycloak.Group
+	for _, group := range groups {
+		if isLagoonGroup(group, groupProjectsMap) {
+			lagoon = append(lagoon, group)
+		}
+	}
+	return lagoon
+}
+
+// applyGroupRoles replaces the role of each Lagoon group in roles with a role
+// named <group>-<group role> for each of the Lagoon group roles in
+// groupRoles. The roles of the given development-only groups and
+// development-only group roles only grant access to the logs of development
+// environments.
+//
+// The p<id> project roles are removed from roles, because they would
+// otherwise grant every member of a Lagoon group access to all the logs of
+// the projects of the group, regardless of group role. Project-default-groups
+// have group roles in the same way as regular Lagoon groups, so the members of
+// a project-default-group are granted access via its group role roles
+// instead.
+//
+// If groupRoles is empty, roles is not modified.
+func applyGroupRoles(
+	log *zap.Logger,
+	roles map[string]opensearch.Role,
+	groups []keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+	groupRoles map[string]GroupRolePermissions,
+	developmentOnlyGroups []string,
+	developmentOnlyGroupRoles []string,
+	developmentEnvironments map[int][]string,
+) {
+	if len(groupRoles) == 0 {
+		return
+	}
+	for pid := range projectNames {
+		delete(roles, fmt.Sprintf("p%d", pid))
+	}
+	lagoon := lagoonGroups(groups, groupProjectsMap)
+	for _, group := range lagoon {
+		delete(roles, group.Name)
+	}
+	for _, group := range lagoon {
+		for _, groupRole := range slices.Sorted(maps.Keys(groupRoles)) {
+			developmentOnly := slices.Contains(developmentOnlyGroups, group.Name) ||
+				slices.Contains(developmentOnlyGroupRoles, groupRole)
+			name := group.Name + "-" + groupRole
+			if _, ok := roles[name]; ok {
+				log.Warn("ignoring group role role with conflicting name",
+					zap.String("name", name))
+				continue
+			}
+			roles[name] = *generateGroupRoleRole(log, group, projectNames,
+				groupProjectsMap, groupRoles[groupRole], developmentOnly,
+				developmentEnvironments)
+		}
+	}
+}
+
+// applyGroupRolesMapping replaces the rolemapping of each Lagoon group, and
+// each p<id> project rolemapping, in rolesmapping with a rolemapping named
+// <group>-<group role> for each of the Lagoon group roles in groupRoles. Each
+// rolemapping maps the role from the backend role of the same name, which is
+// the name of the Keycloak subgroup used by Lagoon for group role membership.
+//
+// If groupRoles is empty, rolesmapping is not modified.
+func applyGroupRolesMapping(
+	log *zap.Logger,
+	rolesmapping map[string]opensearch.RoleMapping,
+	groups []keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+	groupRoles map[string]GroupRolePermissions,
+) {
+	if len(groupRoles) == 0 {
+		return
+	}
+	for pid := range projectNames {
+		delete(rolesmapping, fmt.Sprintf("p%d", pid))
+	}
+	lagoon := lagoonGroups(groups, groupProjectsMap)
+	for _, group := range lagoon {
+		delete(rolesmapping, group.Name)
+	}
+	for _, group := range lagoon {
+		for _, groupRole := range slices.Sorted(maps.Keys(groupRoles)) {
+			name := group.Name + "-" + groupRole
+			if _, ok := rolesmapping[name]; ok {
+				log.Warn("ignoring group role rolemapping with conflicting name",
+					zap.String("name", name))
+				continue
+			}
+			rolesmapping[name] = opensearch.RoleMapping{
+				RoleMappingPermissions: opensearch.RoleMappingPermissions{
+					BackendRoles:    []string{name},
+					AndBackendRoles: []string{},
+					Hosts:           []string{},
+					Users:           []string{},
+				},
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package sync_test
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+var (
+	testGroupRoleGroups = []keycloak.Group{
+		{
+			ID: "id-regular",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "regular",
+			},
+		},
+		{
+			ID: "id-project-foo",
+			GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+				Name: "project-foo",
+				Attributes: map[string][]string{
+					"type": {"project-default-group"},
+				},
+			},
+		},
+	}
+	testGroupRoleGroupProjectsMap = map[string][]int{
+		"id-regular":     {33},
+		"id-project-foo": {33},
+	}
+	testGroupRoles = map[string]sync.GroupRolePermissions{
+		"guest": {
+			Families: []string{"application-logs", "container-logs"},
+		},
+		"owner": {
+			Families: []string{
+				"application-logs",
+				"container-logs",
+				"lagoon-logs",
+				"router-logs",
+			},
+			Production:  true,
+			Reports:     true,
+			TenantWrite: true,
+		},
+	}
+)
+
+func TestGroupRolePermissionsValidate(t *testing.T) {
+	var testCases = map[string]struct {
+		input       sync.GroupRolePermissions
+		expectError bool
+	}{
+		"valid":          {input: testGroupRoles["owner"]},
+		"no families":    {input: sync.GroupRolePermissions{}},
+		"unknown family": {input: sync.GroupRolePermissions{Families: []string{"audit-logs"}}, expectError: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			err := tc.input.Validate()
+			if tc.expectError {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
+
+// groupRoleRole returns the role expected to be generated for a group role
+// with the given index patterns, cluster permissions, and tenant permission.
+func groupRoleRole(
+	indexPatterns, clusterPermissions []string,
+	tenantAction, tenant string,
+) opensearch.Role {
+	return opensearch.Role{
+		RolePermissions: opensearch.RolePermissions{
+			ClusterPermissions: clusterPermissions,
+			IndexPermissions: []opensearch.IndexPermission{
+				{
+					AllowedActions: []string{
+						"read",
+						"indices:monitor/settings/get",
+					},
+					IndexPatterns: indexPatterns,
+					MaskedFields:  []string{},
+				},
+			},
+			TenantPermissions: []opensearch.TenantPermission{
+				{
+					AllowedActions: []string{tenantAction},
+					TenantPatterns: []string{tenant},
+				},
+			},
+		},
+	}
+}
+
+func TestApplyGroupRoles(t *testing.T) {
+	developmentPatterns := []string{
+		"application-logs-foo-_-develop-_-*",
+		"container-logs-foo-_-develop-_-*",
+		"lagoon-logs-foo-_-develop-_-*",
+		"router-logs-foo-_-develop-_-*",
+	}
+	productionPatterns := []string{
+		"application-logs-foo-_-*",
+		"container-logs-foo-_-*",
+		"lagoon-logs-foo-_-*",
+		"router-logs-foo-_-*",
+	}
+	var testCases = map[string]struct {
+		developmentOnlyGroups      []string
+		developmentOnlyGroupRoles  []string
+		expectOwnerPatterns        []string
+		expectProjectOwnerPatterns []string
+	}{
+		"production access": {
+			expectOwnerPatterns:        productionPatterns,
+			expectProjectOwnerPatterns: productionPatterns,
+		},
+		"development only group": {
+			developmentOnlyGroups:      []string{"regular"},
+			expectOwnerPatterns:        developmentPatterns,
+			expectProjectOwnerPatterns: productionPatterns,
+		},
+		"development only group role": {
+			developmentOnlyGroupRoles:  []string{"owner"},
+			expectOwnerPatterns:        developmentPatterns,
+			expectProjectOwnerPatterns: developmentPatterns,
+		},
+	}
+	guestPatterns := []string{
+		"application-logs-foo-_-develop-_-*",
+		"container-logs-foo-_-develop-_-*",
+	}
+	reportsPermissions := []string{
+		"cluster:admin/opendistro/reports/instance/list",
+		"cluster:admin/opendistro/reports/instance/get",
+		"cluster:admin/opendistro/reports/menu/download",
+	}
+	projectNames := map[int]string{33: "foo"}
+	developmentEnvironments := map[int][]string{33: {"develop"}}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			roles := sync.GenerateRoles(log, testGroupRoleGroups, projectNames,
+				testGroupRoleGroupProjectsMap)
+			sync.ApplyGroupRoles(log, roles, testGroupRoleGroups, projectNames,
+				testGroupRoleGroupProjectsMap, testGroupRoles,
+				tc.developmentOnlyGroups, tc.developmentOnlyGroupRoles,
+				developmentEnvironments)
+			expect := map[string]opensearch.Role{
+				"regular-guest": groupRoleRole(guestPatterns, []string{},
+					"kibana_all_read", "regular"),
+				"regular-owner": groupRoleRole(tc.expectOwnerPatterns,
+					reportsPermissions, "kibana_all_write", "regular"),
+				"project-foo-guest": groupRoleRole(guestPatterns, []string{},
+					"kibana_all_read", "global_tenant"),
+				"project-foo-owner": groupRoleRole(tc.expectProjectOwnerPatterns,
+					reportsPermissions, "kibana_all_read", "global_tenant"),
+			}
+			assert.Equal(tt, expect, roles, name)
+		})
+	}
+}
+
+func TestApplyGroupRolesMapping(t *testing.T) {
+	var testCases = map[string]struct {
+		groupRoles map[string]sync.GroupRolePermissions
+		expect     []string
+	}{
+		"group roles disabled": {
+			expect: []string{"p33", "regular"},
+		},
+		"group roles enabled": {
+			groupRoles: testGroupRoles,
+			expect: []string{
+				"project-foo-guest",
+				"project-foo-owner",
+				"regular-guest",
+				"regular-owner",
+			},
+		},
+	}
+	projectNames := map[int]string{33: "foo"}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			rolesmapping := sync.GenerateRolesMapping(log, testGroupRoleGroups,
+				projectNames, testGroupRoleGroupProjectsMap)
+			sync.ApplyGroupRolesMapping(log, rolesmapping, testGroupRoleGroups,
+				projectNames, testGroupRoleGroupProjectsMap, tc.groupRoles)
+			expect := map[string]opensearch.RoleMapping{}
+			for _, name := range tc.expect {
+				expect[name] = opensearch.RoleMapping{
+					RoleMappingPermissions: opensearch.RoleMappingPermissions{
+						BackendRoles:    []string{name},
+						AndBackendRoles: []string{},
+						Hosts:           []string{},
+						Users:           []string{},
+					},
+				}
+			}
+			assert.Equal(tt, expect, rolesmapping, name)
+		})
+	}
+}
+
+func TestValidateDevelopmentOnlyGroupRoles(t *testing.T) {
+	var testCases = map[string]struct {
+		groupRoles                map[string]sync.GroupRolePermissions
+		developmentOnlyGroupRoles []string
+		expectError               bool
+	}{
+		"configured group role": {
+			groupRoles:                testGroupRoles,
+			developmentOnlyGroupRoles: []string{"guest"},
+		},
+		"unconfigured group role": {
+			groupRoles:                testGroupRoles,
+			developmentOnlyGroupRoles: []string{"developer"},
+			expectError:               true,
+		},
+		"lagoon group role": {
+			developmentOnlyGroupRoles: []string{"developer", "guest"},
+		},
+		"unknown group role": {
+			developmentOnlyGroupRoles: []string{"admin"},
+			expectError:               true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			err := sync.ValidateDevelopmentOnlyGroupRoles(tc.groupRoles,
+				tc.developmentOnlyGroupRoles)
+			if tc.expectError {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
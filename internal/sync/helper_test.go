@@ -3,15 +3,32 @@ package sync
 // this test helper facilitates unit testing of private functions.
 
 var (
-	CalculateIndexPatternDiff       = calculateIndexPatternDiff
-	CalculateRoleDiff               = calculateRoleDiff
-	FilterRoles                     = filterRoles
-	FilterRolesMapping              = filterRolesMapping
-	GenerateIndexPatterns           = generateIndexPatterns
-	GenerateIndexPatternsForGroup   = generateIndexPatternsForGroup
-	GenerateIndexPermissionPatterns = generateIndexPermissionPatterns
-	GenerateProjectRole             = generateProjectRole
-	GenerateRegularGroupRole        = generateRegularGroupRole
-	GenerateRoles                   = generateRoles
-	HashPrefix                      = hashPrefix
+	ApplyGroupRoles                   = applyGroupRoles
+	ApplyGroupRolesMapping            = applyGroupRolesMapping
+	CalculateIndexPatternDiff         = calculateIndexPatternDiff
+	CalculateRoleDiff                 = calculateRoleDiff
+	CompareGroupProjectsMaps          = compareGroupProjectsMaps
+	DevelopmentEnvironmentNames       = developmentEnvironmentNames
+	DiffWriterWrite                   = (*DiffWriter).write
+	FilterRoles                       = filterRoles
+	FilterRolesMapping                = filterRolesMapping
+	GenerateIndexPatterns             = generateIndexPatterns
+	GenerateIndexPatternsForGroup     = generateIndexPatternsForGroup
+	GenerateIndexPermissionPatterns   = generateIndexPermissionPatterns
+	GenerateOrganizationIndexPatterns = generateOrganizationIndexPatterns
+	GenerateOrganizationRoles         = generateOrganizationRoles
+	GenerateOrganizationRolesMapping  = generateOrganizationRolesMapping
+	GenerateOrganizationTenants       = generateOrganizationTenants
+	GenerateProjectRole               = generateProjectRole
+	GenerateRegularGroupRole          = generateRegularGroupRole
+	GenerateRoles                     = generateRoles
+	GenerateRolesMapping              = generateRolesMapping
+	HashPrefix                        = hashPrefix
+	OperationsTotal                   = operationsTotal
+	PatchBatchSize                    = patchBatchSize
+	CalculateISMPolicyDiff            = calculateISMPolicyDiff
+	GenerateISMPolicies               = generateISMPolicies
+	RestrictRolesMappingToDevelopment = restrictRolesMappingToDevelopment
+	RestrictRolesToDevelopment        = restrictRolesToDevelopment
+	SyncOrder                         = syncOrder
 )
@@ -3,11 +3,14 @@ package sync
 import (
 	"context"
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/hashcode"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
 	"go.uber.org/zap"
 )
 
@@ -38,6 +41,13 @@ var (
 	specialTenants = []string{"global_tenant", "admin_tenant"}
 )
 
+// indexPatternRepresentation is the representation of an index pattern used
+// in dry run diffs.
+type indexPatternRepresentation struct {
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title"`
+}
+
 // hashPrefix returns an Opensearch-index-name-sanitized copy of given a string
 // s, prefixed with a Java String hashcode.
 func hashPrefix(s string) string {
@@ -52,8 +62,9 @@ func hashPrefix(s string) string {
 }
 
 // calculateIndexPatternDiff returns a map of Opensearch Dashboards index
-// patterns which should be created, and a map of tenants to index pattern
-// names to index pattern IDs which should be deleted, for each tenant.
+// patterns which should be created (sorted for each tenant), and a map of
+// tenants to index pattern names to index pattern IDs which should be deleted,
+// for each tenant.
 // The idea is to use these values to reconcile existing with required.
 //
 // The to-delete map contains index patterns names _and_ index pattern IDs
@@ -83,6 +94,7 @@ func calculateIndexPatternDiff(log *zap.Logger,
 				toCreate[tenant] = append(toCreate[tenant], pattern)
 			}
 		}
+		slices.Sort(toCreate[tenant])
 	}
 	// calculate index patterns to delete
 	toDelete := map[string]map[string][]string{}
@@ -121,19 +133,19 @@ func calculateIndexPatternDiff(log *zap.Logger,
 	return toCreate, toDelete
 }
 
-// generateIndexPatternsForGroup returns a slice of index patterns for all the
-// projects associated with the given group.
-func generateIndexPatternsForGroup(
+// generateIndexPatternsForProjects returns a slice of index patterns for the
+// given projects, followed by the global index patterns.
+func generateIndexPatternsForProjects(
 	log *zap.Logger,
-	group keycloak.Group,
+	pids []int,
 	projectNames map[int]string,
-	groupProjectsMap map[string][]int,
 	legacyDelimiter bool,
-) ([]string, error) {
-	pids, ok := groupProjectsMap[group.ID]
-	if !ok {
-		return nil, fmt.Errorf("missing project group ID %s in groupProjectsMap",
-			group.ID)
+) []string {
+	var indexPatternTemplates []string
+	if legacyDelimiter {
+		indexPatternTemplates = legacyIndexPatternTemplates
+	} else {
+		indexPatternTemplates = defaultIndexPatternTemplates
 	}
 	var indexPatterns []string
 	for _, pid := range pids {
@@ -149,18 +161,29 @@ func generateIndexPatternsForGroup(
 				zap.Int("projectID", pid))
 			continue
 		}
-		var indexPatternTemplates []string
-		if legacyDelimiter {
-			indexPatternTemplates = legacyIndexPatternTemplates
-		} else {
-			indexPatternTemplates = defaultIndexPatternTemplates
-		}
 		for _, tpl := range indexPatternTemplates {
 			indexPatterns = append(indexPatterns, fmt.Sprintf(tpl, name))
 		}
 	}
-	indexPatterns = append(indexPatterns, globalIndexPatterns...)
-	return indexPatterns, nil
+	return append(indexPatterns, globalIndexPatterns...)
+}
+
+// generateIndexPatternsForGroup returns a slice of index patterns for all the
+// projects associated with the given group.
+func generateIndexPatternsForGroup(
+	log *zap.Logger,
+	group keycloak.Group,
+	projectNames map[int]string,
+	groupProjectsMap map[string][]int,
+	legacyDelimiter bool,
+) ([]string, error) {
+	pids, ok := groupProjectsMap[group.ID]
+	if !ok {
+		return nil, fmt.Errorf("missing project group ID %s in groupProjectsMap",
+			group.ID)
+	}
+	return generateIndexPatternsForProjects(log, pids, projectNames,
+		legacyDelimiter), nil
 }
 
 // generateIndexPatterns returns a map of index patterns required by Lagoon
@@ -214,10 +237,13 @@ func syncIndexPatterns(
 	groups []keycloak.Group,
 	projectNames map[int]string,
 	groupProjectsMap map[string][]int,
+	organizations []lagoondb.Organization,
+	organizationProjectsMap map[int][]int,
 	o OpensearchService,
 	d DashboardsService,
 	dryRun,
 	legacyDelimiter bool,
+	diff *DiffWriter,
 ) {
 	// get index patterns from Opensearch
 	existing, err := o.IndexPatterns(ctx)
@@ -228,14 +254,20 @@ func syncIndexPatterns(
 	// generate the index patterns required by Lagoon
 	required := generateIndexPatterns(log, groups, projectNames,
 		groupProjectsMap, legacyDelimiter)
+	mergeRequired(log, "index patterns", required,
+		generateOrganizationIndexPatterns(log, organizations, projectNames,
+			organizationProjectsMap, legacyDelimiter))
 	// calculate index templates to add/remove
 	toCreate, toDelete := calculateIndexPatternDiff(log, existing, required)
-	for tenant, patternIDMap := range toDelete {
-		for pattern, patternIDs := range patternIDMap {
-			for _, patternID := range patternIDs {
+	for _, tenant := range slices.Sorted(maps.Keys(toDelete)) {
+		patternIDMap := toDelete[tenant]
+		for _, pattern := range slices.Sorted(maps.Keys(patternIDMap)) {
+			for _, patternID := range patternIDMap[pattern] {
 				if dryRun {
 					log.Info("dry run mode: not deleting index pattern",
 						zap.String("tenant", tenant), zap.String("patternID", patternID))
+					diff.write(log, "indexpattern", tenant, patternID,
+						indexPatternRepresentation{ID: patternID, Title: pattern}, nil)
 					continue
 				}
 				err = d.DeleteIndexPattern(ctx, tenant, patternID)
@@ -250,11 +282,13 @@ func syncIndexPatterns(
 			}
 		}
 	}
-	for tenant, patterns := range toCreate {
-		for _, pattern := range patterns {
+	for _, tenant := range slices.Sorted(maps.Keys(toCreate)) {
+		for _, pattern := range toCreate[tenant] {
 			if dryRun {
 				log.Info("dry run mode: not creating index pattern",
 					zap.String("tenant", tenant), zap.String("pattern", pattern))
+				diff.write(log, "indexpattern", tenant, pattern, nil,
+					indexPatternRepresentation{Title: pattern})
 				continue
 			}
 			err = d.CreateIndexPattern(ctx, tenant, pattern)
@@ -2,7 +2,6 @@ package sync_test
 
 import (
 	"reflect"
-	"sort"
 	"testing"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
@@ -355,12 +354,6 @@ func TestCalculateIndexPatternDiff(t *testing.T) {
 		t.Run(name, func(tt *testing.T) {
 			toCreate, toDelete := sync.CalculateIndexPatternDiff(
 				log, tc.input.existing, tc.input.required)
-			// Sort slices for accurate comparison. In the case of this test slice
-			// order is not important - just that they contain the same set of
-			// strings.
-			for k := range toCreate {
-				sort.Strings(toCreate[k])
-			}
 			if !reflect.DeepEqual(toCreate, tc.expect.toCreate) {
 				tt.Fatalf("got:\n%v\nexpected:\n%v\n", toCreate,
 					tc.expect.toCreate)
@@ -2,18 +2,23 @@ package sync
 
 import (
 	"context"
+	"maps"
+	"slices"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
 	"go.uber.org/zap"
 )
 
 // calculateIndexTemplateDiff returns a map of opensearch index templates which
-// should be created, and a slice of index template names which should be
-// deleted, in order to reconcile existing with required.
+// should be created, and a sorted slice of index template names which should
+// be deleted, in order to reconcile existing with required.
 //
-// This logic will only replace "lagoon-owned" index templates. It will not
-// touch index templates it does not know about. Currently "lagoon-owned" index
-// templates are only "routerlogs".
+// This logic will only replace or delete "lagoon-owned" index templates. It
+// will not touch index templates it does not know about. "lagoon-owned" index
+// templates are the required templates, and any existing templates with the
+// ownership marker in their _meta field. Owned templates which are no longer
+// required, such as those loaded from a file which has since been removed, are
+// deleted.
 func calculateIndexTemplateDiff(existing,
 	required map[string]opensearch.IndexTemplate) (
 	map[string]opensearch.IndexTemplate, []string) {
@@ -31,7 +36,12 @@ func calculateIndexTemplateDiff(existing,
 		// check if this index template is required by lagoon
 		rIndexTemplate, ok := required[name]
 		if !ok {
-			continue // this is an unrecognized index template: don't touch it
+			if isOwned(eIndexTemplate.IndexTemplateDefinition.Meta) {
+				// this index template is owned by lagoon but no longer required
+				toDelete = append(toDelete, name)
+			}
+			// otherwise this is an unrecognized index template: don't touch it
+			continue
 		}
 		if !indexTemplatesEqual(rIndexTemplate, eIndexTemplate) {
 			// this index template is owned by lagoon but the contents are not equal
@@ -39,52 +49,181 @@ func calculateIndexTemplateDiff(existing,
 			toDelete = append(toDelete, name)
 		}
 	}
+	slices.Sort(toDelete)
 	return toCreate, toDelete
 }
 
-// generateIndexTemplates returns a map of index templates required by Lagoon
-// logging.
-func generateIndexTemplates() map[string]opensearch.IndexTemplate {
-	return map[string]opensearch.IndexTemplate{
-		"routerlogs": {
-			Name: "routerlogs",
-			IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
-				IndexPatterns: []string{"router-logs-*"},
-				Template: opensearch.Template{
-					Mappings: &opensearch.Mappings{
-						DynamicTemplates: []map[string]opensearch.DynamicTemplate{
-							{
-								"remote_addr": {
-									MatchMappingType: "string",
-									Match:            "remote_addr",
-									Mapping: opensearch.Mapping{
-										Type:            "ip",
-										IgnoreMalformed: true,
-									},
-								},
-							},
-							{
-								"true-client-ip": {
-									MatchMappingType: "string",
-									Match:            "true-client-ip",
-									Mapping: opensearch.Mapping{
-										Type:            "ip",
-										IgnoreMalformed: true,
-									},
-								},
-							},
-						},
-					},
+// logIndexTotalFieldsLimit is the maximum number of fields in each Lagoon log
+// index. This is higher than the Opensearch default because Lagoon logs from
+// many different applications share the same index, but still stops a
+// misbehaving application from exploding the mapping.
+const logIndexTotalFieldsLimit = 2000
+
+// BuiltinIndexTemplates configures which of the built-in index templates are
+// synchronised, and their priority. Opensearch applies only the highest
+// priority index template which matches a new index, and refuses to create an
+// index template with overlapping index patterns and the same priority as
+// another. So an explicit priority allows other templates to override or
+// defer to the built-in templates.
+type BuiltinIndexTemplates struct {
+	// Names are the names of the built-in index templates which are
+	// synchronised. A Lagoon-owned built-in index template which is not named
+	// is deleted.
+	Names []string
+	// Priority is the priority of every built-in index template.
+	Priority int
+}
+
+// stringField returns the mapping of a string field. This is the same mapping
+// that Opensearch would apply dynamically to a string, so that existing
+// queries and visualisations on the field and its keyword subfield continue to
+// work, but stops the field being mapped as a different type if it first
+// appears with a non-string value.
+func stringField() map[string]any {
+	return map[string]any{
+		"type": "text",
+		"fields": map[string]any{
+			"keyword": map[string]any{
+				"type":         "keyword",
+				"ignore_above": 256,
+			},
+		},
+	}
+}
+
+// ipDynamicTemplate returns a dynamic template which maps the named string
+// field as an IP address.
+func ipDynamicTemplate(field string) map[string]opensearch.DynamicTemplate {
+	return map[string]opensearch.DynamicTemplate{
+		field: {
+			MatchMappingType: "string",
+			Match:            field,
+			Mapping: map[string]any{
+				"type":             "ip",
+				"ignore_malformed": true,
+			},
+		},
+	}
+}
+
+// logIndexTemplate returns an index template with the given priority for a
+// family of Lagoon log indices. Every family has a date timestamp field, a limit on the number of
+// fields, and ignores malformed values instead of rejecting the document when
+// a field has a conflicting type. The given properties are mapped in addition
+// to the timestamp, and are not modified.
+func logIndexTemplate(name, indexPattern string, priority int,
+	composedOf []string, properties map[string]any,
+	dynamicTemplates []map[string]opensearch.DynamicTemplate,
+) opensearch.IndexTemplate {
+	mapped := map[string]any{}
+	maps.Copy(mapped, properties)
+	mapped["@timestamp"] = map[string]any{"type": "date"}
+	return opensearch.IndexTemplate{
+		Name: name,
+		IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
+			ComposedOf:    composedOf,
+			IndexPatterns: []string{indexPattern},
+			Priority:      &priority,
+			Template: opensearch.Template{
+				Settings: map[string]any{
+					"index.mapping.total_fields.limit": logIndexTotalFieldsLimit,
+					"index.mapping.ignore_malformed":   true,
+				},
+				Mappings: &opensearch.Mappings{
+					DynamicTemplates: dynamicTemplates,
+					Properties:       mapped,
 				},
 			},
 		},
 	}
 }
 
+// withDefaultPipeline returns the given index template with the given ingest
+// pipeline set as the default pipeline of new indices.
+func withDefaultPipeline(it opensearch.IndexTemplate,
+	pipeline string) opensearch.IndexTemplate {
+	it.IndexTemplateDefinition.Template.Settings["index.default_pipeline"] = pipeline
+	return it
+}
+
+// allIndexTemplates returns a map of all the built-in index templates for
+// Lagoon logging, with the given priority. If componentTemplates is true, the
+// index templates are composed of the built-in component templates. Otherwise
+// the component templates may not exist, and Opensearch would refuse to
+// create index templates which refer to them. Similarly, the index templates
+// only use a built-in ingest pipeline as their default pipeline if its ID is
+// in the readyPipelines set. Otherwise the ingest pipeline may not exist, and
+// Opensearch would reject every log written to the indices.
+func allIndexTemplates(priority int, componentTemplates bool,
+	readyPipelines map[string]bool) map[string]opensearch.IndexTemplate {
+	var composedOf []string
+	if componentTemplates {
+		composedOf = []string{kubernetesComponentTemplate}
+	}
+	routerLogs := logIndexTemplate("routerlogs",
+		"router-logs-*", priority, composedOf, nil,
+		[]map[string]opensearch.DynamicTemplate{
+			ipDynamicTemplate("remote_addr"),
+			ipDynamicTemplate("true-client-ip"),
+		})
+	if readyPipelines[routerLogsIngestPipeline] {
+		routerLogs = withDefaultPipeline(routerLogs, routerLogsIngestPipeline)
+	}
+	return map[string]opensearch.IndexTemplate{
+		"applicationlogs": logIndexTemplate("applicationlogs",
+			"application-logs-*", priority, composedOf, map[string]any{
+				"channel":  stringField(),
+				"level":    stringField(),
+				"severity": stringField(),
+			}, nil),
+		"containerlogs": logIndexTemplate("containerlogs",
+			"container-logs-*", priority, composedOf, map[string]any{
+				"level":  stringField(),
+				"stream": stringField(),
+			}, nil),
+		"lagoonlogs": logIndexTemplate("lagoonlogs",
+			"lagoon-logs-*", priority, composedOf, map[string]any{
+				"event":    stringField(),
+				"level":    stringField(),
+				"severity": stringField(),
+			}, nil),
+		"routerlogs": routerLogs,
+	}
+}
+
+// generateIndexTemplates returns a map of the built-in index templates
+// required by Lagoon logging, as configured by builtins. See
+// allIndexTemplates for componentTemplates and readyPipelines.
+func generateIndexTemplates(builtins BuiltinIndexTemplates,
+	componentTemplates bool,
+	readyPipelines map[string]bool) map[string]opensearch.IndexTemplate {
+	required := allIndexTemplates(builtins.Priority, componentTemplates,
+		readyPipelines)
+	maps.DeleteFunc(required, func(name string, _ opensearch.IndexTemplate) bool {
+		return !slices.Contains(builtins.Names, name)
+	})
+	return required
+}
+
+// IsBuiltinIndexTemplate returns true if the named index template is one of
+// the index templates built in to the sync, whether or not it is enabled.
+func IsBuiltinIndexTemplate(name string) bool {
+	_, ok := allIndexTemplates(0, false, nil)[name]
+	return ok
+}
+
 // syncIndexTemplates reconciles Opensearch index templates with Lagoon logging
-// requirements.
+// requirements. The built-in index templates are configured by builtins, the
+// extra index templates are required in addition to the built-in index
+// templates, and all required index templates are marked as owned by the
+// sync. componentTemplates should be true if the built-in
+// component templates are synchronised, and readyPipelines is the set of IDs
+// of the ingest pipelines which are ready to be used as a default pipeline.
 func syncIndexTemplates(ctx context.Context, log *zap.Logger,
-	o OpensearchService, dryRun bool) {
+	builtins BuiltinIndexTemplates,
+	extra map[string]opensearch.IndexTemplate, componentTemplates bool,
+	readyPipelines map[string]bool, o OpensearchService, dryRun bool,
+	diff *DiffWriter) {
 	// get index templates from Opensearch
 	existing, err := o.IndexTemplates(ctx)
 	if err != nil {
@@ -92,13 +231,33 @@ func syncIndexTemplates(ctx context.Context, log *zap.Logger,
 		return
 	}
 	// generate the index templates required by Lagoon
-	required := generateIndexTemplates()
+	required := generateIndexTemplates(builtins, componentTemplates,
+		readyPipelines)
+	for name, it := range extra {
+		if IsBuiltinIndexTemplate(name) {
+			log.Warn("ignoring index template with built-in name",
+				zap.String("name", name))
+			continue
+		}
+		required[name] = it
+	}
+	for name, it := range required {
+		it.IndexTemplateDefinition.Meta =
+			withOwnerMeta(it.IndexTemplateDefinition.Meta)
+		required[name] = it
+	}
 	// calculate index templates to add/remove
 	toCreate, toDelete := calculateIndexTemplateDiff(existing, required)
 	for _, name := range toDelete {
 		if dryRun {
 			log.Info("dry run mode: not deleting index template",
 				zap.String("name", name))
+			// a template which is deleted and recreated is an update: its diff is
+			// written when it is created
+			if _, ok := toCreate[name]; !ok {
+				diff.write(log, "indextemplate", "", name,
+					existing[name].IndexTemplateDefinition, nil)
+			}
 			continue
 		}
 		err = o.DeleteIndexTemplate(ctx, name)
@@ -108,15 +267,23 @@ func syncIndexTemplates(ctx context.Context, log *zap.Logger,
 		}
 		log.Info("deleted index template", zap.String("name", name))
 	}
-	for name, it := range toCreate {
+	for _, name := range slices.Sorted(maps.Keys(toCreate)) {
+		it := toCreate[name]
 		if dryRun {
 			log.Info("dry run mode: not creating index template",
 				zap.String("name", name))
+			var eIndexTemplate any
+			if e, ok := existing[name]; ok {
+				eIndexTemplate = e.IndexTemplateDefinition
+			}
+			diff.write(log, "indextemplate", "", name, eIndexTemplate,
+				it.IndexTemplateDefinition)
 			continue
 		}
 		err = o.CreateIndexTemplate(ctx, name, &it)
 		if err != nil {
 			log.Warn("couldn't create index template", zap.Error(err))
+			continue
 		}
 		log.Info("created index template", zap.String("name", name))
 	}
@@ -1,7 +1,10 @@
 package sync
 
 import (
+	"encoding/json"
+	"maps"
 	"reflect"
+	"slices"
 	"testing"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
@@ -77,6 +80,34 @@ func TestCalculateIndexTemplateDiff(t *testing.T) {
 				toDelete: nil,
 			},
 		},
+		"delete owned index template": {
+			input: input{
+				existing: map[string]opensearch.IndexTemplate{
+					"routerlogs": {Name: "routerlogs"},
+					"custom-logs": {
+						Name: "custom-logs",
+						IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
+							Meta: withOwnerMeta(nil),
+						},
+					},
+					"other-logs": {
+						Name: "other-logs",
+						IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
+							Meta: map[string]any{ownerMetaKey: "someone-else"},
+						},
+					},
+				},
+				required: map[string]opensearch.IndexTemplate{
+					"routerlogs": {Name: "routerlogs"},
+				},
+			},
+			expect: output{
+				toCreate: map[string]opensearch.IndexTemplate{},
+				toDelete: []string{
+					"custom-logs",
+				},
+			},
+		},
 		"replace unequal index temlate": {
 			input: input{
 				existing: map[string]opensearch.IndexTemplate{
@@ -129,3 +160,105 @@ func TestCalculateIndexTemplateDiff(t *testing.T) {
 		})
 	}
 }
+
+func TestGeneratedIndexTemplatesStable(t *testing.T) {
+	// the settings as Opensearch returns them
+	returnedSettings := map[string]any{
+		"index": map[string]any{
+			"mapping": map[string]any{
+				"total_fields":     map[string]any{"limit": "2000"},
+				"ignore_malformed": "true",
+			},
+		},
+	}
+	for name, required := range allIndexTemplates(50, true, nil) {
+		t.Run(name, func(tt *testing.T) {
+			data, err := json.Marshal(required)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			var existing opensearch.IndexTemplate
+			if err = json.Unmarshal(data, &existing); err != nil {
+				tt.Fatal(err)
+			}
+			existing.IndexTemplateDefinition.Template.Settings = returnedSettings
+			if !indexTemplatesEqual(existing, required) {
+				tt.Fatalf("round-tripped index template not equal:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestWithOwnerMeta(t *testing.T) {
+	meta := map[string]any{"description": "custom logs"}
+	owned := withOwnerMeta(meta)
+	if !isOwned(owned) {
+		t.Fatalf("marked _meta not owned: %v", owned)
+	}
+	if isOwned(meta) {
+		t.Fatalf("given _meta modified: %v", meta)
+	}
+	if owned["description"] != "custom logs" {
+		t.Fatalf("given _meta not preserved: %v", owned)
+	}
+}
+
+func TestLogIndexTemplate(t *testing.T) {
+	properties := map[string]any{"level": stringField()}
+	it := logIndexTemplate("lagoonlogs", "lagoon-logs-*", 75, nil, properties,
+		nil)
+	if len(properties) != 1 {
+		t.Fatalf("given properties modified: %v", properties)
+	}
+	mapped := it.IndexTemplateDefinition.Template.Mappings.Properties
+	if _, ok := mapped["@timestamp"]; !ok {
+		t.Fatalf("@timestamp not mapped: %v", mapped)
+	}
+	if _, ok := mapped["level"]; !ok {
+		t.Fatalf("level not mapped: %v", mapped)
+	}
+	priority := it.IndexTemplateDefinition.Priority
+	if priority == nil || *priority != 75 {
+		t.Fatalf("unexpected priority: %v", priority)
+	}
+}
+
+func TestGenerateIndexTemplatesBuiltins(t *testing.T) {
+	var testCases = map[string]struct {
+		builtins BuiltinIndexTemplates
+		expect   []string
+	}{
+		"router logs only": {
+			builtins: BuiltinIndexTemplates{Names: []string{"routerlogs"}},
+			expect:   []string{"routerlogs"},
+		},
+		"all families": {
+			builtins: BuiltinIndexTemplates{
+				Names: []string{"applicationlogs", "containerlogs", "lagoonlogs",
+					"routerlogs"},
+				Priority: 10,
+			},
+			expect: []string{"applicationlogs", "containerlogs", "lagoonlogs",
+				"routerlogs"},
+		},
+		"none": {},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			required := generateIndexTemplates(tc.builtins, false, nil)
+			names := slices.Sorted(maps.Keys(required))
+			if !reflect.DeepEqual(names, tc.expect) {
+				tt.Fatalf("got %v, expected %v", names, tc.expect)
+			}
+			for itName, it := range required {
+				priority := it.IndexTemplateDefinition.Priority
+				if priority == nil || *priority != tc.builtins.Priority {
+					tt.Fatalf("%s: unexpected priority: %v", itName, priority)
+				}
+				if !IsBuiltinIndexTemplate(itName) {
+					tt.Fatalf("%s: not a built-in index template", itName)
+				}
+			}
+		})
+	}
+}
@@ -1,19 +1,148 @@
 package sync
 
-import "github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
 
-func mappingEqual(a, b opensearch.Mapping) bool {
-	return a.Type == b.Type && a.IgnoreMalformed == b.IgnoreMalformed
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+// defaultTimestampField is the data stream timestamp field used by Opensearch
+// if none is given.
+const defaultTimestampField = "@timestamp"
+
+// normalizeJSON round-trips the given value through JSON and returns a
+// canonical representation for comparison: scalars are converted to strings,
+// because Opensearch may return numbers and booleans as strings, and empty
+// objects and arrays are converted to nil.
+func normalizeJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%#v", v) // unreachable for decoded JSON values
+	}
+	var n any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&n); err != nil {
+		return string(data)
+	}
+	return canonicalJSON(n)
+}
+
+// canonicalJSON implements normalizeJSON on a decoded JSON value.
+func canonicalJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			return nil
+		}
+		c := map[string]any{}
+		for k, value := range v {
+			c[k] = canonicalJSON(value)
+		}
+		return c
+	case []any:
+		if len(v) == 0 {
+			return nil
+		}
+		c := make([]any, len(v))
+		for i, value := range v {
+			c[i] = canonicalJSON(value)
+		}
+		return c
+	case nil:
+		return nil
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonEqual returns true if the JSON representations of a and b are equal
+// after normalisation by normalizeJSON.
+func jsonEqual(a, b any) bool {
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+// flattenSettings adds the given index settings to flat, with dotted keys and
+// string values.
+func flattenSettings(flat map[string]string, prefix string, settings any) {
+	switch s := settings.(type) {
+	case map[string]any:
+		for k, v := range s {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenSettings(flat, key, v)
+		}
+	case nil:
+		// unset
+	default:
+		flat[prefix] = fmt.Sprint(normalizeJSON(s))
+	}
+}
+
+// normalizeSettings returns the given index settings as a flat map of dotted
+// keys to string values, with the "index." prefix added to each key which
+// doesn't have it. This is the form in which Opensearch returns settings.
+func normalizeSettings(settings map[string]any) map[string]string {
+	flat := map[string]string{}
+	flattenSettings(flat, "", settings)
+	normalized := map[string]string{}
+	for k, v := range flat {
+		if !strings.HasPrefix(k, "index.") {
+			k = "index." + k
+		}
+		normalized[k] = v
+	}
+	return normalized
+}
+
+// boolPtrEqual compares two optional booleans, where nil is equal to the
+// given default.
+func boolPtrEqual(a, b *bool, def bool) bool {
+	aValue, bValue := def, def
+	if a != nil {
+		aValue = *a
+	}
+	if b != nil {
+		bValue = *b
+	}
+	return aValue == bValue
+}
+
+// intPtrEqual compares two optional integers. If def is not nil, nil is equal
+// to the default.
+func intPtrEqual(a, b, def *int) bool {
+	if a == nil {
+		a = def
+	}
+	if b == nil {
+		b = def
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 func dynamicTemplateEqual(a, b opensearch.DynamicTemplate) bool {
+	if a.MatchMappingType != b.MatchMappingType {
+		return false
+	}
 	if a.MatchPattern != b.MatchPattern {
 		return false
 	}
-	if a.Match != b.Match {
+	if a.Match != b.Match || a.Unmatch != b.Unmatch {
+		return false
+	}
+	if a.PathMatch != b.PathMatch || a.PathUnmatch != b.PathUnmatch {
 		return false
 	}
-	return mappingEqual(a.Mapping, b.Mapping)
+	return jsonEqual(a.Mapping, b.Mapping)
 }
 
 func dynamicTemplateMapEqual(a, b map[string]opensearch.DynamicTemplate) bool {
@@ -51,33 +180,106 @@ func dynamicTemplatesEqual(a, b []map[string]opensearch.DynamicTemplate) bool {
 }
 
 func mappingsEqual(a, b *opensearch.Mappings) bool {
-	// check the top level Mapping object
-	if a == nil && b == nil {
-		return true
+	// an unset mapping is equal to an empty mapping
+	if a == nil {
+		a = &opensearch.Mappings{}
 	}
-	if (a == nil && b != nil) || (a != nil && b == nil) {
+	if b == nil {
+		b = &opensearch.Mappings{}
+	}
+	if !dynamicTemplatesEqual(a.DynamicTemplates, b.DynamicTemplates) {
+		return false
+	}
+	// dynamic defaults to true, and may be returned as a string
+	aDynamic, bDynamic := a.Dynamic, b.Dynamic
+	if aDynamic == nil {
+		aDynamic = true
+	}
+	if bDynamic == nil {
+		bDynamic = true
+	}
+	if !jsonEqual(aDynamic, bDynamic) {
+		return false
+	}
+	if !boolPtrEqual(a.DateDetection, b.DateDetection, true) ||
+		!boolPtrEqual(a.NumericDetection, b.NumericDetection, false) {
+		return false
+	}
+	if !stringSliceEqual(a.DynamicDateFormats, b.DynamicDateFormats) {
 		return false
 	}
-	return dynamicTemplatesEqual(a.DynamicTemplates, b.DynamicTemplates)
+	return jsonEqual(a.Properties, b.Properties) &&
+		jsonEqual(a.Source, b.Source) &&
+		jsonEqual(a.Routing, b.Routing) &&
+		jsonEqual(a.Meta, b.Meta)
 }
 
-// indexTemplatesEqual checks the fields Lagoon cares about for functional
-// equality
+func templateEqual(a, b opensearch.Template) bool {
+	if !reflect.DeepEqual(normalizeSettings(a.Settings),
+		normalizeSettings(b.Settings)) {
+		return false
+	}
+	if !mappingsEqual(a.Mappings, b.Mappings) {
+		return false
+	}
+	return jsonEqual(a.Aliases, b.Aliases)
+}
+
+// timestampField returns the name of the timestamp field of the given data
+// stream configuration, or the empty string if it is not a data stream.
+func timestampField(d *opensearch.DataStream) string {
+	if d == nil {
+		return ""
+	}
+	if d.TimestampField == nil || d.TimestampField.Name == "" {
+		return defaultTimestampField
+	}
+	return d.TimestampField.Name
+}
+
+// indexTemplatesEqual checks the index templates for semantic equality.
+// Fields which are unset are equal to the default values which Opensearch
+// applies, and settings and other unmodelled JSON values are compared in the
+// normalised form in which Opensearch returns them.
 func indexTemplatesEqual(a, b opensearch.IndexTemplate) bool {
 	if a.Name != b.Name {
 		return false
 	}
-	if !stringSliceEqual(a.IndexTemplateDefinition.ComposedOf,
-		b.IndexTemplateDefinition.ComposedOf) {
+	aDef, bDef := a.IndexTemplateDefinition, b.IndexTemplateDefinition
+	if !stringSliceEqual(aDef.ComposedOf, bDef.ComposedOf) {
 		return false
 	}
-	if !stringSliceEqual(a.IndexTemplateDefinition.IndexPatterns,
-		b.IndexTemplateDefinition.IndexPatterns) {
+	if !stringSliceEqual(aDef.IndexPatterns, bDef.IndexPatterns) {
 		return false
 	}
-	if !mappingsEqual(a.IndexTemplateDefinition.Template.Mappings,
-		b.IndexTemplateDefinition.Template.Mappings) {
+	defaultPriority := 0
+	if !intPtrEqual(aDef.Priority, bDef.Priority, &defaultPriority) {
 		return false
 	}
-	return true
+	if !intPtrEqual(aDef.Version, bDef.Version, nil) {
+		return false
+	}
+	if !jsonEqual(aDef.Meta, bDef.Meta) {
+		return false
+	}
+	if timestampField(aDef.DataStream) != timestampField(bDef.DataStream) {
+		return false
+	}
+	return templateEqual(aDef.Template, bDef.Template)
+}
+
+// componentTemplatesEqual checks the component templates for semantic
+// equality in the same way as indexTemplatesEqual.
+func componentTemplatesEqual(a, b opensearch.ComponentTemplate) bool {
+	if a.Name != b.Name {
+		return false
+	}
+	aDef, bDef := a.ComponentTemplateDefinition, b.ComponentTemplateDefinition
+	if !intPtrEqual(aDef.Version, bDef.Version, nil) {
+		return false
+	}
+	if !jsonEqual(aDef.Meta, bDef.Meta) {
+		return false
+	}
+	return templateEqual(aDef.Template, bDef.Template)
 }
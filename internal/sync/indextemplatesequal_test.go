@@ -0,0 +1,225 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func intPtr(i int) *int { return &i }
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestIndexTemplatesEqual(t *testing.T) {
+	var testCases = map[string]struct {
+		a      opensearch.IndexTemplateDefinition
+		b      opensearch.IndexTemplateDefinition
+		expect bool
+	}{
+		"empty": {
+			expect: true,
+		},
+		"nested and dotted settings": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Settings: map[string]any{
+						"number_of_replicas": 1,
+						"refresh_interval":   "30s",
+					},
+				},
+			},
+			b: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Settings: map[string]any{
+						"index": map[string]any{
+							"number_of_replicas": "1",
+							"refresh_interval":   "30s",
+						},
+					},
+				},
+			},
+			expect: true,
+		},
+		"different replicas": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Settings: map[string]any{"index.number_of_replicas": 1},
+				},
+			},
+			b: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Settings: map[string]any{
+						"index": map[string]any{"number_of_replicas": "2"},
+					},
+				},
+			},
+			expect: false,
+		},
+		"missing setting": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Settings: map[string]any{"index.number_of_replicas": 1},
+				},
+			},
+			expect: false,
+		},
+		"default priority": {
+			a:      opensearch.IndexTemplateDefinition{Priority: intPtr(0)},
+			expect: true,
+		},
+		"different priority": {
+			a:      opensearch.IndexTemplateDefinition{Priority: intPtr(100)},
+			expect: false,
+		},
+		"missing version": {
+			a:      opensearch.IndexTemplateDefinition{Version: intPtr(1)},
+			expect: false,
+		},
+		"empty composed_of": {
+			a:      opensearch.IndexTemplateDefinition{ComposedOf: []string{}},
+			expect: true,
+		},
+		"default data stream timestamp field": {
+			a: opensearch.IndexTemplateDefinition{
+				DataStream: &opensearch.DataStream{},
+			},
+			b: opensearch.IndexTemplateDefinition{
+				DataStream: &opensearch.DataStream{
+					TimestampField: &opensearch.TimestampField{Name: "@timestamp"},
+				},
+			},
+			expect: true,
+		},
+		"data stream and index": {
+			a: opensearch.IndexTemplateDefinition{
+				DataStream: &opensearch.DataStream{},
+			},
+			expect: false,
+		},
+		"meta numbers": {
+			a: opensearch.IndexTemplateDefinition{
+				Meta: map[string]any{"owner": "lagoon", "revision": 2},
+			},
+			b: opensearch.IndexTemplateDefinition{
+				Meta: map[string]any{"owner": "lagoon", "revision": 2.0},
+			},
+			expect: true,
+		},
+		"mapping defaults": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Mappings: &opensearch.Mappings{
+						Dynamic:          true,
+						DateDetection:    boolPtr(true),
+						NumericDetection: boolPtr(false),
+						DynamicTemplates: []map[string]opensearch.DynamicTemplate{{
+							"remote_addr": {
+								Match: "remote_addr",
+								Mapping: map[string]any{
+									"type":             "ip",
+									"ignore_malformed": true,
+								},
+							},
+						}},
+					},
+				},
+			},
+			b: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Mappings: &opensearch.Mappings{
+						Dynamic: "true",
+						DynamicTemplates: []map[string]opensearch.DynamicTemplate{{
+							"remote_addr": {
+								Match: "remote_addr",
+								Mapping: map[string]any{
+									"type":             "ip",
+									"ignore_malformed": "true",
+								},
+							},
+						}},
+					},
+				},
+			},
+			expect: true,
+		},
+		"different dynamic template mapping": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Mappings: &opensearch.Mappings{
+						DynamicTemplates: []map[string]opensearch.DynamicTemplate{{
+							"strings": {
+								MatchMappingType: "string",
+								Mapping: map[string]any{
+									"type":       "keyword",
+									"null_value": "NULL",
+								},
+							},
+						}},
+					},
+				},
+			},
+			b: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Mappings: &opensearch.Mappings{
+						DynamicTemplates: []map[string]opensearch.DynamicTemplate{{
+							"strings": {
+								MatchMappingType: "string",
+								Mapping:          map[string]any{"type": "keyword"},
+							},
+						}},
+					},
+				},
+			},
+			expect: false,
+		},
+		"different properties": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Mappings: &opensearch.Mappings{
+						Properties: map[string]any{
+							"status": map[string]any{"type": "integer"},
+						},
+					},
+				},
+			},
+			b: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Mappings: &opensearch.Mappings{
+						Properties: map[string]any{
+							"status": map[string]any{"type": "keyword"},
+						},
+					},
+				},
+			},
+			expect: false,
+		},
+		"empty aliases": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Aliases: map[string]opensearch.Alias{},
+				},
+			},
+			expect: true,
+		},
+		"different aliases": {
+			a: opensearch.IndexTemplateDefinition{
+				Template: opensearch.Template{
+					Aliases: map[string]opensearch.Alias{"router-logs": {}},
+				},
+			},
+			expect: false,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			a := opensearch.IndexTemplate{Name: "test", IndexTemplateDefinition: tc.a}
+			b := opensearch.IndexTemplate{Name: "test", IndexTemplateDefinition: tc.b}
+			if got := indexTemplatesEqual(a, b); got != tc.expect {
+				tt.Fatalf("a == b: got %v, expected %v", got, tc.expect)
+			}
+			if got := indexTemplatesEqual(b, a); got != tc.expect {
+				tt.Fatalf("b == a: got %v, expected %v", got, tc.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package sync
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"go.uber.org/zap"
+)
+
+// routerLogsIngestPipeline is the ID of the built-in ingest pipeline which
+// enriches Lagoon router logs.
+const routerLogsIngestPipeline = "lagoon-router-logs"
+
+// ingestPipelinesEqual checks the ingest pipelines for semantic equality.
+// Processors are compared in the normalised form returned by normalizeJSON.
+func ingestPipelinesEqual(a, b opensearch.IngestPipeline) bool {
+	if a.Description != b.Description {
+		return false
+	}
+	if !intPtrEqual(a.Version, b.Version, nil) {
+		return false
+	}
+	if !jsonEqual(a.Meta, b.Meta) {
+		return false
+	}
+	if !jsonEqual(a.Processors, b.Processors) {
+		return false
+	}
+	return jsonEqual(a.OnFailure, b.OnFailure)
+}
+
+// calculateIngestPipelineDiff returns a map of opensearch ingest pipelines
+// which should be created or replaced, and a sorted slice of ingest pipeline
+// IDs which should be deleted, in order to reconcile existing with required.
+//
+// Like component templates, ingest pipelines are replaced in place rather than
+// deleted and recreated, because an ingest pipeline may be the default
+// pipeline of an index which is being written to. Existing ingest pipelines
+// with the ownership marker in their _meta field which are no longer required
+// are deleted. Other ingest pipelines which are not required are not touched.
+func calculateIngestPipelineDiff(existing,
+	required map[string]opensearch.IngestPipeline,
+) (map[string]opensearch.IngestPipeline, []string) {
+	toCreate := map[string]opensearch.IngestPipeline{}
+	for id, rIngestPipeline := range required {
+		eIngestPipeline, ok := existing[id]
+		if !ok || !ingestPipelinesEqual(eIngestPipeline, rIngestPipeline) {
+			toCreate[id] = rIngestPipeline
+		}
+	}
+	var toDelete []string
+	for id, eIngestPipeline := range existing {
+		if _, ok := required[id]; ok {
+			continue
+		}
+		if isOwned(eIngestPipeline.Meta) {
+			toDelete = append(toDelete, id)
+		}
+	}
+	slices.Sort(toDelete)
+	return toCreate, toDelete
+}
+
+// generateIngestPipelines returns a map of ingest pipelines required by Lagoon
+// logging, keyed by ID.
+//
+// The processors ignore failures so that a log with an unexpected value in
+// one of the enriched fields is still indexed, just without the enrichment.
+func generateIngestPipelines() map[string]opensearch.IngestPipeline {
+	return map[string]opensearch.IngestPipeline{
+		routerLogsIngestPipeline: {
+			Description: "Lagoon-owned pipeline: enrich router logs with the " +
+				"location of the client IP address and the parsed user agent.",
+			Processors: []map[string]any{
+				{"geoip": map[string]any{
+					"field":          "remote_addr",
+					"target_field":   "geoip",
+					"ignore_missing": true,
+					"ignore_failure": true,
+				}},
+				{"user_agent": map[string]any{
+					"field":          "http_user_agent",
+					"target_field":   "user_agent",
+					"ignore_missing": true,
+					"ignore_failure": true,
+				}},
+			},
+		},
+	}
+}
+
+// IsBuiltinIngestPipeline returns true if the ingest pipeline with the given
+// ID is one of the ingest pipelines built in to the sync.
+func IsBuiltinIngestPipeline(id string) bool {
+	_, ok := generateIngestPipelines()[id]
+	return ok
+}
+
+// syncIngestPipelines reconciles Opensearch ingest pipelines with Lagoon
+// logging requirements. The extra ingest pipelines are required in addition
+// to the built-in ingest pipelines, and all required ingest pipelines are
+// marked as owned by the sync.
+//
+// It returns the set of IDs of the required ingest pipelines which exist in
+// Opensearch after the sync, or would exist in dry run mode, so that index
+// templates only use ingest pipelines which are ready as their default
+// pipeline.
+func syncIngestPipelines(ctx context.Context, log *zap.Logger,
+	extra map[string]opensearch.IngestPipeline, o OpensearchService,
+	dryRun bool, diff *DiffWriter) map[string]bool {
+	// get ingest pipelines from Opensearch
+	existing, err := o.IngestPipelines(ctx)
+	if err != nil {
+		log.Error("couldn't get ingest pipelines from Opensearch", zap.Error(err))
+		return nil
+	}
+	// generate the ingest pipelines required by Lagoon
+	required := generateIngestPipelines()
+	for id, p := range extra {
+		if _, ok := required[id]; ok {
+			log.Warn("ignoring ingest pipeline with built-in ID",
+				zap.String("id", id))
+			continue
+		}
+		required[id] = p
+	}
+	for id, p := range required {
+		p.Meta = withOwnerMeta(p.Meta)
+		required[id] = p
+	}
+	// required ingest pipelines which already exist are ready, even if they
+	// are out of date
+	ready := map[string]bool{}
+	for id := range required {
+		if _, ok := existing[id]; ok {
+			ready[id] = true
+		}
+	}
+	// calculate ingest pipelines to create, replace, or delete
+	toCreate, toDelete := calculateIngestPipelineDiff(existing, required)
+	for _, id := range slices.Sorted(maps.Keys(toCreate)) {
+		p := toCreate[id]
+		if dryRun {
+			log.Info("dry run mode: not creating ingest pipeline",
+				zap.String("id", id))
+			var eIngestPipeline any
+			if e, ok := existing[id]; ok {
+				eIngestPipeline = e
+			}
+			diff.write(log, "ingestpipeline", "", id, eIngestPipeline, p)
+			ready[id] = true
+			continue
+		}
+		err = o.CreateIngestPipeline(ctx, id, &p)
+		if err != nil {
+			log.Warn("couldn't create ingest pipeline", zap.Error(err))
+			continue
+		}
+		log.Info("created ingest pipeline", zap.String("id", id))
+		ready[id] = true
+	}
+	for _, id := range toDelete {
+		if dryRun {
+			log.Info("dry run mode: not deleting ingest pipeline",
+				zap.String("id", id))
+			diff.write(log, "ingestpipeline", "", id, existing[id], nil)
+			continue
+		}
+		err = o.DeleteIngestPipeline(ctx, id)
+		if err != nil {
+			log.Warn("couldn't delete ingest pipeline", zap.Error(err))
+			continue
+		}
+		log.Info("deleted ingest pipeline", zap.String("id", id))
+	}
+	return ready
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+func TestGenerateIndexTemplatesDefaultPipeline(t *testing.T) {
+	var testCases = map[string]struct {
+		readyPipelines map[string]bool
+		expect         map[string]any
+	}{
+		"ingest pipeline ready": {
+			readyPipelines: map[string]bool{"lagoon-router-logs": true},
+			expect:         map[string]any{"routerlogs": "lagoon-router-logs"},
+		},
+		"ingest pipeline not ready": {
+			readyPipelines: map[string]bool{"custom-logs": true},
+			expect:         map[string]any{},
+		},
+		"ingest pipelines disabled": {
+			expect: map[string]any{},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			required := generateIngestPipelines()
+			pipelines := map[string]any{}
+			for itName, it := range allIndexTemplates(50, false,
+				tc.readyPipelines) {
+				pipeline, ok :=
+					it.IndexTemplateDefinition.Template.Settings["index.default_pipeline"]
+				if !ok {
+					continue
+				}
+				if _, ok = required[pipeline.(string)]; !ok {
+					tt.Fatalf("%s: unknown ingest pipeline %s", itName, pipeline)
+				}
+				pipelines[itName] = pipeline
+			}
+			if !jsonEqual(pipelines, tc.expect) {
+				tt.Fatalf("got %v, expected %v", pipelines, tc.expect)
+			}
+		})
+	}
+}
+
+func TestGeneratedIngestPipelinesStable(t *testing.T) {
+	for id, required := range generateIngestPipelines() {
+		t.Run(id, func(tt *testing.T) {
+			data, err := json.Marshal(required)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			var existing opensearch.IngestPipeline
+			if err = json.Unmarshal(data, &existing); err != nil {
+				tt.Fatal(err)
+			}
+			if !ingestPipelinesEqual(existing, required) {
+				tt.Fatalf("round-tripped ingest pipeline not equal:\n%s", data)
+			}
+			toCreate, toDelete := calculateIngestPipelineDiff(
+				map[string]opensearch.IngestPipeline{id: existing},
+				map[string]opensearch.IngestPipeline{id: required})
+			if len(toCreate) != 0 || len(toDelete) != 0 {
+				tt.Fatalf("unexpected diff: %v %v", toCreate, toDelete)
+			}
+		})
+	}
+}
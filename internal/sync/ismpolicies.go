@@ -0,0 +1,432 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"go.uber.org/zap"
+)
+
+// ismPolicyPrefix is the prefix of the IDs of Lagoon ISM policies.
+const ismPolicyPrefix = "lagoon-"
+
+// ismPolicyDescriptionPrefix is the prefix of the description which marks an
+// ISM policy as "lagoon-owned". Only owned policies are updated or deleted, so
+// that a policy created by an operator with an ID starting with
+// ismPolicyPrefix is not touched.
+const ismPolicyDescriptionPrefix = "Lagoon-owned policy: "
+
+// ISM template priorities. A project retention policy has a higher priority
+// than the family retention policy, so it is applied to the indices of the
+// project instead.
+const (
+	familyISMPriority  = 10
+	projectISMPriority = 20
+)
+
+// defaultISMRetry is the retry configuration which Opensearch adds to each
+// ISM action which doesn't have one.
+var defaultISMRetry = map[string]any{
+	"count":   "3",
+	"backoff": "exponential",
+	"delay":   "1m",
+}
+
+// ISMRetention configures the retention of Lagoon logs by ISM policies.
+type ISMRetention struct {
+	// Days maps log index families, e.g. router-logs, to the number of days
+	// their indices are retained. Families which are not listed are not
+	// deleted.
+	Days map[string]int
+	// ProjectMetadataKey is the key of the Lagoon project metadata whose value
+	// overrides the number of days the indices of every log family of the
+	// project are retained. If it is empty, project metadata is ignored.
+	ProjectMetadataKey string
+}
+
+// Validate the ISMRetention.
+func (r *ISMRetention) Validate() error {
+	for family, days := range r.Days {
+		if !slices.Contains(LogFamilies, family) {
+			return fmt.Errorf("unknown log family %s", family)
+		}
+		if days < 1 {
+			return fmt.Errorf("invalid retention days for %s: %d", family, days)
+		}
+	}
+	return nil
+}
+
+// retentionPolicy returns a Lagoon-owned ISM policy with the given ID which
+// deletes indices matching indexPattern after the given number of days.
+func retentionPolicy(id, indexPattern string, days,
+	priority int) opensearch.ISMPolicy {
+	return opensearch.ISMPolicy{
+		ID: id,
+		Policy: opensearch.ISMPolicyDefinition{
+			Description: fmt.Sprintf("%sdelete %s indices after %d days.",
+				ismPolicyDescriptionPrefix, indexPattern, days),
+			DefaultState: "hot",
+			States: []opensearch.ISMState{
+				{
+					Name:    "hot",
+					Actions: []map[string]any{},
+					Transitions: []opensearch.ISMTransition{{
+						StateName: "delete",
+						Conditions: map[string]any{
+							"min_index_age": fmt.Sprintf("%dd", days),
+						},
+					}},
+				},
+				{
+					Name:        "delete",
+					Actions:     []map[string]any{{"delete": map[string]any{}}},
+					Transitions: []opensearch.ISMTransition{},
+				},
+			},
+			ISMTemplate: []opensearch.ISMTemplate{{
+				IndexPatterns: []string{indexPattern},
+				Priority:      priority,
+			}},
+		},
+	}
+}
+
+// generateISMPolicies returns a map of the ISM policies required by the given
+// retention configuration, keyed by policy ID. A policy is generated for each
+// configured log family, and for each log family of each project which has a
+// retention override in its metadata.
+func generateISMPolicies(log *zap.Logger, retention ISMRetention,
+	projectNames map[int]string,
+	projectsMetadata map[int]map[string]string,
+) map[string]opensearch.ISMPolicy {
+	policies := map[string]opensearch.ISMPolicy{}
+	for family, days := range retention.Days {
+		id := ismPolicyPrefix + family
+		policies[id] = retentionPolicy(id, family+"-*", days, familyISMPriority)
+	}
+	if retention.ProjectMetadataKey == "" {
+		return policies
+	}
+	for pid, metadata := range projectsMetadata {
+		value, ok := metadata[retention.ProjectMetadataKey]
+		if !ok {
+			continue
+		}
+		name, ok := projectNames[pid]
+		if !ok {
+			log.Debug("ignoring metadata of unknown project",
+				zap.Int("projectID", pid))
+			continue
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || days < 1 {
+			log.Warn("ignoring invalid project retention days",
+				zap.String("project", name), zap.String("value", value))
+			continue
+		}
+		for _, family := range LogFamilies {
+			id := fmt.Sprintf("%s%s-%s", ismPolicyPrefix, family, name)
+			policies[id] = retentionPolicy(id,
+				fmt.Sprintf("%s-%s-_-*", family, name), days, projectISMPriority)
+		}
+	}
+	return policies
+}
+
+// normalizeISMActions returns the given ISM actions without any default retry
+// configuration added by Opensearch, in the normalised form returned by
+// normalizeJSON.
+func normalizeISMActions(actions []map[string]any) any {
+	var normalized []map[string]any
+	for _, action := range actions {
+		a := maps.Clone(action)
+		if retry, ok := a["retry"]; ok && jsonEqual(retry, defaultISMRetry) {
+			delete(a, "retry")
+		}
+		normalized = append(normalized, a)
+	}
+	return normalizeJSON(normalized)
+}
+
+// diffableISMPolicy returns the definition of the given ISM policy without
+// the fields which are set by Opensearch, for writing to a DiffWriter.
+func diffableISMPolicy(p opensearch.ISMPolicy) opensearch.ISMPolicyDefinition {
+	def := p.Policy
+	def.PolicyID, def.LastUpdatedTime, def.SchemaVersion = "", nil, nil
+	def.ISMTemplate = slices.Clone(def.ISMTemplate)
+	for i := range def.ISMTemplate {
+		def.ISMTemplate[i].LastUpdatedTime = nil
+	}
+	return def
+}
+
+// ismPoliciesEqual checks the definitions of the ISM policies for semantic
+// equality, ignoring the fields which are set by Opensearch.
+func ismPoliciesEqual(a, b opensearch.ISMPolicy) bool {
+	aDef, bDef := a.Policy, b.Policy
+	if aDef.Description != bDef.Description ||
+		aDef.DefaultState != bDef.DefaultState {
+		return false
+	}
+	if len(aDef.States) != len(bDef.States) {
+		return false
+	}
+	for i := range aDef.States {
+		aState, bState := aDef.States[i], bDef.States[i]
+		if aState.Name != bState.Name {
+			return false
+		}
+		if !reflect.DeepEqual(normalizeISMActions(aState.Actions),
+			normalizeISMActions(bState.Actions)) {
+			return false
+		}
+		if !jsonEqual(aState.Transitions, bState.Transitions) {
+			return false
+		}
+	}
+	if len(aDef.ISMTemplate) != len(bDef.ISMTemplate) {
+		return false
+	}
+	for i := range aDef.ISMTemplate {
+		aTemplate, bTemplate := aDef.ISMTemplate[i], bDef.ISMTemplate[i]
+		if aTemplate.Priority != bTemplate.Priority ||
+			!stringSliceEqual(aTemplate.IndexPatterns, bTemplate.IndexPatterns) {
+			return false
+		}
+	}
+	return true
+}
+
+// isOwnedISMPolicy returns true if the given ISM policy is marked as
+// "lagoon-owned" by the prefix of its description.
+func isOwnedISMPolicy(p opensearch.ISMPolicy) bool {
+	return strings.HasPrefix(p.Policy.Description, ismPolicyDescriptionPrefix)
+}
+
+// calculateISMPolicyDiff returns a map of ISM policies which should be
+// created, a map of ISM policies which should be updated, and a sorted slice
+// of ISM policy IDs which should be deleted, in order to reconcile existing
+// with required.
+//
+// Only "lagoon-owned" ISM policies, which are marked by the prefix of their
+// description, are updated or deleted. An existing policy which is not owned
+// but has the ID of a required policy is left alone with a warning. The
+// policies to update carry the sequence number and primary term of the
+// existing policy, so that a policy which has been modified since it was read
+// is not overwritten.
+func calculateISMPolicyDiff(log *zap.Logger, existing,
+	required map[string]opensearch.ISMPolicy) (
+	map[string]opensearch.ISMPolicy, map[string]opensearch.ISMPolicy,
+	[]string) {
+	toCreate := map[string]opensearch.ISMPolicy{}
+	toUpdate := map[string]opensearch.ISMPolicy{}
+	for id, rPolicy := range required {
+		ePolicy, ok := existing[id]
+		if !ok {
+			toCreate[id] = rPolicy
+			continue
+		}
+		if !isOwnedISMPolicy(ePolicy) {
+			log.Warn("ignoring required ISM policy which is not lagoon-owned",
+				zap.String("id", id))
+			continue
+		}
+		if !ismPoliciesEqual(ePolicy, rPolicy) {
+			rPolicy.SeqNo, rPolicy.PrimaryTerm = ePolicy.SeqNo, ePolicy.PrimaryTerm
+			toUpdate[id] = rPolicy
+		}
+	}
+	var toDelete []string
+	for id, ePolicy := range existing {
+		if !isOwnedISMPolicy(ePolicy) {
+			continue // this is not a lagoon-owned policy: don't touch it
+		}
+		if _, ok := required[id]; !ok {
+			toDelete = append(toDelete, id)
+		}
+	}
+	slices.Sort(toDelete)
+	return toCreate, toUpdate, toDelete
+}
+
+// fallbackISMPolicy returns the ID of the required ISM policy which
+// Opensearch would apply to a new index with the given name: the policy with
+// the highest priority ISM template matching the index. If no required policy
+// matches the index, it returns the empty string.
+func fallbackISMPolicy(index string,
+	required map[string]opensearch.ISMPolicy) string {
+	var fallback string
+	priority := -1
+	for _, id := range slices.Sorted(maps.Keys(required)) {
+		for _, t := range required[id].Policy.ISMTemplate {
+			if t.Priority <= priority {
+				continue
+			}
+			for _, pattern := range t.IndexPatterns {
+				if ok, _ := path.Match(pattern, index); ok {
+					fallback, priority = id, t.Priority
+					break
+				}
+			}
+		}
+	}
+	return fallback
+}
+
+// ismManagedIndices returns a sorted slice of the indices which are managed by
+// the given existing ISM policy and match the index patterns of its ISM
+// templates.
+func ismManagedIndices(ctx context.Context, o OpensearchService,
+	p opensearch.ISMPolicy) ([]string, error) {
+	var patterns []string
+	for _, t := range p.Policy.ISMTemplate {
+		patterns = append(patterns, t.IndexPatterns...)
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	managed, err := o.ISMManagedIndices(ctx, patterns)
+	if err != nil {
+		return nil, err
+	}
+	var indices []string
+	for index, id := range managed {
+		if id == p.ID {
+			indices = append(indices, index)
+		}
+	}
+	slices.Sort(indices)
+	return indices, nil
+}
+
+// detachISMPolicy moves the indices managed by the given existing ISM policy,
+// which is about to be deleted, to the required policy which Opensearch would
+// apply to them if they were created now. Indices which no required policy
+// matches are no longer managed by ISM. Otherwise the indices would be left
+// attached to a deleted policy, and never deleted.
+func detachISMPolicy(ctx context.Context, log *zap.Logger,
+	o OpensearchService, p opensearch.ISMPolicy,
+	required map[string]opensearch.ISMPolicy) error {
+	indices, err := ismManagedIndices(ctx, o, p)
+	if err != nil {
+		return fmt.Errorf("couldn't get managed indices: %v", err)
+	}
+	fallbacks := map[string][]string{}
+	for _, index := range indices {
+		fallback := fallbackISMPolicy(index, required)
+		fallbacks[fallback] = append(fallbacks[fallback], index)
+	}
+	for _, fallback := range slices.Sorted(maps.Keys(fallbacks)) {
+		if fallback == "" {
+			err = o.RemoveISMPolicy(ctx, fallbacks[fallback])
+		} else {
+			err = o.ChangeISMPolicy(ctx, fallbacks[fallback], fallback)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't change policy of managed indices: %v", err)
+		}
+		log.Info("changed ISM policy of managed indices",
+			zap.String("from", p.ID), zap.String("to", fallback),
+			zap.Int("indices", len(fallbacks[fallback])))
+	}
+	return nil
+}
+
+// syncISMPolicies reconciles Opensearch ISM policies with the Lagoon log
+// retention configuration.
+//
+// ISM applies the version of a policy which was current when it started
+// managing an index. So after a policy is updated, the new version is applied
+// to the indices it already manages. Policies are created before owned
+// policies are deleted, so that the indices managed by a deleted policy can be
+// moved to the policy which replaces it. If they can't be moved, the policy is
+// not deleted, and it is tried again on the next sync.
+func syncISMPolicies(ctx context.Context, log *zap.Logger,
+	retention ISMRetention, projectNames map[int]string,
+	projectsMetadata map[int]map[string]string, o OpensearchService,
+	dryRun bool, diff *DiffWriter) {
+	// get ISM policies from Opensearch
+	existing, err := o.ISMPolicies(ctx)
+	if err != nil {
+		log.Error("couldn't get ISM policies from Opensearch", zap.Error(err))
+		return
+	}
+	// generate the ISM policies required by Lagoon
+	required := generateISMPolicies(log, retention, projectNames,
+		projectsMetadata)
+	// calculate ISM policies to add/update/remove
+	toCreate, toUpdate, toDelete :=
+		calculateISMPolicyDiff(log, existing, required)
+	for _, id := range slices.Sorted(maps.Keys(toCreate)) {
+		p := toCreate[id]
+		if dryRun {
+			log.Info("dry run mode: not creating ISM policy", zap.String("id", id))
+			diff.write(log, "ismpolicy", "", id, nil, p.Policy)
+			continue
+		}
+		err = o.CreateISMPolicy(ctx, &p)
+		if err != nil {
+			log.Warn("couldn't create ISM policy", zap.Error(err))
+			continue
+		}
+		log.Info("created ISM policy", zap.String("id", id))
+	}
+	for _, id := range slices.Sorted(maps.Keys(toUpdate)) {
+		p := toUpdate[id]
+		if dryRun {
+			log.Info("dry run mode: not updating ISM policy", zap.String("id", id))
+			diff.write(log, "ismpolicy", "", id, diffableISMPolicy(existing[id]),
+				p.Policy)
+			continue
+		}
+		err = o.UpdateISMPolicy(ctx, &p)
+		if err != nil {
+			// the policy may have been modified concurrently: it is compared
+			// again on the next sync
+			log.Warn("couldn't update ISM policy", zap.Error(err))
+			continue
+		}
+		log.Info("updated ISM policy", zap.String("id", id))
+		// apply the new version of the policy to the indices it manages
+		indices, err := ismManagedIndices(ctx, o, existing[id])
+		if err == nil && len(indices) > 0 {
+			err = o.ChangeISMPolicy(ctx, indices, id)
+		}
+		if err != nil {
+			log.Warn("couldn't apply updated ISM policy to managed indices",
+				zap.String("id", id), zap.Error(err))
+			continue
+		}
+		log.Info("applied updated ISM policy to managed indices",
+			zap.String("id", id), zap.Int("indices", len(indices)))
+	}
+	for _, id := range toDelete {
+		if dryRun {
+			log.Info("dry run mode: not deleting ISM policy or changing the "+
+				"policy of its managed indices", zap.String("id", id))
+			diff.write(log, "ismpolicy", "", id, diffableISMPolicy(existing[id]),
+				nil)
+			continue
+		}
+		err = detachISMPolicy(ctx, log, o, existing[id], required)
+		if err != nil {
+			log.Warn("couldn't detach ISM policy from managed indices: "+
+				"not deleting it", zap.String("id", id), zap.Error(err))
+			continue
+		}
+		err = o.DeleteISMPolicy(ctx, id)
+		if err != nil {
+			log.Warn("couldn't delete ISM policy", zap.Error(err))
+			continue
+		}
+		log.Info("deleted ISM policy", zap.String("id", id))
+	}
+}
@@ -0,0 +1,182 @@
+package sync_test
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+func TestISMRetentionValidate(t *testing.T) {
+	var testCases = map[string]struct {
+		input     sync.ISMRetention
+		expectErr bool
+	}{
+		"valid": {
+			input: sync.ISMRetention{Days: map[string]int{"router-logs": 14}},
+		},
+		"unknown family": {
+			input:     sync.ISMRetention{Days: map[string]int{"audit-logs": 14}},
+			expectErr: true,
+		},
+		"invalid days": {
+			input:     sync.ISMRetention{Days: map[string]int{"router-logs": 0}},
+			expectErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			err := tc.input.Validate()
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
+
+func TestGenerateISMPolicies(t *testing.T) {
+	projectNames := map[int]string{1: "project-a", 2: "project-b", 3: "project-c"}
+	projectsMetadata := map[int]map[string]string{
+		1: {"logs-retention-days": "90"},
+		2: {"logs-retention-days": "forever"},
+		3: {"other": "value"},
+		4: {"logs-retention-days": "30"},
+	}
+	var testCases = map[string]struct {
+		retention sync.ISMRetention
+		expectIDs []string
+	}{
+		"families only": {
+			retention: sync.ISMRetention{
+				Days: map[string]int{"router-logs": 14, "lagoon-logs": 30},
+			},
+			expectIDs: []string{"lagoon-lagoon-logs", "lagoon-router-logs"},
+		},
+		"project metadata": {
+			retention: sync.ISMRetention{
+				Days:               map[string]int{"router-logs": 14},
+				ProjectMetadataKey: "logs-retention-days",
+			},
+			expectIDs: []string{
+				"lagoon-application-logs-project-a",
+				"lagoon-container-logs-project-a",
+				"lagoon-lagoon-logs-project-a",
+				"lagoon-router-logs",
+				"lagoon-router-logs-project-a",
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			policies := sync.GenerateISMPolicies(zap.NewNop(), tc.retention,
+				projectNames, projectsMetadata)
+			assert.Equal(tt, tc.expectIDs, slices.Sorted(maps.Keys(policies)),
+				name)
+		})
+	}
+	policies := sync.GenerateISMPolicies(zap.NewNop(), sync.ISMRetention{
+		ProjectMetadataKey: "logs-retention-days",
+	}, projectNames, projectsMetadata)
+	p := policies["lagoon-router-logs-project-a"].Policy
+	assert.Equal(t, []opensearch.ISMTemplate{{
+		IndexPatterns: []string{"router-logs-project-a-_-*"},
+		Priority:      20,
+	}}, p.ISMTemplate, "project ISM template")
+	assert.Equal(t, map[string]any{"min_index_age": "90d"},
+		p.States[0].Transitions[0].Conditions, "project retention")
+}
+
+func TestCalculateISMPolicyDiff(t *testing.T) {
+	required := sync.GenerateISMPolicies(zap.NewNop(), sync.ISMRetention{
+		Days: map[string]int{"router-logs": 14},
+	}, nil, nil)
+	// simulate the policy as returned by Opensearch, with server-side fields
+	data, err := json.Marshal(required["lagoon-router-logs"])
+	assert.NoError(t, err, "marshal")
+	var returned opensearch.ISMPolicy
+	assert.NoError(t, json.Unmarshal(data, &returned), "unmarshal")
+	lastUpdated, schemaVersion := int64(1760000000000), 21
+	returned.SeqNo, returned.PrimaryTerm = 7, 1
+	returned.Policy.PolicyID = "lagoon-router-logs"
+	returned.Policy.LastUpdatedTime = &lastUpdated
+	returned.Policy.SchemaVersion = &schemaVersion
+	returned.Policy.ISMTemplate[0].LastUpdatedTime = &lastUpdated
+	returned.Policy.States[1].Actions[0]["retry"] = map[string]any{
+		"count":   float64(3),
+		"backoff": "exponential",
+		"delay":   "1m",
+	}
+	outdated := sync.GenerateISMPolicies(zap.NewNop(), sync.ISMRetention{
+		Days: map[string]int{"router-logs": 7},
+	}, nil, nil)["lagoon-router-logs"]
+	outdated.SeqNo, outdated.PrimaryTerm = 3, 2
+	owned := opensearch.ISMPolicyDefinition{
+		Description: "Lagoon-owned policy: delete old indices.",
+	}
+	var testCases = map[string]struct {
+		existing       map[string]opensearch.ISMPolicy
+		expectCreate   []string
+		expectUpdate   map[string][2]int64
+		expectToDelete []string
+	}{
+		"create": {
+			existing: map[string]opensearch.ISMPolicy{
+				"hot-warm": {ID: "hot-warm"},
+			},
+			expectCreate: []string{"lagoon-router-logs"},
+			expectUpdate: map[string][2]int64{},
+		},
+		"up to date": {
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs": returned,
+			},
+			expectUpdate: map[string][2]int64{},
+		},
+		"update with version": {
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs": outdated,
+			},
+			expectUpdate: map[string][2]int64{"lagoon-router-logs": {3, 2}},
+		},
+		"delete lagoon-owned only": {
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs": returned,
+				"lagoon-router-logs-project-z": {
+					ID:     "lagoon-router-logs-project-z",
+					Policy: owned,
+				},
+				"lagoon-manual": {ID: "lagoon-manual"},
+				"hot-warm":      {ID: "hot-warm"},
+			},
+			expectUpdate:   map[string][2]int64{},
+			expectToDelete: []string{"lagoon-router-logs-project-z"},
+		},
+		"required policy not lagoon-owned": {
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs": {ID: "lagoon-router-logs", SeqNo: 3},
+			},
+			expectUpdate: map[string][2]int64{},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			toCreate, toUpdate, toDelete :=
+				sync.CalculateISMPolicyDiff(zap.NewNop(), tc.existing, required)
+			assert.Equal(tt, tc.expectCreate, slices.Sorted(maps.Keys(toCreate)),
+				"create")
+			update := map[string][2]int64{}
+			for id, p := range toUpdate {
+				update[id] = [2]int64{p.SeqNo, p.PrimaryTerm}
+			}
+			assert.Equal(tt, tc.expectUpdate, update, "update")
+			assert.Equal(tt, tc.expectToDelete, toDelete, "delete")
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+)
+
+var (
+	operationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lagoon_opensearch_sync_operations_total",
+		Help: "The total number of write operations on Opensearch objects.",
+	}, []string{"cluster", "object", "operation", "result"})
+	syncRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lagoon_opensearch_sync_runs_total",
+		Help: "The total number of synchronisation runs.",
+	}, []string{"cluster", "result"})
+	syncDurationSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lagoon_opensearch_sync_duration_seconds",
+		Help: "The duration of the most recent synchronisation run.",
+	}, []string{"cluster"})
+	syncLastSuccessSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lagoon_opensearch_sync_last_success_timestamp_seconds",
+		Help: "The Unix time of the most recent successful synchronisation run.",
+	}, []string{"cluster"})
+)
+
+// result returns the metric label value for the given error.
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// observeSync records the metrics for a synchronisation run of the named
+// cluster which started at the given time.
+func observeSync(cluster string, start time.Time, err error) {
+	syncRunsTotal.WithLabelValues(cluster, result(err)).Inc()
+	syncDurationSeconds.WithLabelValues(cluster).
+		Set(time.Since(start).Seconds())
+	if err == nil {
+		syncLastSuccessSeconds.WithLabelValues(cluster).
+			SetToCurrentTime()
+	}
+}
+
+// observeOperation records the metrics for a single write operation on an
+// Opensearch object, and returns the given error.
+func observeOperation(cluster, object, operation string, err error) error {
+	operationsTotal.WithLabelValues(cluster, object, operation, result(err)).
+		Inc()
+	return err
+}
+
+// observePatch records the metrics for each operation in a successful PATCH
+// request on Opensearch objects, and returns the given error.
+//
+// The operations in a failed PATCH request are retried using individual
+// requests, which record the final result of each operation. So nothing is
+// recorded for a failed PATCH request, to avoid counting each operation
+// twice.
+func observePatch(cluster, object string, ops []jsonpatch.Operation,
+	err error) error {
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		operation := "create"
+		if op.Op == "remove" {
+			operation = "delete"
+		}
+		operationsTotal.WithLabelValues(cluster, object, operation, "success").
+			Inc()
+	}
+	return nil
+}
+
+// instrumentedOpensearch wraps an OpensearchService and records metrics for
+// write operations.
+type instrumentedOpensearch struct {
+	OpensearchService
+	cluster string
+}
+
+// CreateTenant implements OpensearchService.
+func (i *instrumentedOpensearch) CreateTenant(ctx context.Context,
+	name string, tenant *opensearch.Tenant) error {
+	return observeOperation(i.cluster, "tenant", "create",
+		i.OpensearchService.CreateTenant(ctx, name, tenant))
+}
+
+// DeleteTenant implements OpensearchService.
+func (i *instrumentedOpensearch) DeleteTenant(ctx context.Context,
+	name string) error {
+	return observeOperation(i.cluster, "tenant", "delete",
+		i.OpensearchService.DeleteTenant(ctx, name))
+}
+
+// CreateRole implements OpensearchService.
+func (i *instrumentedOpensearch) CreateRole(ctx context.Context,
+	name string, role *opensearch.Role) error {
+	return observeOperation(i.cluster, "role", "create",
+		i.OpensearchService.CreateRole(ctx, name, role))
+}
+
+// DeleteRole implements OpensearchService.
+func (i *instrumentedOpensearch) DeleteRole(ctx context.Context,
+	name string) error {
+	return observeOperation(i.cluster, "role", "delete",
+		i.OpensearchService.DeleteRole(ctx, name))
+}
+
+// PatchRoles implements OpensearchService.
+func (i *instrumentedOpensearch) PatchRoles(ctx context.Context,
+	ops []jsonpatch.Operation) error {
+	return observePatch(i.cluster, "role", ops,
+		i.OpensearchService.PatchRoles(ctx, ops))
+}
+
+// CreateRoleMapping implements OpensearchService.
+func (i *instrumentedOpensearch) CreateRoleMapping(ctx context.Context,
+	name string, rolemapping *opensearch.RoleMapping) error {
+	return observeOperation(i.cluster, "rolemapping", "create",
+		i.OpensearchService.CreateRoleMapping(ctx, name, rolemapping))
+}
+
+// DeleteRoleMapping implements OpensearchService.
+func (i *instrumentedOpensearch) DeleteRoleMapping(ctx context.Context,
+	name string) error {
+	return observeOperation(i.cluster, "rolemapping", "delete",
+		i.OpensearchService.DeleteRoleMapping(ctx, name))
+}
+
+// PatchRolesMapping implements OpensearchService.
+func (i *instrumentedOpensearch) PatchRolesMapping(ctx context.Context,
+	ops []jsonpatch.Operation) error {
+	return observePatch(i.cluster, "rolemapping", ops,
+		i.OpensearchService.PatchRolesMapping(ctx, ops))
+}
+
+// CreateComponentTemplate implements OpensearchService.
+func (i *instrumentedOpensearch) CreateComponentTemplate(ctx context.Context,
+	name string, componentTemplate *opensearch.ComponentTemplate) error {
+	return observeOperation(i.cluster, "componenttemplate", "create",
+		i.OpensearchService.CreateComponentTemplate(ctx, name, componentTemplate))
+}
+
+// DeleteComponentTemplate implements OpensearchService.
+func (i *instrumentedOpensearch) DeleteComponentTemplate(ctx context.Context,
+	name string) error {
+	return observeOperation(i.cluster, "componenttemplate", "delete",
+		i.OpensearchService.DeleteComponentTemplate(ctx, name))
+}
+
+// CreateIngestPipeline implements OpensearchService.
+func (i *instrumentedOpensearch) CreateIngestPipeline(ctx context.Context,
+	id string, ingestPipeline *opensearch.IngestPipeline) error {
+	return observeOperation(i.cluster, "ingestpipeline", "create",
+		i.OpensearchService.CreateIngestPipeline(ctx, id, ingestPipeline))
+}
+
+// DeleteIngestPipeline implements OpensearchService.
+func (i *instrumentedOpensearch) DeleteIngestPipeline(ctx context.Context,
+	id string) error {
+	return observeOperation(i.cluster, "ingestpipeline", "delete",
+		i.OpensearchService.DeleteIngestPipeline(ctx, id))
+}
+
+// CreateIndexTemplate implements OpensearchService.
+func (i *instrumentedOpensearch) CreateIndexTemplate(ctx context.Context,
+	name string, indexTemplate *opensearch.IndexTemplate) error {
+	return observeOperation(i.cluster, "indextemplate", "create",
+		i.OpensearchService.CreateIndexTemplate(ctx, name, indexTemplate))
+}
+
+// DeleteIndexTemplate implements OpensearchService.
+func (i *instrumentedOpensearch) DeleteIndexTemplate(ctx context.Context,
+	name string) error {
+	return observeOperation(i.cluster, "indextemplate", "delete",
+		i.OpensearchService.DeleteIndexTemplate(ctx, name))
+}
+
+// CreateISMPolicy implements OpensearchService.
+func (i *instrumentedOpensearch) CreateISMPolicy(ctx context.Context,
+	policy *opensearch.ISMPolicy) error {
+	return observeOperation(i.cluster, "ismpolicy", "create",
+		i.OpensearchService.CreateISMPolicy(ctx, policy))
+}
+
+// UpdateISMPolicy implements OpensearchService.
+func (i *instrumentedOpensearch) UpdateISMPolicy(ctx context.Context,
+	policy *opensearch.ISMPolicy) error {
+	return observeOperation(i.cluster, "ismpolicy", "update",
+		i.OpensearchService.UpdateISMPolicy(ctx, policy))
+}
+
+// DeleteISMPolicy implements OpensearchService.
+func (i *instrumentedOpensearch) DeleteISMPolicy(ctx context.Context,
+	id string) error {
+	return observeOperation(i.cluster, "ismpolicy", "delete",
+		i.OpensearchService.DeleteISMPolicy(ctx, id))
+}
+
+// ChangeISMPolicy implements OpensearchService.
+func (i *instrumentedOpensearch) ChangeISMPolicy(ctx context.Context,
+	indices []string, policyID string) error {
+	return observeOperation(i.cluster, "managedindex", "update",
+		i.OpensearchService.ChangeISMPolicy(ctx, indices, policyID))
+}
+
+// RemoveISMPolicy implements OpensearchService.
+func (i *instrumentedOpensearch) RemoveISMPolicy(ctx context.Context,
+	indices []string) error {
+	return observeOperation(i.cluster, "managedindex", "delete",
+		i.OpensearchService.RemoveISMPolicy(ctx, indices))
+}
+
+// instrumentedDashboards wraps a DashboardsService and records metrics for
+// write operations.
+type instrumentedDashboards struct {
+	DashboardsService
+	cluster string
+}
+
+// CreateIndexPattern implements DashboardsService.
+func (i *instrumentedDashboards) CreateIndexPattern(ctx context.Context,
+	tenant, pattern string) error {
+	return observeOperation(i.cluster, "indexpattern", "create",
+		i.DashboardsService.CreateIndexPattern(ctx, tenant, pattern))
+}
+
+// DeleteIndexPattern implements DashboardsService.
+func (i *instrumentedDashboards) DeleteIndexPattern(ctx context.Context,
+	tenant, id string) error {
+	return observeOperation(i.cluster, "indexpattern", "delete",
+		i.DashboardsService.DeleteIndexPattern(ctx, tenant, id))
+}
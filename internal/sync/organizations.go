@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"go.uber.org/zap"
+)
+
+// organizationTenant returns the name of the tenant of the given
+// organization.
+func organizationTenant(org lagoondb.Organization) string {
+	return "organization-" + org.Name
+}
+
+// generateOrganizationRoles returns a map of roles generated from the given
+// slice of Lagoon organizations. Each organization has an owner role, which
+// can write to the organization tenant, and a viewer role, which can only
+// read the organization tenant. Both roles can read the logs of all the
+// projects in the organization.
+func generateOrganizationRoles(
+	log *zap.Logger,
+	organizations []lagoondb.Organization,
+	projectNames map[int]string,
+	organizationProjectsMap map[int][]int,
+) map[string]opensearch.Role {
+	roles := map[string]opensearch.Role{}
+	for _, org := range organizations {
+		indexPatterns := generateIndexPermissionPatterns(log,
+			organizationProjectsMap[org.ID], projectNames)
+		tenant := organizationTenant(org)
+		for suffix, tenantAction := range map[string]string{
+			"owner":  "kibana_all_write",
+			"viewer": "kibana_all_read",
+		} {
+			roles[fmt.Sprintf("o%d-%s", org.ID, suffix)] = opensearch.Role{
+				RolePermissions: opensearch.RolePermissions{
+					// Allow users to read and download Reports
+					// https://github.com/opensearch-project/security/blob/2.7.0.0/config/
+					// 		roles.yml#L126-L132
+					ClusterPermissions: []string{
+						"cluster:admin/opendistro/reports/instance/list",
+						"cluster:admin/opendistro/reports/instance/get",
+						"cluster:admin/opendistro/reports/menu/download",
+					},
+					IndexPermissions: generateIndexPermissions(indexPatterns),
+					TenantPermissions: []opensearch.TenantPermission{
+						{
+							AllowedActions: []string{tenantAction},
+							TenantPatterns: []string{tenant},
+						},
+					},
+				},
+			}
+		}
+	}
+	return roles
+}
+
+// generateOrganizationRolesMapping returns a map of rolesmapping generated
+// from the given slice of Lagoon organizations and the given map of
+// organization ID to organization members. The owner role of each
+// organization is mapped from the usernames of the organization owners, and
+// the viewer role from the usernames of the organization viewers.
+func generateOrganizationRolesMapping(
+	organizations []lagoondb.Organization,
+	organizationMembers map[int]keycloak.OrganizationMembers,
+) map[string]opensearch.RoleMapping {
+	rolesmapping := map[string]opensearch.RoleMapping{}
+	for _, org := range organizations {
+		members := organizationMembers[org.ID]
+		for suffix, users := range map[string][]string{
+			"owner":  members.Owners,
+			"viewer": members.Viewers,
+		} {
+			rolesmapping[fmt.Sprintf("o%d-%s", org.ID, suffix)] =
+				opensearch.RoleMapping{
+					RoleMappingPermissions: opensearch.RoleMappingPermissions{
+						BackendRoles:    []string{},
+						AndBackendRoles: []string{},
+						Hosts:           []string{},
+						Users:           append([]string{}, users...),
+					},
+				}
+		}
+	}
+	return rolesmapping
+}
+
+// generateOrganizationTenants returns a map of tenants generated from the
+// given slice of Lagoon organizations.
+func generateOrganizationTenants(
+	organizations []lagoondb.Organization,
+) map[string]opensearch.Tenant {
+	tenants := map[string]opensearch.Tenant{}
+	for _, org := range organizations {
+		tenant := organizationTenant(org)
+		tenants[tenant] = opensearch.Tenant{
+			TenantDescription: opensearch.TenantDescription{
+				Description: tenant,
+			},
+		}
+	}
+	return tenants
+}
+
+// generateOrganizationIndexPatterns returns a map of index patterns for the
+// tenants of the given slice of Lagoon organizations. Each tenant contains
+// index patterns for all the projects in the organization.
+func generateOrganizationIndexPatterns(
+	log *zap.Logger,
+	organizations []lagoondb.Organization,
+	projectNames map[int]string,
+	organizationProjectsMap map[int][]int,
+	legacyDelimiter bool,
+) map[string]map[string]bool {
+	indexPatterns := map[string]map[string]bool{}
+	for _, org := range organizations {
+		tenant := organizationTenant(org)
+		indexPatterns[tenant] = map[string]bool{}
+		for _, pattern := range generateIndexPatternsForProjects(log,
+			organizationProjectsMap[org.ID], projectNames, legacyDelimiter) {
+			indexPatterns[tenant][pattern] = true
+		}
+	}
+	return indexPatterns
+}
+
+// mergeRequired adds the entries in extra to required. Entries in extra which
+// have the same name as an entry in required are ignored, so that Lagoon
+// group objects take precedence over organization objects.
+func mergeRequired[V any](
+	log *zap.Logger,
+	object string,
+	required,
+	extra map[string]V,
+) {
+	for name, v := range extra {
+		if _, ok := required[name]; ok {
+			log.Warn("ignoring organization "+object+" with conflicting name",
+				zap.String("name", name))
+			continue
+		}
+		required[name] = v
+	}
+}
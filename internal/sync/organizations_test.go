@@ -0,0 +1,270 @@
+package sync_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+var (
+	testOrganizations = []lagoondb.Organization{
+		{ID: 1, Name: "acme"},
+		{ID: 2, Name: "empty"},
+	}
+	testOrganizationProjectsMap = map[int][]int{
+		1: {33, 34},
+	}
+	testOrganizationProjectNames = map[int]string{
+		4:  "baz",
+		33: "foo",
+		34: "bar",
+	}
+)
+
+func TestGenerateOrganizationRoles(t *testing.T) {
+	reportsPermissions := []string{
+		"cluster:admin/opendistro/reports/instance/list",
+		"cluster:admin/opendistro/reports/instance/get",
+		"cluster:admin/opendistro/reports/menu/download",
+	}
+	acmeIndexPermissions := []opensearch.IndexPermission{
+		{
+			AllowedActions: []string{
+				"read",
+				"indices:monitor/settings/get",
+			},
+			IndexPatterns: []string{
+				"application-logs-foo-_-*",
+				"container-logs-foo-_-*",
+				"lagoon-logs-foo-_-*",
+				"router-logs-foo-_-*",
+				"application-logs-bar-_-*",
+				"container-logs-bar-_-*",
+				"lagoon-logs-bar-_-*",
+				"router-logs-bar-_-*",
+			},
+			MaskedFields: []string{},
+		},
+	}
+	expect := map[string]opensearch.Role{
+		"o1-owner": {
+			RolePermissions: opensearch.RolePermissions{
+				ClusterPermissions: reportsPermissions,
+				IndexPermissions:   acmeIndexPermissions,
+				TenantPermissions: []opensearch.TenantPermission{
+					{
+						AllowedActions: []string{"kibana_all_write"},
+						TenantPatterns: []string{"organization-acme"},
+					},
+				},
+			},
+		},
+		"o1-viewer": {
+			RolePermissions: opensearch.RolePermissions{
+				ClusterPermissions: reportsPermissions,
+				IndexPermissions:   acmeIndexPermissions,
+				TenantPermissions: []opensearch.TenantPermission{
+					{
+						AllowedActions: []string{"kibana_all_read"},
+						TenantPatterns: []string{"organization-acme"},
+					},
+				},
+			},
+		},
+		"o2-owner": {
+			RolePermissions: opensearch.RolePermissions{
+				ClusterPermissions: reportsPermissions,
+				IndexPermissions:   []opensearch.IndexPermission{},
+				TenantPermissions: []opensearch.TenantPermission{
+					{
+						AllowedActions: []string{"kibana_all_write"},
+						TenantPatterns: []string{"organization-empty"},
+					},
+				},
+			},
+		},
+		"o2-viewer": {
+			RolePermissions: opensearch.RolePermissions{
+				ClusterPermissions: reportsPermissions,
+				IndexPermissions:   []opensearch.IndexPermission{},
+				TenantPermissions: []opensearch.TenantPermission{
+					{
+						AllowedActions: []string{"kibana_all_read"},
+						TenantPatterns: []string{"organization-empty"},
+					},
+				},
+			},
+		},
+	}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	roles := sync.GenerateOrganizationRoles(log, testOrganizations,
+		testOrganizationProjectNames, testOrganizationProjectsMap)
+	assert.Equal(t, expect, roles, "organization roles")
+}
+
+func TestGenerateOrganizationRolesMapping(t *testing.T) {
+	// organization membership as stored by Lagoon in Keycloak user attributes
+	users := []keycloak.User{
+		{
+			Username:   "owner@example.com",
+			Attributes: map[string][]string{"lagoon-organizations": {"1"}},
+		},
+		{
+			Username: "admin@example.com",
+			Attributes: map[string][]string{
+				"lagoon-organizations-admin": {"1,2"},
+			},
+		},
+		{
+			Username: "viewer@example.com",
+			Attributes: map[string][]string{
+				"lagoon-organizations-viewer": {"1"},
+			},
+		},
+		{
+			Username: "developer@example.com",
+			Attributes: map[string][]string{
+				"lagoon-projects": {"1"},
+			},
+		},
+	}
+	mapping := func(users ...string) opensearch.RoleMapping {
+		return opensearch.RoleMapping{
+			RoleMappingPermissions: opensearch.RoleMappingPermissions{
+				BackendRoles:    []string{},
+				AndBackendRoles: []string{},
+				Hosts:           []string{},
+				Users:           append([]string{}, users...),
+			},
+		}
+	}
+	expect := map[string]opensearch.RoleMapping{
+		"o1-owner":  mapping("admin@example.com", "owner@example.com"),
+		"o1-viewer": mapping("viewer@example.com"),
+		"o2-owner":  mapping("admin@example.com"),
+		"o2-viewer": mapping(),
+	}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	rolesmapping := sync.GenerateOrganizationRolesMapping(testOrganizations,
+		keycloak.OrganizationMembersMap(log, users))
+	assert.Equal(t, expect, rolesmapping, "organization rolesmapping")
+}
+
+func TestGenerateOrganizationTenants(t *testing.T) {
+	expect := map[string]opensearch.Tenant{
+		"organization-acme": {
+			TenantDescription: opensearch.TenantDescription{
+				Description: "organization-acme",
+			},
+		},
+		"organization-empty": {
+			TenantDescription: opensearch.TenantDescription{
+				Description: "organization-empty",
+			},
+		},
+	}
+	tenants := sync.GenerateOrganizationTenants(testOrganizations)
+	assert.Equal(t, expect, tenants, "organization tenants")
+}
+
+func TestGenerateOrganizationIndexPatterns(t *testing.T) {
+	expect := map[string]map[string]bool{
+		"organization-acme": {
+			"application-logs-foo-_-*": true,
+			"container-logs-foo-_-*":   true,
+			"lagoon-logs-foo-_-*":      true,
+			"router-logs-foo-_-*":      true,
+			"application-logs-bar-_-*": true,
+			"container-logs-bar-_-*":   true,
+			"lagoon-logs-bar-_-*":      true,
+			"router-logs-bar-_-*":      true,
+			"application-logs-*":       true,
+			"container-logs-*":         true,
+			"lagoon-logs-*":            true,
+			"router-logs-*":            true,
+		},
+		"organization-empty": {
+			"application-logs-*": true,
+			"container-logs-*":   true,
+			"lagoon-logs-*":      true,
+			"router-logs-*":      true,
+		},
+	}
+	log := zap.Must(zap.NewDevelopment(zap.AddStacktrace(zap.ErrorLevel)))
+	indexPatterns := sync.GenerateOrganizationIndexPatterns(log,
+		testOrganizations, testOrganizationProjectNames,
+		testOrganizationProjectsMap, false)
+	assert.Equal(t, expect, indexPatterns, "organization index patterns")
+}
+
+func TestSyncOrganizations(t *testing.T) {
+	l := &fakeLagoonDB{
+		projects: []lagoondb.Project{
+			{ID: 1, Name: "project-a"},
+		},
+		groupProjectsMap:        map[string][]int{},
+		organizations:           []lagoondb.Organization{{ID: 1, Name: "acme"}},
+		organizationProjectsMap: map[int][]int{1: {1}},
+	}
+	k := &fakeKeycloak{
+		users: []keycloak.User{{
+			Username:   "owner@example.com",
+			Attributes: map[string][]string{"lagoon-organizations": {"1"}},
+		}},
+	}
+	var testCases = map[string]struct {
+		organizations bool
+		expectCalls   []string
+		expectOwners  []string
+	}{
+		"organizations disabled": {
+			expectCalls: []string{
+				"DeleteTenant stale-a",
+				"DeleteTenant stale-b",
+				"PatchRoles remove /p98, remove /p99, remove /stale-a, add /p1",
+				"PatchRolesMapping remove /p99, remove /stale-a, add /p1",
+			},
+		},
+		"organizations enabled": {
+			organizations: true,
+			expectCalls: []string{
+				"DeleteTenant stale-a",
+				"DeleteTenant stale-b",
+				"CreateTenant organization-acme",
+				"PatchRoles remove /p98, remove /p99, remove /stale-a, " +
+					"add /o1-owner, add /o1-viewer, add /p1",
+				"PatchRolesMapping remove /p99, remove /stale-a, " +
+					"add /o1-owner, add /o1-viewer, add /p1",
+			},
+			expectOwners: []string{"owner@example.com"},
+		},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			o := newFakeOpensearch()
+			err := sync.Sync(context.Background(), log, l, k, []sync.Target{{
+				Name:          "default",
+				Opensearch:    o,
+				Dashboards:    o,
+				Objects:       []string{"tenants", "roles", "rolesmapping"},
+				Organizations: tc.organizations,
+			}}, false, nil)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectCalls, o.calls, name)
+			var owners []string
+			for _, op := range o.rolesMappingOps {
+				if op.Path == "/o1-owner" {
+					owners = op.Value.(opensearch.RoleMappingPermissions).Users
+				}
+			}
+			assert.Equal(tt, tc.expectOwners, owners, name)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package sync
+
+import "maps"
+
+// ownerMetaKey and ownerMetaValue are the key and value in the _meta field
+// which marks an Opensearch object as owned by the sync. Owned objects which
+// are no longer required are deleted, while objects without the marker are
+// never touched unless they are required.
+const (
+	ownerMetaKey   = "managed_by"
+	ownerMetaValue = "lagoon-opensearch-sync"
+)
+
+// withOwnerMeta returns a copy of the given _meta field with the ownership
+// marker added.
+func withOwnerMeta(meta map[string]any) map[string]any {
+	owned := maps.Clone(meta)
+	if owned == nil {
+		owned = map[string]any{}
+	}
+	owned[ownerMetaKey] = ownerMetaValue
+	return owned
+}
+
+// isOwned returns true if the given _meta field contains the ownership
+// marker.
+func isOwned(meta map[string]any) bool {
+	owner, ok := meta[ownerMetaKey].(string)
+	return ok && owner == ownerMetaValue
+}
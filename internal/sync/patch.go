@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"context"
+	"slices"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
+	"go.uber.org/zap"
+)
+
+// patchBatchSize is the maximum number of operations in a single security API
+// PATCH request. Opensearch reloads the security configuration across the
+// cluster once per request, so large batches keep the number of reloads low
+// while keeping request bodies to a reasonable size.
+const patchBatchSize = 200
+
+// securityObjectWriter writes Opensearch security objects of a single type,
+// such as roles or rolesmapping, using batched PATCH requests.
+type securityObjectWriter struct {
+	// object is the object type used in log messages.
+	object string
+	// patch applies JSON Patch operations to all objects of the type.
+	patch func(context.Context, []jsonpatch.Operation) error
+	// remove deletes a single named object.
+	remove func(context.Context, string) error
+	// create creates or replaces a single named object.
+	create func(context.Context, string) error
+	// value returns the payload used to create the named object.
+	value func(string) any
+}
+
+// write deletes and then creates the named objects in batches of at most
+// patchBatchSize operations. If a batch fails, the objects in that batch are
+// written using individual requests instead, so that a single invalid object
+// doesn't prevent the others from being written.
+func (w *securityObjectWriter) write(
+	ctx context.Context,
+	log *zap.Logger,
+	toDelete,
+	toCreate []string,
+) {
+	ops := make([]jsonpatch.Operation, 0, len(toDelete)+len(toCreate))
+	for _, name := range toDelete {
+		ops = append(ops, jsonpatch.Operation{
+			Op:   "remove",
+			Path: jsonpatch.Pointer(name),
+		})
+	}
+	for _, name := range toCreate {
+		ops = append(ops, jsonpatch.Operation{
+			Op:    "add",
+			Path:  jsonpatch.Pointer(name),
+			Value: w.value(name),
+		})
+	}
+	names := slices.Concat(toDelete, toCreate)
+	for start := 0; start < len(ops); start += patchBatchSize {
+		end := min(start+patchBatchSize, len(ops))
+		err := w.patch(ctx, ops[start:end])
+		if err == nil {
+			for i := start; i < end; i++ {
+				w.logWritten(log, ops[i].Op, names[i])
+			}
+			continue
+		}
+		log.Warn("couldn't patch security objects, "+
+			"falling back to individual requests",
+			zap.String("object", w.object), zap.Error(err))
+		for i := start; i < end; i++ {
+			w.writeOne(ctx, log, ops[i].Op, names[i])
+		}
+	}
+}
+
+// writeOne applies a single operation on the named object using an
+// individual request.
+func (w *securityObjectWriter) writeOne(
+	ctx context.Context,
+	log *zap.Logger,
+	op,
+	name string,
+) {
+	switch op {
+	case "remove":
+		if err := w.remove(ctx, name); err != nil {
+			log.Warn("couldn't delete "+w.object, zap.Error(err))
+			return
+		}
+	default:
+		if err := w.create(ctx, name); err != nil {
+			log.Warn("couldn't create "+w.object, zap.Error(err))
+			return
+		}
+	}
+	w.logWritten(log, op, name)
+}
+
+// logWritten logs a successful operation on the named object.
+func (w *securityObjectWriter) logWritten(log *zap.Logger, op, name string) {
+	if op == "remove" {
+		log.Info("deleted "+w.object, zap.String("name", name))
+		return
+	}
+	log.Info("created "+w.object, zap.String("name", name))
+}
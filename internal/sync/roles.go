@@ -3,9 +3,12 @@ package sync
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
 	"go.uber.org/zap"
 )
@@ -111,6 +114,29 @@ func generateProjectRole(
 	}
 }
 
+// generateIndexPermissions returns the index permissions granting read access
+// to the given index patterns.
+func generateIndexPermissions(
+	indexPatterns []string,
+) []opensearch.IndexPermission {
+	// the Opensearch API is picky about the structure of create group requests,
+	// so ensure that the index_permissions field is only set if there are any
+	// index patterns. Also it cannot be omitted, so can't be nil.
+	if len(indexPatterns) == 0 {
+		return []opensearch.IndexPermission{}
+	}
+	return []opensearch.IndexPermission{
+		{
+			AllowedActions: []string{
+				"read",
+				"indices:monitor/settings/get",
+			},
+			IndexPatterns: indexPatterns,
+			MaskedFields:  []string{},
+		},
+	}
+}
+
 // generateRegularGroupRole constructs an opensearch.Role from the given
 // keycloak group corresponding to a Lagoon group.
 func generateRegularGroupRole(
@@ -126,24 +152,6 @@ func generateRegularGroupRole(
 	}
 	// calculate index patterns from project IDs
 	indexPatterns := generateIndexPermissionPatterns(log, pids, projectNames)
-	// the Opensearch API is picky about the structure of create group requests,
-	// so ensure that the index_permissions field is only set if there are any
-	// index patterns. Also it cannot be omitted, so can't be nil.
-	var indexPermissions []opensearch.IndexPermission
-	if len(indexPatterns) == 0 {
-		indexPermissions = []opensearch.IndexPermission{}
-	} else {
-		indexPermissions = []opensearch.IndexPermission{
-			{
-				AllowedActions: []string{
-					"read",
-					"indices:monitor/settings/get",
-				},
-				IndexPatterns: indexPatterns,
-				MaskedFields:  []string{},
-			},
-		}
-	}
 	return group.Name, &opensearch.Role{
 		RolePermissions: opensearch.RolePermissions{
 			// Allow users to read and download Reports
@@ -154,7 +162,7 @@ func generateRegularGroupRole(
 				"cluster:admin/opendistro/reports/instance/get",
 				"cluster:admin/opendistro/reports/menu/download",
 			},
-			IndexPermissions: indexPermissions,
+			IndexPermissions: generateIndexPermissions(indexPatterns),
 			TenantPermissions: []opensearch.TenantPermission{
 				{
 					AllowedActions: []string{"kibana_all_write"},
@@ -204,8 +212,8 @@ func generateRoles(
 }
 
 // calculateRoleDiff returns a map of opensearch roles which should be created,
-// and a slice of role names which should be deleted, in order to reconcile
-// existing with required.
+// and a sorted slice of role names which should be deleted, in order to
+// reconcile existing with required.
 func calculateRoleDiff(existing, required map[string]opensearch.Role) (
 	map[string]opensearch.Role, []string) {
 	// calculate roles to create
@@ -230,6 +238,7 @@ func calculateRoleDiff(existing, required map[string]opensearch.Role) (
 			}
 		}
 	}
+	slices.Sort(toDelete)
 	return toCreate, toDelete
 }
 
@@ -255,38 +264,55 @@ func syncRoles(
 	projectNames map[int]string,
 	roles map[string]opensearch.Role,
 	groupProjectsMap map[string][]int,
+	organizations []lagoondb.Organization,
+	organizationProjectsMap map[int][]int,
+	developmentOnlyGroups []string,
+	developmentOnlyGroupRoles []string,
+	developmentEnvironments map[int][]string,
+	groupRoles map[string]GroupRolePermissions,
 	o OpensearchService,
 	dryRun bool,
+	diff *DiffWriter,
 ) {
 	// ignore non-lagoon roles
 	existing := filterRoles(roles)
 	// generate the roles required by Lagoon
 	required := generateRoles(log, groups, projectNames, groupProjectsMap)
+	restrictRolesToDevelopment(log, required, groups, projectNames,
+		groupProjectsMap, developmentOnlyGroups, developmentEnvironments)
+	applyGroupRoles(log, required, groups, projectNames, groupProjectsMap,
+		groupRoles, developmentOnlyGroups, developmentOnlyGroupRoles,
+		developmentEnvironments)
+	mergeRequired(log, "role", required, generateOrganizationRoles(log,
+		organizations, projectNames, organizationProjectsMap))
 	// calculate roles to add/remove
 	toCreate, toDelete := calculateRoleDiff(existing, required)
-	var err error
-	for _, name := range toDelete {
-		if dryRun {
+	if dryRun {
+		for _, name := range toDelete {
 			log.Info("dry run mode: not deleting role", zap.String("name", name))
-			continue
-		}
-		err = o.DeleteRole(ctx, name)
-		if err != nil {
-			log.Warn("couldn't delete role", zap.Error(err))
-			continue
+			diff.write(log, "role", "", name, existing[name].RolePermissions, nil)
 		}
-		log.Info("deleted role", zap.String("name", name))
-	}
-	for name, role := range toCreate {
-		if dryRun {
+		for _, name := range slices.Sorted(maps.Keys(toCreate)) {
 			log.Info("dry run mode: not creating role", zap.String("name", name))
-			continue
-		}
-		err = o.CreateRole(ctx, name, &role)
-		if err != nil {
-			log.Warn("couldn't create role", zap.Error(err))
-			continue
+			var eRole any
+			if e, ok := existing[name]; ok {
+				eRole = e.RolePermissions
+			}
+			diff.write(log, "role", "", name, eRole, toCreate[name].RolePermissions)
 		}
-		log.Info("created role", zap.String("name", name))
+		return
+	}
+	w := securityObjectWriter{
+		object: "role",
+		patch:  o.PatchRoles,
+		remove: o.DeleteRole,
+		create: func(ctx context.Context, name string) error {
+			role := toCreate[name]
+			return o.CreateRole(ctx, name, &role)
+		},
+		value: func(name string) any {
+			return toCreate[name].RolePermissions
+		},
 	}
+	w.write(ctx, log, toDelete, slices.Sorted(maps.Keys(toCreate)))
 }
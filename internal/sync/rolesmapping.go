@@ -3,9 +3,12 @@ package sync
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
 	"go.uber.org/zap"
 )
@@ -28,8 +31,8 @@ func rolesMappingEqual(a, b opensearch.RoleMapping) bool {
 }
 
 // calculateRoleMappingDiff returns a map of opensearch rolesmapping which
-// should be created, and a slice of rolemapping names which should be deleted,
-// in order to reconcile existing with required.
+// should be created, and a sorted slice of rolemapping names which should be
+// deleted, in order to reconcile existing with required.
 func calculateRoleMappingDiff(
 	existing, required map[string]opensearch.RoleMapping) (
 	map[string]opensearch.RoleMapping, []string) {
@@ -55,6 +58,7 @@ func calculateRoleMappingDiff(
 			}
 		}
 	}
+	slices.Sort(toDelete)
 	return toCreate, toDelete
 }
 
@@ -128,8 +132,13 @@ func syncRolesMapping(
 	projectNames map[int]string,
 	roles map[string]opensearch.Role,
 	groupProjectsMap map[string][]int,
+	organizations []lagoondb.Organization,
+	organizationMembers map[int]keycloak.OrganizationMembers,
+	developmentOnlyGroups []string,
+	groupRoles map[string]GroupRolePermissions,
 	o OpensearchService,
 	dryRun bool,
+	diff *DiffWriter,
 ) {
 	// get rolesmapping from Opensearch
 	existing, err := o.RolesMapping(ctx)
@@ -141,32 +150,44 @@ func syncRolesMapping(
 	existing = filterRolesMapping(existing, roles)
 	// generate the rolesmapping required by Lagoon
 	required := generateRolesMapping(log, groups, projectNames, groupProjectsMap)
+	restrictRolesMappingToDevelopment(log, required, groups, groupProjectsMap,
+		developmentOnlyGroups)
+	applyGroupRolesMapping(log, required, groups, projectNames,
+		groupProjectsMap, groupRoles)
+	mergeRequired(log, "rolemapping", required,
+		generateOrganizationRolesMapping(organizations, organizationMembers))
 	// calculate rolesmapping to add/remove
 	toCreate, toDelete := calculateRoleMappingDiff(existing, required)
-	for _, name := range toDelete {
-		if dryRun {
+	if dryRun {
+		for _, name := range toDelete {
 			log.Info("dry run mode: not deleting rolemapping",
 				zap.String("name", name))
-			continue
-		}
-		err = o.DeleteRoleMapping(ctx, name)
-		if err != nil {
-			log.Warn("couldn't delete rolemapping", zap.Error(err))
-			continue
+			diff.write(log, "rolemapping", "", name,
+				existing[name].RoleMappingPermissions, nil)
 		}
-		log.Info("deleted rolemapping", zap.String("name", name))
-	}
-	for name, rolemapping := range toCreate {
-		if dryRun {
+		for _, name := range slices.Sorted(maps.Keys(toCreate)) {
 			log.Info("dry run mode: not creating rolemapping",
 				zap.String("name", name))
-			continue
-		}
-		err = o.CreateRoleMapping(ctx, name, &rolemapping)
-		if err != nil {
-			log.Warn("couldn't create rolemapping", zap.Error(err))
-			continue
+			var eRoleMapping any
+			if e, ok := existing[name]; ok {
+				eRoleMapping = e.RoleMappingPermissions
+			}
+			diff.write(log, "rolemapping", "", name, eRoleMapping,
+				toCreate[name].RoleMappingPermissions)
 		}
-		log.Info("created rolemapping", zap.String("name", name))
+		return
+	}
+	w := securityObjectWriter{
+		object: "rolemapping",
+		patch:  o.PatchRolesMapping,
+		remove: o.DeleteRoleMapping,
+		create: func(ctx context.Context, name string) error {
+			rolemapping := toCreate[name]
+			return o.CreateRoleMapping(ctx, name, &rolemapping)
+		},
+		value: func(name string) any {
+			return toCreate[name].RoleMappingPermissions
+		},
 	}
+	w.write(ctx, log, toDelete, slices.Sorted(maps.Keys(toCreate)))
 }
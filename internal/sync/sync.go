@@ -3,10 +3,14 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
@@ -16,12 +20,17 @@ import (
 // KeycloakService defines the Keycloak service interface.
 type KeycloakService interface {
 	Groups(context.Context) ([]keycloak.Group, error)
+	Users(context.Context) ([]keycloak.User, error)
 }
 
 // LagoonDBService defines the Lagoon database service interface.
 type LagoonDBService interface {
 	Projects(context.Context) ([]lagoondb.Project, error)
 	GroupProjectsMap(context.Context) (map[string][]int, error)
+	Organizations(context.Context) ([]lagoondb.Organization, error)
+	OrganizationProjectsMap(context.Context) (map[int][]int, error)
+	Environments(context.Context) ([]lagoondb.Environment, error)
+	ProjectsMetadata(context.Context) (map[int]map[string]string, error)
 }
 
 // OpensearchService defines the Opensearch service interface.
@@ -33,16 +42,37 @@ type OpensearchService interface {
 	Roles(context.Context) (map[string]opensearch.Role, error)
 	CreateRole(context.Context, string, *opensearch.Role) error
 	DeleteRole(context.Context, string) error
+	PatchRoles(context.Context, []jsonpatch.Operation) error
 
 	RolesMapping(context.Context) (map[string]opensearch.RoleMapping, error)
 	CreateRoleMapping(context.Context, string, *opensearch.RoleMapping) error
 	DeleteRoleMapping(context.Context, string) error
+	PatchRolesMapping(context.Context, []jsonpatch.Operation) error
+
+	ComponentTemplates(context.Context) (
+		map[string]opensearch.ComponentTemplate, error)
+	CreateComponentTemplate(context.Context, string,
+		*opensearch.ComponentTemplate) error
+	DeleteComponentTemplate(context.Context, string) error
+
+	IngestPipelines(context.Context) (map[string]opensearch.IngestPipeline, error)
+	CreateIngestPipeline(context.Context, string,
+		*opensearch.IngestPipeline) error
+	DeleteIngestPipeline(context.Context, string) error
 
 	IndexTemplates(context.Context) (map[string]opensearch.IndexTemplate, error)
 	CreateIndexTemplate(context.Context, string, *opensearch.IndexTemplate) error
 	DeleteIndexTemplate(context.Context, string) error
 
 	IndexPatterns(context.Context) (map[string]map[string][]string, error)
+
+	ISMPolicies(context.Context) (map[string]opensearch.ISMPolicy, error)
+	CreateISMPolicy(context.Context, *opensearch.ISMPolicy) error
+	UpdateISMPolicy(context.Context, *opensearch.ISMPolicy) error
+	DeleteISMPolicy(context.Context, string) error
+	ISMManagedIndices(context.Context, []string) (map[string]string, error)
+	ChangeISMPolicy(context.Context, []string, string) error
+	RemoveISMPolicy(context.Context, []string) error
 }
 
 // DashboardsService defines the Opensearch Dashboards service interface.
@@ -51,36 +81,136 @@ type DashboardsService interface {
 	CreateIndexPattern(context.Context, string, string) error
 }
 
-// Sync will read the Lagoon state from the LagoonDBService and KeycloakService,
-// and then configure the OpensearchService as required.
-func Sync(ctx context.Context, log *zap.Logger, l LagoonDBService,
-	k KeycloakService, o OpensearchService, d DashboardsService, dryRun bool,
-	objects []string, legacyIndexPatternDelimiter bool) error {
-	// get projects from Lagoon
-	projects, err := l.Projects(ctx)
-	if err != nil {
-		return fmt.Errorf("couldn't get projects: %v", err)
-	}
-	// get group project membership map from Lagoon
-	groupProjectsMap, err := l.GroupProjectsMap(ctx)
-	if err != nil {
-		return fmt.Errorf("couldn't get group projects map: %v", err)
-	}
-	// https://github.com/uselagoon/lagoon/blob/
-	// 	7dd4eb3b695bd507f25de5d7ea49d6601a229b87/services/api/src/resources/
-	// 	group/opendistroSecurity.ts#L31-L34
-	lagoonName := regexp.MustCompile(`[^0-9a-z-]`)
-	// generate project ID -> name map
+// lagoonName matches characters which Lagoon replaces in project names when
+// generating index patterns.
+//
+//	https://github.com/uselagoon/lagoon/blob/
+//	7dd4eb3b695bd507f25de5d7ea49d6601a229b87/services/api/src/resources/
+//	group/opendistroSecurity.ts#L31-L34
+var lagoonName = regexp.MustCompile(`[^0-9a-z-]`)
+
+// ProjectNames returns a map of project ID to project name, where the project
+// name is munged in a Lagoon-compatible manner for use in index patterns.
+func ProjectNames(projects []lagoondb.Project) map[int]string {
 	projectNames := map[int]string{}
 	for _, project := range projects {
-		// munge the project name in a Lagoon-compatible manner
 		projectNames[project.ID] =
 			lagoonName.ReplaceAllLiteralString(strings.ToLower(project.Name), `-`)
 	}
-	// get groups from Keycloak
+	return projectNames
+}
+
+// Target is an Opensearch cluster, and its associated Opensearch Dashboards,
+// which is synchronised with Lagoon.
+type Target struct {
+	// Name identifies the cluster in logs, metrics, and dry run diffs. It is
+	// empty if the target is the only cluster, in which case the cluster is
+	// not identified.
+	Name       string
+	Opensearch OpensearchService
+	Dashboards DashboardsService
+	// Objects is the list of Opensearch object types which are synchronised.
+	Objects                     []string
+	LegacyIndexPatternDelimiter bool
+	// Organizations enables the tenants, roles, rolesmapping, and index
+	// patterns of Lagoon organizations.
+	Organizations bool
+	// DevelopmentOnlyGroups is a list of Lagoon group names whose roles only
+	// grant access to the logs of development environments.
+	DevelopmentOnlyGroups []string
+	// DevelopmentOnlyGroupRoles is a list of Lagoon group roles whose roles
+	// only grant access to the logs of development environments. If it is not
+	// empty and GroupRoles is empty, every member of a Lagoon group with any
+	// other group role is granted the same access as the role named after the
+	// group.
+	DevelopmentOnlyGroupRoles []string
+	// GroupRoles maps Lagoon group roles to the permissions granted to the
+	// members of each Lagoon group with that role. If it is not empty, each
+	// Lagoon group is given a role for each group role instead of a single
+	// role.
+	GroupRoles map[string]GroupRolePermissions
+	// BuiltinIndexTemplates configures the built-in index templates.
+	BuiltinIndexTemplates BuiltinIndexTemplates
+	// IndexTemplates are Lagoon-owned index templates which are required in
+	// addition to the built-in index templates, keyed by name.
+	IndexTemplates map[string]opensearch.IndexTemplate
+	// IngestPipelines are Lagoon-owned ingest pipelines which are required in
+	// addition to the built-in ingest pipelines, keyed by ID.
+	IngestPipelines map[string]opensearch.IngestPipeline
+	// ISMRetention configures the Lagoon-owned ISM policies which delete old
+	// Lagoon logs.
+	ISMRetention ISMRetention
+}
+
+// needsEnvironments returns true if the Target generates any roles which are
+// restricted to the logs of development environments.
+func (t *Target) needsEnvironments() bool {
+	if len(t.DevelopmentOnlyGroups) > 0 || len(t.DevelopmentOnlyGroupRoles) > 0 {
+		return true
+	}
+	for _, permissions := range t.GroupRoles {
+		if !permissions.Production {
+			return true
+		}
+	}
+	return false
+}
+
+// groupRoles returns the permission sets of the Lagoon group roles of the
+// Target.
+func (t *Target) groupRoles() map[string]GroupRolePermissions {
+	if len(t.GroupRoles) == 0 && len(t.DevelopmentOnlyGroupRoles) > 0 {
+		return defaultGroupRoles()
+	}
+	return t.GroupRoles
+}
+
+// needsProjectsMetadata returns true if the Target generates any ISM policies
+// from Lagoon project metadata.
+func (t *Target) needsProjectsMetadata() bool {
+	return t.ISMRetention.ProjectMetadataKey != "" &&
+		slices.Contains(t.Objects, "ismpolicies")
+}
+
+// lagoonState is the state read from Lagoon and Keycloak which is
+// synchronised to each Target.
+type lagoonState struct {
+	projectNames     map[int]string
+	groupProjectsMap map[string][]int
+	groups           []keycloak.Group
+	groupsSansGlobal []keycloak.Group
+	// organizations are only read if required by a Target.
+	organizations           []lagoondb.Organization
+	organizationProjectsMap map[int][]int
+	organizationMembers     map[int]keycloak.OrganizationMembers
+	// developmentEnvironments are only read if required by a Target.
+	developmentEnvironments map[int][]string
+	// projectsMetadata is only read if required by a Target.
+	projectsMetadata map[int]map[string]string
+}
+
+// getLagoonState reads the Lagoon state from the LagoonDBService and
+// KeycloakService. Lagoon organizations and their members are only read if
+// organizations is true, environments are only read if environments is true,
+// and project metadata is only read if projectsMetadata is true.
+func getLagoonState(ctx context.Context, log *zap.Logger, l LagoonDBService,
+	k KeycloakService, organizations, environments,
+	projectsMetadata bool) (*lagoonState, error) {
+	// get projects from Lagoon
+	projects, err := l.Projects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get projects: %v", err)
+	}
+	// get groups from Keycloak. These are read before group project membership,
+	// which may be derived from them.
 	groups, err := k.Groups(ctx)
 	if err != nil {
-		return fmt.Errorf("couldn't get groups: %v", err)
+		return nil, fmt.Errorf("couldn't get groups: %v", err)
+	}
+	// get group project membership map from Lagoon
+	groupProjectsMap, err := l.GroupProjectsMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get group projects map: %v", err)
 	}
 	// Work around security-dashboards-plugin bug by ignoring "global" group when
 	// creating tenants and index patterns:
@@ -98,6 +228,81 @@ func Sync(ctx context.Context, log *zap.Logger, l LagoonDBService,
 		}
 		groupsSansGlobal = append(groupsSansGlobal, groups[i])
 	}
+	state := lagoonState{
+		// generate project ID -> name map
+		projectNames:     ProjectNames(projects),
+		groupProjectsMap: groupProjectsMap,
+		groups:           groups,
+		groupsSansGlobal: groupsSansGlobal,
+	}
+	if organizations {
+		// get organizations and their projects from Lagoon
+		state.organizations, err = l.Organizations(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get organizations: %v", err)
+		}
+		state.organizationProjectsMap, err = l.OrganizationProjectsMap(ctx)
+		if err != nil {
+			return nil,
+				fmt.Errorf("couldn't get organization projects map: %v", err)
+		}
+		// get organization owners and viewers from Keycloak
+		users, err := k.Users(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get users: %v", err)
+		}
+		state.organizationMembers = keycloak.OrganizationMembersMap(log, users)
+	}
+	if environments {
+		// get environments from Lagoon
+		envs, err := l.Environments(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get environments: %v", err)
+		}
+		state.developmentEnvironments = developmentEnvironmentNames(envs)
+	}
+	if projectsMetadata {
+		// get project metadata from Lagoon
+		state.projectsMetadata, err = l.ProjectsMetadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get projects metadata: %v", err)
+		}
+	}
+	return &state, nil
+}
+
+// indexTemplateDependencies are the objects which are referred to by index
+// templates, and so must be synchronised before them.
+var indexTemplateDependencies = []string{"componenttemplates", "ingestpipelines"}
+
+// syncOrder returns the given objects in the order in which they are
+// synchronised: the given order, except that any dependencies of index
+// templates are moved before the index templates.
+func syncOrder(objects []string) []string {
+	i := slices.Index(objects, "indextemplates")
+	if i < 0 {
+		return objects
+	}
+	var deps, rest []string
+	for j, object := range objects {
+		if j > i && slices.Contains(indexTemplateDependencies, object) {
+			deps = append(deps, object)
+			continue
+		}
+		rest = append(rest, object)
+	}
+	return slices.Insert(rest, i, deps...)
+}
+
+// syncTarget configures the given Target as required by the given Lagoon
+// state.
+func syncTarget(ctx context.Context, log *zap.Logger, state *lagoonState,
+	t *Target, dryRun bool, diff *DiffWriter) error {
+	o, d := t.Opensearch, t.Dashboards
+	var organizations []lagoondb.Organization
+	if t.Organizations {
+		organizations = state.organizations
+	}
 	// Get roles from Opensearch. Getting this data here is an optimisation
 	// because both syncRoles and syncRolesMapping use this data and this way we
 	// only need to request it from Opensearch once.
@@ -105,7 +310,12 @@ func Sync(ctx context.Context, log *zap.Logger, l LagoonDBService,
 	if err != nil {
 		return fmt.Errorf("couldn't get roles: %v", err)
 	}
-	for _, object := range objects {
+	componentTemplates := slices.Contains(t.Objects, "componenttemplates")
+	// readyPipelines are the IDs of the ingest pipelines which index templates
+	// may use as their default pipeline. It is only set if ingest pipelines are
+	// synchronised, which syncOrder ensures happens before index templates.
+	var readyPipelines map[string]bool
+	for _, object := range syncOrder(t.Objects) {
 		select {
 		case <-ctx.Done():
 			log.Debug("exiting sync loop early due to context cancellation")
@@ -113,16 +323,35 @@ func Sync(ctx context.Context, log *zap.Logger, l LagoonDBService,
 		default:
 			switch object {
 			case "tenants":
-				syncTenants(ctx, log, groupsSansGlobal, groupProjectsMap, o, dryRun)
+				syncTenants(ctx, log, state.groupsSansGlobal, state.groupProjectsMap,
+					organizations, o, dryRun, diff)
 			case "roles":
-				syncRoles(ctx, log, groups, projectNames, roles, groupProjectsMap, o, dryRun)
+				syncRoles(ctx, log, state.groups, state.projectNames, roles,
+					state.groupProjectsMap, organizations,
+					state.organizationProjectsMap, t.DevelopmentOnlyGroups,
+					t.DevelopmentOnlyGroupRoles, state.developmentEnvironments,
+					t.groupRoles(), o, dryRun, diff)
 			case "rolesmapping":
-				syncRolesMapping(ctx, log, groups, projectNames, roles, groupProjectsMap, o, dryRun)
+				syncRolesMapping(ctx, log, state.groups, state.projectNames, roles,
+					state.groupProjectsMap, organizations, state.organizationMembers,
+					t.DevelopmentOnlyGroups, t.groupRoles(), o, dryRun, diff)
 			case "indexpatterns":
-				syncIndexPatterns(ctx, log, groupsSansGlobal, projectNames, groupProjectsMap,
-					o, d, dryRun, legacyIndexPatternDelimiter)
+				syncIndexPatterns(ctx, log, state.groupsSansGlobal, state.projectNames,
+					state.groupProjectsMap, organizations,
+					state.organizationProjectsMap, o, d, dryRun,
+					t.LegacyIndexPatternDelimiter, diff)
+			case "componenttemplates":
+				syncComponentTemplates(ctx, log, o, dryRun, diff)
+			case "ingestpipelines":
+				readyPipelines = syncIngestPipelines(ctx, log, t.IngestPipelines, o,
+					dryRun, diff)
 			case "indextemplates":
-				syncIndexTemplates(ctx, log, o, dryRun)
+				syncIndexTemplates(ctx, log, t.BuiltinIndexTemplates,
+					t.IndexTemplates, componentTemplates, readyPipelines, o, dryRun,
+					diff)
+			case "ismpolicies":
+				syncISMPolicies(ctx, log, t.ISMRetention, state.projectNames,
+					state.projectsMetadata, o, dryRun, diff)
 			default:
 				log.Warn("sync object not implemented", zap.String("object", object))
 			}
@@ -130,3 +359,59 @@ func Sync(ctx context.Context, log *zap.Logger, l LagoonDBService,
 	}
 	return nil
 }
+
+// Sync will read the Lagoon state from the LagoonDBService and
+// KeycloakService once, and then configure each of the targets as required.
+//
+// Failures are isolated to each target: an error synchronising one target is
+// logged, and does not prevent the other targets from being synchronised. An
+// error is returned if the Lagoon state can't be read, or if every target
+// fails.
+//
+// If dryRun is true and diff is not nil, the changes which would be made to
+// each Opensearch object are written to diff.
+func Sync(ctx context.Context, log *zap.Logger, l LagoonDBService,
+	k KeycloakService, targets []Target, dryRun bool, diff *DiffWriter) error {
+	var organizations, environments, projectsMetadata bool
+	for i := range targets {
+		organizations = organizations || targets[i].Organizations
+		environments = environments || targets[i].needsEnvironments()
+		projectsMetadata = projectsMetadata || targets[i].needsProjectsMetadata()
+	}
+	state, err := getLagoonState(ctx, log, l, k, organizations, environments,
+		projectsMetadata)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range targets {
+		t := &targets[i]
+		tLog := log
+		if t.Name != "" {
+			tLog = log.With(zap.String("cluster", t.Name))
+		}
+		tLog.Debug("starting cluster sync")
+		start := time.Now()
+		// instrument the target services so that write operations are counted
+		instrumented := *t
+		instrumented.Opensearch = &instrumentedOpensearch{t.Opensearch, t.Name}
+		instrumented.Dashboards = &instrumentedDashboards{t.Dashboards, t.Name}
+		err = syncTarget(ctx, tLog, state, &instrumented, dryRun,
+			diff.withCluster(t.Name))
+		observeSync(t.Name, start, err)
+		if err != nil {
+			tLog.Error("couldn't sync cluster", zap.Error(err))
+			if t.Name != "" {
+				err = fmt.Errorf("cluster %s: %v", t.Name, err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		tLog.Debug("cluster sync completed",
+			zap.Duration("duration", time.Since(start)))
+	}
+	if len(targets) > 0 && len(errs) == len(targets) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
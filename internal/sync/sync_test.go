@@ -0,0 +1,1160 @@
+package sync_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/jsonpatch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/sync"
+	"go.uber.org/zap"
+)
+
+// fakeLagoonDB implements sync.LagoonDBService.
+type fakeLagoonDB struct {
+	projects                []lagoondb.Project
+	groupProjectsMap        map[string][]int
+	organizations           []lagoondb.Organization
+	organizationProjectsMap map[int][]int
+	environments            []lagoondb.Environment
+	projectsMetadata        map[int]map[string]string
+}
+
+func (f *fakeLagoonDB) Projects(context.Context) ([]lagoondb.Project, error) {
+	return f.projects, nil
+}
+
+func (f *fakeLagoonDB) GroupProjectsMap(
+	context.Context) (map[string][]int, error) {
+	return f.groupProjectsMap, nil
+}
+
+func (f *fakeLagoonDB) Organizations(
+	context.Context) ([]lagoondb.Organization, error) {
+	return f.organizations, nil
+}
+
+func (f *fakeLagoonDB) OrganizationProjectsMap(
+	context.Context) (map[int][]int, error) {
+	return f.organizationProjectsMap, nil
+}
+
+func (f *fakeLagoonDB) Environments(
+	context.Context) ([]lagoondb.Environment, error) {
+	return f.environments, nil
+}
+
+func (f *fakeLagoonDB) ProjectsMetadata(
+	context.Context) (map[int]map[string]string, error) {
+	return f.projectsMetadata, nil
+}
+
+// allBuiltinIndexTemplates enables every built-in index template.
+var allBuiltinIndexTemplates = sync.BuiltinIndexTemplates{
+	Names: []string{"applicationlogs", "containerlogs", "lagoonlogs",
+		"routerlogs"},
+	Priority: 50,
+}
+
+// fakeKeycloak implements sync.KeycloakService.
+type fakeKeycloak struct {
+	groups []keycloak.Group
+	users  []keycloak.User
+	calls  int
+}
+
+func (f *fakeKeycloak) Groups(context.Context) ([]keycloak.Group, error) {
+	f.calls++
+	return f.groups, nil
+}
+
+func (f *fakeKeycloak) Users(context.Context) ([]keycloak.User, error) {
+	return f.users, nil
+}
+
+// fakeOpensearch implements sync.OpensearchService and
+// sync.DashboardsService, and records the write API calls made to it.
+type fakeOpensearch struct {
+	calls          []string
+	rolesErr       error
+	patchErr       error
+	tenants        map[string]opensearch.Tenant
+	roles          map[string]opensearch.Role
+	rolesmapping   map[string]opensearch.RoleMapping
+	indexTemplates map[string]opensearch.IndexTemplate
+	indexPatterns  map[string]map[string][]string
+
+	componentTemplates map[string]opensearch.ComponentTemplate
+	ismPolicies        map[string]opensearch.ISMPolicy
+	ingestPipelines    map[string]opensearch.IngestPipeline
+	// ismManagedIndices maps index names to the ID of their ISM policy
+	ismManagedIndices map[string]string
+	changePolicyErr   error
+	createPipelineErr error
+	// createdIndexTemplates are the index templates passed to
+	// CreateIndexTemplate, keyed by name
+	createdIndexTemplates map[string]opensearch.IndexTemplate
+	// rolesMappingOps are the operations passed to PatchRolesMapping
+	rolesMappingOps []jsonpatch.Operation
+}
+
+func (f *fakeOpensearch) record(format string, a ...any) error {
+	f.calls = append(f.calls, fmt.Sprintf(format, a...))
+	return nil
+}
+
+func (f *fakeOpensearch) Tenants(
+	context.Context) (map[string]opensearch.Tenant, error) {
+	return f.tenants, nil
+}
+
+func (f *fakeOpensearch) CreateTenant(
+	_ context.Context, name string, _ *opensearch.Tenant) error {
+	return f.record("CreateTenant %s", name)
+}
+
+func (f *fakeOpensearch) DeleteTenant(_ context.Context, name string) error {
+	return f.record("DeleteTenant %s", name)
+}
+
+func (f *fakeOpensearch) Roles(
+	context.Context) (map[string]opensearch.Role, error) {
+	if f.rolesErr != nil {
+		return nil, f.rolesErr
+	}
+	return f.roles, nil
+}
+
+func (f *fakeOpensearch) CreateRole(
+	_ context.Context, name string, _ *opensearch.Role) error {
+	return f.record("CreateRole %s", name)
+}
+
+func (f *fakeOpensearch) DeleteRole(_ context.Context, name string) error {
+	return f.record("DeleteRole %s", name)
+}
+
+// recordPatch records a PATCH call, and returns patchErr if it is set.
+func (f *fakeOpensearch) recordPatch(
+	method string, ops []jsonpatch.Operation) error {
+	if f.patchErr != nil {
+		return f.patchErr
+	}
+	var paths []string
+	for _, op := range ops {
+		paths = append(paths, op.Op+" "+op.Path)
+	}
+	return f.record("%s %s", method, strings.Join(paths, ", "))
+}
+
+func (f *fakeOpensearch) PatchRoles(
+	_ context.Context, ops []jsonpatch.Operation) error {
+	return f.recordPatch("PatchRoles", ops)
+}
+
+func (f *fakeOpensearch) RolesMapping(
+	context.Context) (map[string]opensearch.RoleMapping, error) {
+	return f.rolesmapping, nil
+}
+
+func (f *fakeOpensearch) CreateRoleMapping(
+	_ context.Context, name string, _ *opensearch.RoleMapping) error {
+	return f.record("CreateRoleMapping %s", name)
+}
+
+func (f *fakeOpensearch) DeleteRoleMapping(
+	_ context.Context, name string) error {
+	return f.record("DeleteRoleMapping %s", name)
+}
+
+func (f *fakeOpensearch) PatchRolesMapping(
+	_ context.Context, ops []jsonpatch.Operation) error {
+	f.rolesMappingOps = append(f.rolesMappingOps, ops...)
+	return f.recordPatch("PatchRolesMapping", ops)
+}
+
+func (f *fakeOpensearch) ComponentTemplates(
+	context.Context) (map[string]opensearch.ComponentTemplate, error) {
+	return f.componentTemplates, nil
+}
+
+func (f *fakeOpensearch) CreateComponentTemplate(
+	_ context.Context, name string, _ *opensearch.ComponentTemplate) error {
+	return f.record("CreateComponentTemplate %s", name)
+}
+
+func (f *fakeOpensearch) DeleteComponentTemplate(
+	_ context.Context, name string) error {
+	return f.record("DeleteComponentTemplate %s", name)
+}
+
+func (f *fakeOpensearch) IngestPipelines(
+	context.Context) (map[string]opensearch.IngestPipeline, error) {
+	return f.ingestPipelines, nil
+}
+
+func (f *fakeOpensearch) CreateIngestPipeline(
+	_ context.Context, id string, _ *opensearch.IngestPipeline) error {
+	if f.createPipelineErr != nil {
+		return f.createPipelineErr
+	}
+	return f.record("CreateIngestPipeline %s", id)
+}
+
+func (f *fakeOpensearch) DeleteIngestPipeline(
+	_ context.Context, id string) error {
+	return f.record("DeleteIngestPipeline %s", id)
+}
+
+func (f *fakeOpensearch) ISMPolicies(
+	context.Context) (map[string]opensearch.ISMPolicy, error) {
+	return f.ismPolicies, nil
+}
+
+func (f *fakeOpensearch) CreateISMPolicy(
+	_ context.Context, p *opensearch.ISMPolicy) error {
+	return f.record("CreateISMPolicy %s", p.ID)
+}
+
+func (f *fakeOpensearch) UpdateISMPolicy(
+	_ context.Context, p *opensearch.ISMPolicy) error {
+	return f.record("UpdateISMPolicy %s %d/%d", p.ID, p.SeqNo, p.PrimaryTerm)
+}
+
+func (f *fakeOpensearch) DeleteISMPolicy(_ context.Context, id string) error {
+	return f.record("DeleteISMPolicy %s", id)
+}
+
+func (f *fakeOpensearch) ISMManagedIndices(
+	_ context.Context, indexPatterns []string) (map[string]string, error) {
+	managed := map[string]string{}
+	for index, id := range f.ismManagedIndices {
+		for _, pattern := range indexPatterns {
+			if ok, _ := path.Match(pattern, index); ok {
+				managed[index] = id
+			}
+		}
+	}
+	return managed, nil
+}
+
+func (f *fakeOpensearch) ChangeISMPolicy(
+	_ context.Context, indices []string, policyID string) error {
+	if f.changePolicyErr != nil {
+		return f.changePolicyErr
+	}
+	return f.record("ChangeISMPolicy %s %s", policyID,
+		strings.Join(indices, ","))
+}
+
+func (f *fakeOpensearch) RemoveISMPolicy(
+	_ context.Context, indices []string) error {
+	return f.record("RemoveISMPolicy %s", strings.Join(indices, ","))
+}
+
+func (f *fakeOpensearch) IndexTemplates(
+	context.Context) (map[string]opensearch.IndexTemplate, error) {
+	return f.indexTemplates, nil
+}
+
+func (f *fakeOpensearch) CreateIndexTemplate(
+	_ context.Context, name string, it *opensearch.IndexTemplate) error {
+	if f.createdIndexTemplates == nil {
+		f.createdIndexTemplates = map[string]opensearch.IndexTemplate{}
+	}
+	f.createdIndexTemplates[name] = *it
+	return f.record("CreateIndexTemplate %s", name)
+}
+
+func (f *fakeOpensearch) DeleteIndexTemplate(
+	_ context.Context, name string) error {
+	return f.record("DeleteIndexTemplate %s", name)
+}
+
+func (f *fakeOpensearch) IndexPatterns(
+	context.Context) (map[string]map[string][]string, error) {
+	return f.indexPatterns, nil
+}
+
+func (f *fakeOpensearch) CreateIndexPattern(
+	_ context.Context, tenant, pattern string) error {
+	return f.record("CreateIndexPattern %s %s", tenant, pattern)
+}
+
+func (f *fakeOpensearch) DeleteIndexPattern(
+	_ context.Context, tenant, patternID string) error {
+	return f.record("DeleteIndexPattern %s %s", tenant, patternID)
+}
+
+// newFakeOpensearch returns a fakeOpensearch containing a number of stale
+// Lagoon objects, so that a sync both creates and deletes objects.
+func newFakeOpensearch() *fakeOpensearch {
+	return &fakeOpensearch{
+		tenants: map[string]opensearch.Tenant{
+			"global_tenant": {Reserved: true},
+			"stale-b":       {},
+			"stale-a":       {},
+		},
+		roles: map[string]opensearch.Role{
+			"all_access": {Reserved: true},
+			"p99":        {},
+			"p98":        {},
+			"stale-a":    {},
+		},
+		rolesmapping: map[string]opensearch.RoleMapping{
+			"all_access": {},
+			"p99":        {},
+			"stale-a":    {},
+		},
+		indexTemplates: map[string]opensearch.IndexTemplate{},
+		indexPatterns: map[string]map[string][]string{
+			sync.HashPrefix("group-b"): {
+				"stale-pattern-b": {"id-b"},
+				"stale-pattern-a": {"id-a"},
+			},
+			sync.HashPrefix("group-a"): {
+				"stale-pattern-c": {"id-c"},
+			},
+		},
+	}
+}
+
+func TestSyncDeterministic(t *testing.T) {
+	l := &fakeLagoonDB{
+		projects: []lagoondb.Project{
+			{ID: 3, Name: "project-c"},
+			{ID: 1, Name: "project-a"},
+			{ID: 2, Name: "project-b"},
+		},
+		groupProjectsMap: map[string][]int{
+			"id-group-b": {2, 1},
+			"id-group-a": {3},
+		},
+	}
+	k := &fakeKeycloak{
+		groups: []keycloak.Group{
+			{
+				ID: "id-group-b",
+				GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+					Name: "group-b",
+				},
+			},
+			{
+				ID: "id-group-a",
+				GroupUpdateRepresentation: keycloak.GroupUpdateRepresentation{
+					Name: "group-a",
+				},
+			},
+		},
+	}
+	objects := []string{
+		"tenants",
+		"roles",
+		"rolesmapping",
+		"indexpatterns",
+		"indextemplates",
+	}
+	expectCalls := []string{
+		"DeleteTenant stale-a",
+		"DeleteTenant stale-b",
+		"CreateTenant group-a",
+		"CreateTenant group-b",
+		"PatchRoles remove /p98, remove /p99, remove /stale-a, " +
+			"add /group-a, add /group-b, add /p1, add /p2, add /p3",
+		"PatchRolesMapping remove /p99, remove /stale-a, " +
+			"add /group-a, add /group-b, add /p1, add /p2, add /p3",
+		"DeleteIndexPattern group-a id-c",
+		"DeleteIndexPattern group-b id-a",
+		"DeleteIndexPattern group-b id-b",
+		"CreateIndexPattern admin_tenant application-logs-*",
+		"CreateIndexPattern admin_tenant container-logs-*",
+		"CreateIndexPattern admin_tenant lagoon-logs-*",
+		"CreateIndexPattern admin_tenant router-logs-*",
+		"CreateIndexPattern global_tenant application-logs-*",
+		"CreateIndexPattern global_tenant container-logs-*",
+		"CreateIndexPattern global_tenant lagoon-logs-*",
+		"CreateIndexPattern global_tenant router-logs-*",
+		"CreateIndexPattern group-a application-logs-*",
+		"CreateIndexPattern group-a application-logs-project-c-_-*",
+		"CreateIndexPattern group-a container-logs-*",
+		"CreateIndexPattern group-a container-logs-project-c-_-*",
+		"CreateIndexPattern group-a lagoon-logs-*",
+		"CreateIndexPattern group-a lagoon-logs-project-c-_-*",
+		"CreateIndexPattern group-a router-logs-*",
+		"CreateIndexPattern group-a router-logs-project-c-_-*",
+		"CreateIndexPattern group-b application-logs-*",
+		"CreateIndexPattern group-b application-logs-project-a-_-*",
+		"CreateIndexPattern group-b application-logs-project-b-_-*",
+		"CreateIndexPattern group-b container-logs-*",
+		"CreateIndexPattern group-b container-logs-project-a-_-*",
+		"CreateIndexPattern group-b container-logs-project-b-_-*",
+		"CreateIndexPattern group-b lagoon-logs-*",
+		"CreateIndexPattern group-b lagoon-logs-project-a-_-*",
+		"CreateIndexPattern group-b lagoon-logs-project-b-_-*",
+		"CreateIndexPattern group-b router-logs-*",
+		"CreateIndexPattern group-b router-logs-project-a-_-*",
+		"CreateIndexPattern group-b router-logs-project-b-_-*",
+		"CreateIndexTemplate applicationlogs",
+		"CreateIndexTemplate containerlogs",
+		"CreateIndexTemplate lagoonlogs",
+		"CreateIndexTemplate routerlogs",
+	}
+	log := zap.NewNop()
+	// run the sync several times to expose any map iteration order dependence
+	for i := range 10 {
+		t.Run(fmt.Sprintf("run %d", i), func(tt *testing.T) {
+			o := newFakeOpensearch()
+			err := sync.Sync(context.Background(), log, l, k, []sync.Target{{
+				Name:                  "default",
+				Opensearch:            o,
+				Dashboards:            o,
+				Objects:               objects,
+				BuiltinIndexTemplates: allBuiltinIndexTemplates,
+			}}, false, nil)
+			assert.NoError(tt, err, "sync")
+			assert.Equal(tt, expectCalls, o.calls, "calls")
+		})
+	}
+}
+
+func TestSyncDryRunDiffDeterministic(t *testing.T) {
+	l := &fakeLagoonDB{
+		projects: []lagoondb.Project{
+			{ID: 2, Name: "project-b"},
+			{ID: 1, Name: "project-a"},
+		},
+		groupProjectsMap: map[string][]int{},
+	}
+	k := &fakeKeycloak{}
+	objects := []string{"tenants", "roles", "rolesmapping"}
+	log := zap.NewNop()
+	var first string
+	for i := range 10 {
+		var buf bytes.Buffer
+		diff, err := sync.NewDiffWriter(&buf, sync.DiffFormatJSONPatch)
+		assert.NoError(t, err, "diff writer")
+		o := newFakeOpensearch()
+		err = sync.Sync(context.Background(), log, l, k, []sync.Target{{
+			Name:       "default",
+			Opensearch: o,
+			Dashboards: o,
+			Objects:    objects,
+		}}, true, diff)
+		assert.NoError(t, err, "sync")
+		assert.Equal(t, 0, len(o.calls), "dry run calls")
+		if i == 0 {
+			first = buf.String()
+			continue
+		}
+		assert.Equal(t, first, buf.String(), "dry run diff")
+	}
+}
+
+func TestSyncIndexTemplatesDryRunDiff(t *testing.T) {
+	l := &fakeLagoonDB{groupProjectsMap: map[string][]int{}}
+	o := newFakeOpensearch()
+	o.indexTemplates = map[string]opensearch.IndexTemplate{
+		"routerlogs": {
+			Name: "routerlogs",
+			IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
+				IndexPatterns: []string{"router-logs-*"},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	diff, err := sync.NewDiffWriter(&buf, sync.DiffFormatJSONPatch)
+	assert.NoError(t, err, "diff writer")
+	err = sync.Sync(context.Background(), zap.NewNop(), l, &fakeKeycloak{},
+		[]sync.Target{{
+			Name:                  "default",
+			Opensearch:            o,
+			Dashboards:            o,
+			Objects:               []string{"indextemplates"},
+			BuiltinIndexTemplates: allBuiltinIndexTemplates,
+		}}, true, diff)
+	assert.NoError(t, err, "sync")
+	var records []string
+	for line := range strings.Lines(buf.String()) {
+		if strings.Contains(line, `"name":"routerlogs"`) {
+			records = append(records, line)
+		}
+	}
+	// the update is a single patch of the existing template, rather than a
+	// removal of the whole template followed by a patch
+	assert.Equal(t, 1, len(records), "routerlogs diff records")
+	assert.NotContains(t, records[0], `{"op":"remove","path":""}`, "update diff")
+}
+
+func TestSyncUnnamedTargetDiff(t *testing.T) {
+	l := &fakeLagoonDB{
+		projects:         []lagoondb.Project{{ID: 1, Name: "project-a"}},
+		groupProjectsMap: map[string][]int{},
+	}
+	var testCases = map[string]struct {
+		name   string
+		expect bool
+	}{
+		"unnamed target": {},
+		"named target":   {name: "cluster-a", expect: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			var buf bytes.Buffer
+			diff, err := sync.NewDiffWriter(&buf, sync.DiffFormatJSONPatch)
+			assert.NoError(tt, err, name)
+			o := newFakeOpensearch()
+			err = sync.Sync(context.Background(), zap.NewNop(), l, &fakeKeycloak{},
+				[]sync.Target{{
+					Name:       tc.name,
+					Opensearch: o,
+					Dashboards: o,
+					Objects:    []string{"tenants"},
+				}}, true, diff)
+			assert.NoError(tt, err, name)
+			assert.NotEqual(tt, "", buf.String(), name)
+			assert.Equal(tt, tc.expect, strings.Contains(buf.String(), `"cluster"`),
+				name)
+		})
+	}
+}
+
+func TestSyncMultipleTargets(t *testing.T) {
+	l := &fakeLagoonDB{
+		projects:         []lagoondb.Project{{ID: 1, Name: "project-a"}},
+		groupProjectsMap: map[string][]int{},
+	}
+	var testCases = map[string]struct {
+		failA     bool
+		failB     bool
+		expectErr bool
+	}{
+		"no failures":      {},
+		"one failure":      {failA: true},
+		"all targets fail": {failA: true, failB: true, expectErr: true},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			k := &fakeKeycloak{}
+			a, b := newFakeOpensearch(), newFakeOpensearch()
+			if tc.failA {
+				a.rolesErr = fmt.Errorf("unavailable")
+			}
+			if tc.failB {
+				b.rolesErr = fmt.Errorf("unavailable")
+			}
+			err := sync.Sync(context.Background(), log, l, k, []sync.Target{
+				{Name: "a", Opensearch: a, Dashboards: a, Objects: []string{"roles"}},
+				{Name: "b", Opensearch: b, Dashboards: b, Objects: []string{"roles"}},
+			}, false, nil)
+			if tc.expectErr {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+			assert.Equal(tt, 1, k.calls, "keycloak calls")
+			if tc.failA {
+				assert.Equal(tt, 0, len(a.calls), "target a calls")
+			} else {
+				assert.NotZero(tt, len(a.calls), "target a calls")
+			}
+			if tc.failB {
+				assert.Equal(tt, 0, len(b.calls), "target b calls")
+			} else {
+				assert.NotZero(tt, len(b.calls), "target b calls")
+			}
+		})
+	}
+}
+
+func TestSyncPatchFallback(t *testing.T) {
+	l := &fakeLagoonDB{
+		projects:         []lagoondb.Project{{ID: 1, Name: "project-a"}},
+		groupProjectsMap: map[string][]int{},
+	}
+	k := &fakeKeycloak{}
+	var testCases = map[string]struct {
+		patchErr    error
+		expectCalls []string
+	}{
+		"patch": {
+			expectCalls: []string{
+				"PatchRoles remove /p98, remove /p99, remove /stale-a, add /p1",
+				"PatchRolesMapping remove /p99, remove /stale-a, add /p1",
+			},
+		},
+		"fallback to individual requests": {
+			patchErr: fmt.Errorf("bad patch roles response: 400"),
+			expectCalls: []string{
+				"DeleteRole p98",
+				"DeleteRole p99",
+				"DeleteRole stale-a",
+				"CreateRole p1",
+				"DeleteRoleMapping p99",
+				"DeleteRoleMapping stale-a",
+				"CreateRoleMapping p1",
+			},
+		},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			o := newFakeOpensearch()
+			o.patchErr = tc.patchErr
+			// use a cluster name unique to the test case to isolate its metrics
+			cluster := "patch-fallback-" + name
+			err := sync.Sync(context.Background(), log, l, k, []sync.Target{{
+				Name:       cluster,
+				Opensearch: o,
+				Dashboards: o,
+				Objects:    []string{"roles", "rolesmapping"},
+			}}, false, nil)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectCalls, o.calls, name)
+			// each changed object is counted once, whether or not the PATCH
+			// request failed
+			for labels, expect := range map[[3]string]float64{
+				{"role", "delete", "success"}:        3,
+				{"role", "create", "success"}:        1,
+				{"role", "delete", "failure"}:        0,
+				{"rolemapping", "delete", "success"}: 2,
+				{"rolemapping", "create", "success"}: 1,
+				{"rolemapping", "create", "failure"}: 0,
+			} {
+				assert.Equal(tt, expect, testutil.ToFloat64(
+					sync.OperationsTotal.WithLabelValues(cluster, labels[0], labels[1],
+						labels[2])), name)
+			}
+		})
+	}
+}
+
+func TestSyncPatchBatches(t *testing.T) {
+	// one more project than fits in a batch
+	var projects []lagoondb.Project
+	for i := 1; i <= sync.PatchBatchSize+1; i++ {
+		projects = append(projects,
+			lagoondb.Project{ID: i, Name: fmt.Sprintf("project-%d", i)})
+	}
+	l := &fakeLagoonDB{
+		projects:         projects,
+		groupProjectsMap: map[string][]int{},
+	}
+	o := newFakeOpensearch()
+	err := sync.Sync(context.Background(), zap.NewNop(), l, &fakeKeycloak{},
+		[]sync.Target{{
+			Name:       "default",
+			Opensearch: o,
+			Dashboards: o,
+			Objects:    []string{"roles"},
+		}}, false, nil)
+	assert.NoError(t, err, "sync")
+	assert.Equal(t, 2, len(o.calls), "patch requests")
+	var ops int
+	for _, call := range o.calls {
+		assert.True(t, strings.HasPrefix(call, "PatchRoles "), "patch request")
+		ops += len(strings.Split(call, ", "))
+	}
+	// p98 and p99 are replaced, and stale-a is removed
+	assert.Equal(t, sync.PatchBatchSize+1+1, ops, "patch operations")
+}
+
+func TestSyncExtraIndexTemplates(t *testing.T) {
+	l := &fakeLagoonDB{groupProjectsMap: map[string][]int{}}
+	extra := opensearch.IndexTemplate{
+		Name: "customlogs",
+		IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
+			IndexPatterns: []string{"custom-logs-*"},
+		},
+	}
+	// extra as it is returned by Opensearch after the sync created it
+	ownedExtra := extra
+	ownedExtra.IndexTemplateDefinition.Meta = map[string]any{
+		"managed_by": "lagoon-opensearch-sync",
+	}
+	builtinCalls := []string{
+		"CreateIndexTemplate applicationlogs",
+		"CreateIndexTemplate containerlogs",
+		"CreateIndexTemplate lagoonlogs",
+		"CreateIndexTemplate routerlogs",
+	}
+	var testCases = map[string]struct {
+		existing       map[string]opensearch.IndexTemplate
+		builtins       []string
+		indexTemplates map[string]opensearch.IndexTemplate
+		expectCalls    []string
+	}{
+		"create extra template": {
+			existing:       map[string]opensearch.IndexTemplate{},
+			indexTemplates: map[string]opensearch.IndexTemplate{"customlogs": extra},
+			expectCalls: []string{
+				"CreateIndexTemplate applicationlogs",
+				"CreateIndexTemplate containerlogs",
+				"CreateIndexTemplate customlogs",
+				"CreateIndexTemplate lagoonlogs",
+				"CreateIndexTemplate routerlogs",
+			},
+		},
+		"extra template up to date": {
+			existing: map[string]opensearch.IndexTemplate{
+				"customlogs": ownedExtra,
+				"other":      {Name: "other"},
+			},
+			indexTemplates: map[string]opensearch.IndexTemplate{"customlogs": extra},
+			expectCalls:    builtinCalls,
+		},
+		"removed extra template deleted": {
+			existing: map[string]opensearch.IndexTemplate{
+				"customlogs": ownedExtra,
+				"other":      {Name: "other"},
+			},
+			indexTemplates: nil,
+			expectCalls: append([]string{
+				"DeleteIndexTemplate customlogs",
+			}, builtinCalls...),
+		},
+		"unowned extra template replaced": {
+			existing: map[string]opensearch.IndexTemplate{
+				"customlogs": extra,
+			},
+			indexTemplates: map[string]opensearch.IndexTemplate{"customlogs": extra},
+			expectCalls: []string{
+				"DeleteIndexTemplate customlogs",
+				"CreateIndexTemplate applicationlogs",
+				"CreateIndexTemplate containerlogs",
+				"CreateIndexTemplate customlogs",
+				"CreateIndexTemplate lagoonlogs",
+				"CreateIndexTemplate routerlogs",
+			},
+		},
+		"built-in name ignored": {
+			existing: map[string]opensearch.IndexTemplate{},
+			indexTemplates: map[string]opensearch.IndexTemplate{
+				"routerlogs": extra,
+			},
+			expectCalls: builtinCalls,
+		},
+		"disabled built-in name ignored": {
+			existing: map[string]opensearch.IndexTemplate{},
+			builtins: []string{"routerlogs"},
+			indexTemplates: map[string]opensearch.IndexTemplate{
+				"lagoonlogs": extra,
+			},
+			expectCalls: []string{"CreateIndexTemplate routerlogs"},
+		},
+		"disabled built-in template deleted": {
+			existing: map[string]opensearch.IndexTemplate{
+				"lagoonlogs": {
+					Name: "lagoonlogs",
+					IndexTemplateDefinition: opensearch.IndexTemplateDefinition{
+						IndexPatterns: []string{"lagoon-logs-*"},
+						Meta: map[string]any{
+							"managed_by": "lagoon-opensearch-sync",
+						},
+					},
+				},
+				"applicationlogs": {Name: "applicationlogs"},
+			},
+			builtins: []string{"routerlogs"},
+			expectCalls: []string{
+				"DeleteIndexTemplate lagoonlogs",
+				"CreateIndexTemplate routerlogs",
+			},
+		},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			o := newFakeOpensearch()
+			o.indexTemplates = tc.existing
+			builtins := allBuiltinIndexTemplates
+			if tc.builtins != nil {
+				builtins.Names = tc.builtins
+			}
+			err := sync.Sync(context.Background(), log, l, &fakeKeycloak{},
+				[]sync.Target{{
+					Name:                  "default",
+					Opensearch:            o,
+					Dashboards:            o,
+					Objects:               []string{"indextemplates"},
+					BuiltinIndexTemplates: builtins,
+					IndexTemplates:        tc.indexTemplates,
+				}}, false, nil)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectCalls, o.calls, name)
+		})
+	}
+}
+
+func TestSyncOrder(t *testing.T) {
+	var testCases = map[string]struct {
+		input  []string
+		expect []string
+	}{
+		"no index templates": {
+			input:  []string{"roles", "componenttemplates"},
+			expect: []string{"roles", "componenttemplates"},
+		},
+		"dependency already first": {
+			input:  []string{"componenttemplates", "roles", "indextemplates"},
+			expect: []string{"componenttemplates", "roles", "indextemplates"},
+		},
+		"dependency moved": {
+			input: []string{"roles", "indextemplates", "tenants",
+				"componenttemplates"},
+			expect: []string{"roles", "componenttemplates", "indextemplates",
+				"tenants"},
+		},
+		"dependencies moved in order": {
+			input: []string{"indextemplates", "ingestpipelines", "roles",
+				"componenttemplates"},
+			expect: []string{"ingestpipelines", "componenttemplates",
+				"indextemplates", "roles"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expect, sync.SyncOrder(tc.input), name)
+		})
+	}
+}
+
+func TestSyncComponentTemplates(t *testing.T) {
+	l := &fakeLagoonDB{groupProjectsMap: map[string][]int{}}
+	var testCases = map[string]struct {
+		existing    map[string]opensearch.ComponentTemplate
+		objects     []string
+		expectCalls []string
+	}{
+		"component templates before index templates": {
+			existing: map[string]opensearch.ComponentTemplate{},
+			objects:  []string{"indextemplates", "componenttemplates"},
+			expectCalls: []string{
+				"CreateComponentTemplate lagoon-kubernetes",
+				"CreateIndexTemplate applicationlogs",
+				"CreateIndexTemplate containerlogs",
+				"CreateIndexTemplate lagoonlogs",
+				"CreateIndexTemplate routerlogs",
+			},
+		},
+		"unknown component template untouched": {
+			existing: map[string]opensearch.ComponentTemplate{
+				"other": {Name: "other"},
+			},
+			objects: []string{"componenttemplates"},
+			expectCalls: []string{
+				"CreateComponentTemplate lagoon-kubernetes",
+			},
+		},
+		"component template replaced": {
+			existing: map[string]opensearch.ComponentTemplate{
+				"lagoon-kubernetes": {Name: "lagoon-kubernetes"},
+			},
+			objects: []string{"componenttemplates"},
+			expectCalls: []string{
+				"CreateComponentTemplate lagoon-kubernetes",
+			},
+		},
+		"owned component template deleted": {
+			existing: map[string]opensearch.ComponentTemplate{
+				"lagoon-old": {
+					Name: "lagoon-old",
+					ComponentTemplateDefinition: opensearch.ComponentTemplateDefinition{
+						Meta: map[string]any{
+							"managed_by": "lagoon-opensearch-sync",
+						},
+					},
+				},
+			},
+			objects: []string{"componenttemplates"},
+			expectCalls: []string{
+				"CreateComponentTemplate lagoon-kubernetes",
+				"DeleteComponentTemplate lagoon-old",
+			},
+		},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			o := newFakeOpensearch()
+			o.componentTemplates = tc.existing
+			err := sync.Sync(context.Background(), log, l, &fakeKeycloak{},
+				[]sync.Target{{
+					Name:                  "default",
+					Opensearch:            o,
+					Dashboards:            o,
+					Objects:               tc.objects,
+					BuiltinIndexTemplates: allBuiltinIndexTemplates,
+				}}, false, nil)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectCalls, o.calls, name)
+		})
+	}
+}
+
+func TestSyncIngestPipelines(t *testing.T) {
+	l := &fakeLagoonDB{groupProjectsMap: map[string][]int{}}
+	extra := opensearch.IngestPipeline{
+		Processors: []map[string]any{
+			{"lowercase": map[string]any{"field": "level"}},
+		},
+	}
+	// extra as it is returned by Opensearch after the sync created it
+	ownedExtra := extra
+	ownedExtra.Meta = map[string]any{"managed_by": "lagoon-opensearch-sync"}
+	var testCases = map[string]struct {
+		existing          map[string]opensearch.IngestPipeline
+		ingestPipelines   map[string]opensearch.IngestPipeline
+		objects           []string
+		createPipelineErr error
+		expectCalls       []string
+		expectPipeline    bool
+	}{
+		"ingest pipelines before index templates": {
+			existing: map[string]opensearch.IngestPipeline{},
+			objects:  []string{"indextemplates", "ingestpipelines"},
+			expectCalls: []string{
+				"CreateIngestPipeline lagoon-router-logs",
+				"CreateIndexTemplate applicationlogs",
+				"CreateIndexTemplate containerlogs",
+				"CreateIndexTemplate lagoonlogs",
+				"CreateIndexTemplate routerlogs",
+			},
+			expectPipeline: true,
+		},
+		"no default pipeline if creation failed": {
+			existing:          map[string]opensearch.IngestPipeline{},
+			objects:           []string{"indextemplates", "ingestpipelines"},
+			createPipelineErr: fmt.Errorf("missing ingest-geoip plugin"),
+			expectCalls: []string{
+				"CreateIndexTemplate applicationlogs",
+				"CreateIndexTemplate containerlogs",
+				"CreateIndexTemplate lagoonlogs",
+				"CreateIndexTemplate routerlogs",
+			},
+		},
+		"default pipeline if replacement failed": {
+			existing: map[string]opensearch.IngestPipeline{
+				"lagoon-router-logs": {},
+			},
+			objects:           []string{"indextemplates", "ingestpipelines"},
+			createPipelineErr: fmt.Errorf("timeout"),
+			expectCalls: []string{
+				"CreateIndexTemplate applicationlogs",
+				"CreateIndexTemplate containerlogs",
+				"CreateIndexTemplate lagoonlogs",
+				"CreateIndexTemplate routerlogs",
+			},
+			expectPipeline: true,
+		},
+		"create extra pipeline": {
+			existing: map[string]opensearch.IngestPipeline{
+				"other": {},
+			},
+			ingestPipelines: map[string]opensearch.IngestPipeline{
+				"custom-logs": extra,
+			},
+			objects: []string{"ingestpipelines"},
+			expectCalls: []string{
+				"CreateIngestPipeline custom-logs",
+				"CreateIngestPipeline lagoon-router-logs",
+			},
+		},
+		"extra pipeline up to date": {
+			existing: map[string]opensearch.IngestPipeline{
+				"custom-logs": ownedExtra,
+			},
+			ingestPipelines: map[string]opensearch.IngestPipeline{
+				"custom-logs": extra,
+			},
+			objects:     []string{"ingestpipelines"},
+			expectCalls: []string{"CreateIngestPipeline lagoon-router-logs"},
+		},
+		"removed extra pipeline deleted": {
+			existing: map[string]opensearch.IngestPipeline{
+				"custom-logs": ownedExtra,
+				"other":       extra,
+			},
+			objects: []string{"ingestpipelines"},
+			expectCalls: []string{
+				"CreateIngestPipeline lagoon-router-logs",
+				"DeleteIngestPipeline custom-logs",
+			},
+		},
+		"built-in ID ignored": {
+			existing: map[string]opensearch.IngestPipeline{},
+			ingestPipelines: map[string]opensearch.IngestPipeline{
+				"lagoon-router-logs": extra,
+			},
+			objects:     []string{"ingestpipelines"},
+			expectCalls: []string{"CreateIngestPipeline lagoon-router-logs"},
+		},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			o := newFakeOpensearch()
+			o.ingestPipelines = tc.existing
+			o.createPipelineErr = tc.createPipelineErr
+			err := sync.Sync(context.Background(), log, l, &fakeKeycloak{},
+				[]sync.Target{{
+					Name:                  "default",
+					Opensearch:            o,
+					Dashboards:            o,
+					Objects:               tc.objects,
+					BuiltinIndexTemplates: allBuiltinIndexTemplates,
+					IngestPipelines:       tc.ingestPipelines,
+				}}, false, nil)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectCalls, o.calls, name)
+			routerLogs := o.createdIndexTemplates["routerlogs"]
+			_, ok := routerLogs.IndexTemplateDefinition.Template.
+				Settings["index.default_pipeline"]
+			assert.Equal(tt, tc.expectPipeline, ok, "default pipeline")
+		})
+	}
+}
+
+func TestSyncISMPolicies(t *testing.T) {
+	l := &fakeLagoonDB{
+		projects:         []lagoondb.Project{{ID: 1, Name: "project-a"}},
+		groupProjectsMap: map[string][]int{},
+		projectsMetadata: map[int]map[string]string{
+			1: {"logs-retention-days": "90"},
+		},
+	}
+	// ownedPolicy returns a lagoon-owned policy matching the given pattern
+	ownedPolicy := func(id, pattern string) opensearch.ISMPolicy {
+		return opensearch.ISMPolicy{
+			ID:          id,
+			SeqNo:       4,
+			PrimaryTerm: 1,
+			Policy: opensearch.ISMPolicyDefinition{
+				Description: "Lagoon-owned policy: delete old indices.",
+				ISMTemplate: []opensearch.ISMTemplate{{
+					IndexPatterns: []string{pattern},
+					Priority:      20,
+				}},
+			},
+		}
+	}
+	var testCases = map[string]struct {
+		retention       sync.ISMRetention
+		existing        map[string]opensearch.ISMPolicy
+		managedIndices  map[string]string
+		changePolicyErr error
+		expectCalls     []string
+	}{
+		"family and project policies": {
+			retention: sync.ISMRetention{
+				Days:               map[string]int{"router-logs": 14},
+				ProjectMetadataKey: "logs-retention-days",
+			},
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-stale":  ownedPolicy("lagoon-stale", "stale-*"),
+				"lagoon-manual": {ID: "lagoon-manual"},
+				"other":         {ID: "other"},
+			},
+			expectCalls: []string{
+				"CreateISMPolicy lagoon-application-logs-project-a",
+				"CreateISMPolicy lagoon-container-logs-project-a",
+				"CreateISMPolicy lagoon-lagoon-logs-project-a",
+				"CreateISMPolicy lagoon-router-logs",
+				"CreateISMPolicy lagoon-router-logs-project-a",
+				"DeleteISMPolicy lagoon-stale",
+			},
+		},
+		"update with version": {
+			retention: sync.ISMRetention{
+				Days: map[string]int{"router-logs": 14},
+			},
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs": ownedPolicy("lagoon-router-logs",
+					"router-logs-*"),
+			},
+			managedIndices: map[string]string{
+				"router-logs-project-a-_-2026.10": "lagoon-router-logs",
+				"router-logs-project-b-_-2026.10": "lagoon-router-logs",
+				"router-logs-project-c-_-2026.10": "manual",
+			},
+			expectCalls: []string{
+				"UpdateISMPolicy lagoon-router-logs 4/1",
+				"ChangeISMPolicy lagoon-router-logs " +
+					"router-logs-project-a-_-2026.10,router-logs-project-b-_-2026.10",
+			},
+		},
+		"unowned policy not updated": {
+			retention: sync.ISMRetention{
+				Days: map[string]int{"router-logs": 14},
+			},
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs": {ID: "lagoon-router-logs"},
+			},
+		},
+		"project override removed": {
+			retention: sync.ISMRetention{
+				Days: map[string]int{"router-logs": 14},
+			},
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs-project-b": ownedPolicy(
+					"lagoon-router-logs-project-b", "router-logs-project-b-_-*"),
+				"lagoon-lagoon-logs-project-b": ownedPolicy(
+					"lagoon-lagoon-logs-project-b", "lagoon-logs-project-b-_-*"),
+			},
+			managedIndices: map[string]string{
+				"router-logs-project-b-_-2026.10": "lagoon-router-logs-project-b",
+				"lagoon-logs-project-b-_-2026.10": "lagoon-lagoon-logs-project-b",
+			},
+			expectCalls: []string{
+				"CreateISMPolicy lagoon-router-logs",
+				"RemoveISMPolicy lagoon-logs-project-b-_-2026.10",
+				"DeleteISMPolicy lagoon-lagoon-logs-project-b",
+				"ChangeISMPolicy lagoon-router-logs router-logs-project-b-_-2026.10",
+				"DeleteISMPolicy lagoon-router-logs-project-b",
+			},
+		},
+		"policy kept if indices not moved": {
+			retention: sync.ISMRetention{
+				Days: map[string]int{"router-logs": 14},
+			},
+			existing: map[string]opensearch.ISMPolicy{
+				"lagoon-router-logs-project-b": ownedPolicy(
+					"lagoon-router-logs-project-b", "router-logs-project-b-_-*"),
+			},
+			managedIndices: map[string]string{
+				"router-logs-project-b-_-2026.10": "lagoon-router-logs-project-b",
+			},
+			changePolicyErr: fmt.Errorf("failed"),
+			expectCalls: []string{
+				"CreateISMPolicy lagoon-router-logs",
+			},
+		},
+	}
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			o := newFakeOpensearch()
+			o.ismPolicies = tc.existing
+			o.ismManagedIndices = tc.managedIndices
+			o.changePolicyErr = tc.changePolicyErr
+			err := sync.Sync(context.Background(), log, l, &fakeKeycloak{},
+				[]sync.Target{{
+					Name:         "default",
+					Opensearch:   o,
+					Dashboards:   o,
+					Objects:      []string{"ismpolicies"},
+					ISMRetention: tc.retention,
+				}}, false, nil)
+			assert.NoError(tt, err, name)
+			assert.Equal(tt, tc.expectCalls, o.calls, name)
+		})
+	}
+}
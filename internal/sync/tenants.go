@@ -2,8 +2,11 @@ package sync
 
 import (
 	"context"
+	"maps"
+	"slices"
 
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/keycloak"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/lagoondb"
 	"github.com/uselagoon/lagoon-opensearch-sync/internal/opensearch"
 	"go.uber.org/zap"
 )
@@ -20,8 +23,8 @@ func tenantsEqual(a, b opensearch.Tenant) bool {
 }
 
 // calculateTenantDiff returns a map of opensearch tenants which should be
-// created, and a slice of tenant names which should be deleted, in order to
-// reconcile existing with required.
+// created, and a sorted slice of tenant names which should be deleted, in
+// order to reconcile existing with required.
 func calculateTenantDiff(existing, required map[string]opensearch.Tenant) (
 	map[string]opensearch.Tenant, []string) {
 	// calculate tenants to create
@@ -46,6 +49,7 @@ func calculateTenantDiff(existing, required map[string]opensearch.Tenant) (
 			}
 		}
 	}
+	slices.Sort(toDelete)
 	return toCreate, toDelete
 }
 
@@ -96,8 +100,10 @@ func syncTenants(
 	log *zap.Logger,
 	groups []keycloak.Group,
 	groupProjectsMap map[string][]int,
+	organizations []lagoondb.Organization,
 	o OpensearchService,
 	dryRun bool,
+	diff *DiffWriter,
 ) {
 	// get tenants from Opensearch
 	existing, err := o.Tenants(ctx)
@@ -109,11 +115,15 @@ func syncTenants(
 	existing = filterTenants(existing)
 	// generate the tenants required by Lagoon
 	required := generateTenants(log, groups, groupProjectsMap)
+	mergeRequired(log, "tenant", required,
+		generateOrganizationTenants(organizations))
 	// calculate tenants to add/remove
 	toCreate, toDelete := calculateTenantDiff(existing, required)
 	for _, name := range toDelete {
 		if dryRun {
 			log.Info("dry run mode: not deleting tenant", zap.String("name", name))
+			diff.write(log, "tenant", "", name,
+				existing[name].TenantDescription, nil)
 			continue
 		}
 		err = o.DeleteTenant(ctx, name)
@@ -125,9 +135,15 @@ func syncTenants(
 		}
 		log.Info("deleted tenant", zap.String("name", name))
 	}
-	for name, tenant := range toCreate {
+	for _, name := range slices.Sorted(maps.Keys(toCreate)) {
+		tenant := toCreate[name]
 		if dryRun {
 			log.Info("dry run mode: not creating tenant", zap.String("name", name))
+			var eTenant any
+			if e, ok := existing[name]; ok {
+				eTenant = e.TenantDescription
+			}
+			diff.write(log, "tenant", "", name, eTenant, tenant.TenantDescription)
 			continue
 		}
 		err = o.CreateTenant(ctx, name, &tenant)
@@ -0,0 +1,108 @@
+// Package tlsconfig constructs the TLS configuration of the Opensearch and
+// Opensearch Dashboards clients.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Options configure a TLS client connection.
+type Options struct {
+	// CACertificates is a PEM encoded bundle of one or more CA certificates
+	// used to validate the server certificate.
+	CACertificates string
+	// SystemCertPool adds the CACertificates to the system trust store,
+	// instead of trusting only the CACertificates. If CACertificates is empty
+	// the system trust store is always used.
+	SystemCertPool bool
+	// InsecureSkipVerify disables validation of the server certificate. It
+	// should only be used for local development.
+	InsecureSkipVerify bool
+	// ClientCertificate and ClientKey are a PEM encoded certificate and key
+	// which are presented to the server for client certificate
+	// authentication.
+	ClientCertificate string
+	ClientKey         string
+	// ServerName overrides the host name used to validate the server
+	// certificate, and sent in the SNI extension.
+	ServerName string
+}
+
+// parseCertificates parses all the certificates in the given PEM bundle. It
+// returns an error if the bundle contains no certificates, or any block which
+// is not a valid certificate.
+func parseCertificates(bundle string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block type %s at index %d",
+				block.Type, len(certs))
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse certificate at index %d: %v",
+				len(certs), err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return certs, nil
+}
+
+// New constructs a client TLS configuration from the given options.
+func New(log *zap.Logger, opts Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: opts.ServerName,
+	}
+	// construct the CA pool
+	if opts.CACertificates != "" {
+		cas, err := parseCertificates(opts.CACertificates)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse CA certificates: %v", err)
+		}
+		cp := x509.NewCertPool()
+		if opts.SystemCertPool {
+			cp, err = x509.SystemCertPool()
+			if err != nil {
+				return nil, fmt.Errorf("couldn't load system cert pool: %v", err)
+			}
+		}
+		for _, ca := range cas {
+			cp.AddCert(ca)
+		}
+		tlsConfig.RootCAs = cp
+	}
+	if opts.InsecureSkipVerify {
+		log.Warn("TLS certificate verification is disabled. " +
+			"This is insecure and should only be used for local development.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	// parse client certificate
+	if opts.ClientCertificate == "" && opts.ClientKey == "" {
+		return tlsConfig, nil
+	}
+	if opts.ClientCertificate == "" || opts.ClientKey == "" {
+		return nil, fmt.Errorf(
+			"client certificate and key must be specified together")
+	}
+	cert, err := tls.X509KeyPair(
+		[]byte(opts.ClientCertificate), []byte(opts.ClientKey))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse client certificate: %v", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return tlsConfig, nil
+}
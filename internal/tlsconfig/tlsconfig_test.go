@@ -0,0 +1,271 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/tlsconfig"
+	"go.uber.org/zap"
+)
+
+// testCertificate is a certificate and its private key.
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// PEM encoded
+	certPEM string
+	keyPEM  string
+}
+
+// newTestCertificate generates a certificate signed by the given parent. If
+// parent is nil, the certificate is a self-signed CA.
+func newTestCertificate(tt *testing.T, parent *testCertificate,
+	template *x509.Certificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer,
+		&key.PublicKey, signerKey)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	return &testCertificate{
+		cert: cert,
+		key:  key,
+		certPEM: string(pem.EncodeToMemory(
+			&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM: string(pem.EncodeToMemory(
+			&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+// newTestPKI generates a CA, and a server and client certificate signed by
+// the CA.
+func newTestPKI(tt *testing.T) (ca, server, client *testCertificate) {
+	ca = newTestCertificate(tt, nil, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	server = newTestCertificate(tt, ca, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "opensearch"},
+		DNSNames:     []string{"opensearch.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	client = newTestCertificate(tt, ca, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "admin"},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return ca, server, client
+}
+
+// newTestTLSServer starts a mock server which authenticates clients by
+// either a client certificate signed by the CA, or basic authentication.
+func newTestTLSServer(tt *testing.T, ca,
+	server *testCertificate) *httptest.Server {
+	cp := x509.NewCertPool()
+	cp.AddCert(ca.cert)
+	cert, err := tls.X509KeyPair([]byte(server.certPEM), []byte(server.keyPEM))
+	if err != nil {
+		tt.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if len(r.TLS.PeerCertificates) == 0 &&
+				(!ok || username != "admin" || password != "secret") {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    cp,
+	}
+	ts.StartTLS()
+	return ts
+}
+
+func TestNew(t *testing.T) {
+	ca, server, client := newTestPKI(t)
+	otherCA, _, untrusted := newTestPKI(t)
+	var testCases = map[string]struct {
+		opts              tlsconfig.Options
+		password          string
+		expectConfigError bool
+		expectError       bool
+	}{
+		"client certificate": {
+			opts: tlsconfig.Options{
+				CACertificates:    ca.certPEM,
+				ClientCertificate: client.certPEM,
+				ClientKey:         client.keyPEM,
+			},
+		},
+		"basic auth": {
+			opts:     tlsconfig.Options{CACertificates: ca.certPEM},
+			password: "secret",
+		},
+		"no credentials": {
+			opts:        tlsconfig.Options{CACertificates: ca.certPEM},
+			expectError: true,
+		},
+		"untrusted client certificate": {
+			opts: tlsconfig.Options{
+				CACertificates:    ca.certPEM,
+				ClientCertificate: untrusted.certPEM,
+				ClientKey:         untrusted.keyPEM,
+			},
+			expectError: true,
+		},
+		"client certificate without key": {
+			opts: tlsconfig.Options{
+				CACertificates:    ca.certPEM,
+				ClientCertificate: client.certPEM,
+			},
+			expectConfigError: true,
+		},
+		"mismatched client key": {
+			opts: tlsconfig.Options{
+				CACertificates:    ca.certPEM,
+				ClientCertificate: client.certPEM,
+				ClientKey:         untrusted.keyPEM,
+			},
+			expectConfigError: true,
+		},
+		"CA bundle": {
+			opts: tlsconfig.Options{
+				CACertificates: otherCA.certPEM + ca.certPEM,
+			},
+			password: "secret",
+		},
+		"CA bundle with system cert pool": {
+			opts: tlsconfig.Options{
+				CACertificates: otherCA.certPEM + ca.certPEM,
+				SystemCertPool: true,
+			},
+			password: "secret",
+		},
+		"wrong CA": {
+			opts:        tlsconfig.Options{CACertificates: otherCA.certPEM},
+			password:    "secret",
+			expectError: true,
+		},
+		"system cert pool": {
+			opts:        tlsconfig.Options{SystemCertPool: true},
+			password:    "secret",
+			expectError: true,
+		},
+		"insecure": {
+			opts: tlsconfig.Options{
+				CACertificates:     otherCA.certPEM,
+				InsecureSkipVerify: true,
+			},
+			password: "secret",
+		},
+		"invalid CA bundle": {
+			opts: tlsconfig.Options{
+				CACertificates: ca.certPEM + "-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----\n",
+			},
+			expectConfigError: true,
+		},
+		"empty CA bundle": {
+			opts:              tlsconfig.Options{CACertificates: "foo"},
+			expectConfigError: true,
+		},
+		"server name": {
+			opts: tlsconfig.Options{
+				CACertificates: ca.certPEM,
+				ServerName:     "opensearch.example.com",
+			},
+			password: "secret",
+		},
+		"wrong server name": {
+			opts: tlsconfig.Options{
+				CACertificates: ca.certPEM,
+				ServerName:     "dashboards.example.com",
+			},
+			password:    "secret",
+			expectError: true,
+		},
+		"private key in CA bundle": {
+			opts: tlsconfig.Options{
+				CACertificates: ca.certPEM + client.keyPEM,
+			},
+			expectConfigError: true,
+		},
+	}
+	ts := newTestTLSServer(t, ca, server)
+	defer ts.Close()
+	log := zap.NewNop()
+	for name, tc := range testCases {
+		t.Run(name, func(tt *testing.T) {
+			tlsConfig, err := tlsconfig.New(log, tc.opts)
+			if tc.expectConfigError {
+				assert.Error(tt, err, name)
+				return
+			}
+			assert.NoError(tt, err, name)
+			c := &http.Client{
+				Timeout:   time.Second,
+				Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			}
+			req, err := http.NewRequest("GET", ts.URL, nil)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if tc.password != "" {
+				req.SetBasicAuth("admin", tc.password)
+			}
+			res, err := c.Do(req)
+			if err == nil {
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					err = fmt.Errorf("bad response: %d", res.StatusCode)
+				}
+			}
+			if tc.expectError {
+				assert.Error(tt, err, name)
+			} else {
+				assert.NoError(tt, err, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package tlsconfig
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"go.uber.org/zap"
+)
+
+// Source is a source of Options whose PEM data may be reloaded from files.
+type Source struct {
+	CACertificates     *secret.Value
+	ClientCertificate  *secret.Value
+	ClientKey          *secret.Value
+	SystemCertPool     bool
+	InsecureSkipVerify bool
+	ServerName         string
+}
+
+// options returns the current Options, and the sum of the generations of the
+// PEM data, which changes whenever any of the PEM data is reloaded.
+func (s *Source) options() (Options, uint64, error) {
+	opts := Options{
+		SystemCertPool:     s.SystemCertPool,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+		ServerName:         s.ServerName,
+	}
+	var generation uint64
+	for _, v := range []struct {
+		name  string
+		value *secret.Value
+		dst   *string
+	}{
+		{"CA certificates", s.CACertificates, &opts.CACertificates},
+		{"client certificate", s.ClientCertificate, &opts.ClientCertificate},
+		{"client key", s.ClientKey, &opts.ClientKey},
+	} {
+		value, g, err := v.value.Load()
+		if err != nil {
+			return Options{}, 0, fmt.Errorf("couldn't load %s: %v", v.name, err)
+		}
+		*v.dst = value
+		generation += g
+	}
+	return opts, generation, nil
+}
+
+// Transport is an http.RoundTripper which rebuilds its TLS configuration, and
+// the underlying http.Transport, when the PEM data of its Source changes.
+type Transport struct {
+	log    *zap.Logger
+	source Source
+	base   *http.Transport
+
+	mu         sync.Mutex
+	generation uint64
+	transport  *http.Transport
+}
+
+// NewTransport returns a Transport which clones the given base transport
+// with the TLS configuration from the given source. It returns an error if
+// the initial TLS configuration is invalid.
+func NewTransport(
+	log *zap.Logger,
+	source Source,
+	base *http.Transport,
+) (*Transport, error) {
+	t := &Transport{log: log, source: source, base: base}
+	opts, generation, err := source.options()
+	if err != nil {
+		return nil, err
+	}
+	if err = t.rebuild(opts, generation); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// rebuild replaces the underlying transport using the given options. The
+// caller must hold the lock, unless the Transport is being constructed.
+func (t *Transport) rebuild(opts Options, generation uint64) error {
+	tlsConfig, err := New(t.log, opts)
+	if err != nil {
+		return err
+	}
+	transport := t.base.Clone()
+	transport.TLSClientConfig = tlsConfig
+	if t.transport != nil {
+		// connections using the old TLS configuration are no longer needed
+		t.transport.CloseIdleConnections()
+	}
+	t.transport = transport
+	t.generation = generation
+	return nil
+}
+
+// current returns the underlying transport, rebuilding it first if the PEM
+// data has changed. If the PEM data cannot be loaded or is invalid, a warning
+// is logged and the previous transport continues to be used.
+func (t *Transport) current() *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	opts, generation, err := t.source.options()
+	if err != nil {
+		t.log.Warn("couldn't reload TLS configuration", zap.Error(err))
+		return t.transport
+	}
+	if generation == t.generation {
+		return t.transport
+	}
+	if err = t.rebuild(opts, generation); err != nil {
+		// don't retry until the PEM data changes again
+		t.generation = generation
+		t.log.Warn("couldn't rebuild TLS configuration", zap.Error(err))
+		return t.transport
+	}
+	t.log.Info("reloaded TLS configuration")
+	return t.transport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current().RoundTrip(req)
+}
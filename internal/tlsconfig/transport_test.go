@@ -0,0 +1,63 @@
+package tlsconfig_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/secret"
+	"github.com/uselagoon/lagoon-opensearch-sync/internal/tlsconfig"
+	"go.uber.org/zap"
+)
+
+// writeFile writes data to the file at path, and sets its modification time
+// to mtime so that the change is detected regardless of filesystem timestamp
+// resolution.
+func writeFile(tt *testing.T, path, data string, mtime time.Time) {
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		tt.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		tt.Fatal(err)
+	}
+}
+
+func TestTransportReload(t *testing.T) {
+	ca, server, _ := newTestPKI(t)
+	otherCA, _, _ := newTestPKI(t)
+	ts := newTestTLSServer(t, ca, server)
+	defer ts.Close()
+	// start with the wrong CA
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	now := time.Now()
+	writeFile(t, caFile, otherCA.certPEM, now)
+	caValue, err := secret.File(caFile)
+	assert.NoError(t, err, "secret.File")
+	transport, err := tlsconfig.NewTransport(zap.NewNop(),
+		tlsconfig.Source{CACertificates: caValue},
+		http.DefaultTransport.(*http.Transport))
+	assert.NoError(t, err, "NewTransport")
+	c := &http.Client{Timeout: time.Second, Transport: transport}
+	get := func() error {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("admin", "secret")
+		res, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	assert.Error(t, get(), "wrong CA")
+	// an invalid CA is ignored, and the previous configuration is kept
+	writeFile(t, caFile, "invalid", now.Add(time.Minute))
+	assert.Error(t, get(), "invalid CA")
+	// the correct CA is picked up on the next request
+	writeFile(t, caFile, ca.certPEM, now.Add(2*time.Minute))
+	assert.NoError(t, get(), "reloaded CA")
+}